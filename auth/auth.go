@@ -0,0 +1,313 @@
+// Package auth authenticates the API requests with API keys, HS256 bearer tokens or personal access tokens.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ananikitina/time-tracker/logging"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the header carrying an API key
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix starts every API key and tokenPrefix every personal access token, so that leaked ones are easy to find
+const (
+	apiKeyPrefix = "tt_"
+	tokenPrefix  = "ttp_"
+)
+
+// Authentication methods
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	// MethodOIDC is the login with the identity provider, which is answered with a bearer token
+	MethodOIDC = "oidc"
+	// MethodToken is a personal access token sent as a bearer token
+	MethodToken = "personal_access_token"
+)
+
+var (
+	// ErrNoCredentials is returned for requests without an API key or a bearer token
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidAPIKey is returned for unknown or revoked API keys
+	ErrInvalidAPIKey = errors.New("invalid API key")
+)
+
+// principalKey is the key of the principal in the gin context
+const principalKey = "auth.principal"
+
+// Principal is who made an authenticated request
+type Principal struct {
+	// Subject is "user:" followed by the ID of the user or "api-key:" followed by the name of the API key
+	Subject string `json:"subject"`
+	Method  string `json:"method"`
+	// UserID is the user the token was issued to, 0 for API keys
+	UserID uint `json:"user_id,omitempty"`
+	// Role is the current role of the user, API keys have the admin role
+	Role string `json:"role"`
+	// OrganizationID is the organization of the user or of the API key, the request only sees its data
+	OrganizationID uint `json:"organization_id"`
+	// APIKeyID is the ID of the API key used, 0 for tokens
+	APIKeyID uint `json:"api_key_id,omitempty"`
+	// TokenID is the ID of the personal access token used and Scopes are its scopes, which limit the routes it may use
+	TokenID uint     `json:"token_id,omitempty"`
+	Scopes  []string `json:"scopes,omitempty"`
+}
+
+// CurrentPrincipal returns the principal of the request, false if the request is not authenticated
+func CurrentPrincipal(c *gin.Context) (Principal, bool) {
+	principal, ok := c.Get(principalKey)
+	if !ok {
+		return Principal{}, false
+	}
+	return principal.(Principal), true
+}
+
+// SetPrincipal stores the principal of the request in the gin context and in the request's logs
+// and limits the repositories to the principal's organization for the rest of the request
+func SetPrincipal(c *gin.Context, principal Principal) {
+	c.Set(principalKey, principal)
+	c.Request = c.Request.WithContext(repository.WithOrganization(c.Request.Context(), principal.OrganizationID))
+	logging.AddAttrs(c.Request.Context(), slog.String("principal", principal.Subject), slog.String("role", principal.Role),
+		slog.Uint64("organization", uint64(principal.OrganizationID)))
+	if principal.TokenID != 0 {
+		logging.AddAttrs(c.Request.Context(), slog.Uint64("token_id", uint64(principal.TokenID)))
+	}
+}
+
+// Authenticator checks the credentials of the requests
+type Authenticator struct {
+	keys   repository.APIKeyRepository
+	tokens repository.TokenRepository
+	users  repository.UserRepository
+	jwt    JWTConfig
+	now    func() time.Time
+}
+
+func NewAuthenticator(keys repository.APIKeyRepository, tokens repository.TokenRepository, users repository.UserRepository, jwt JWTConfig) *Authenticator {
+	return &Authenticator{keys: keys, tokens: tokens, users: users, jwt: jwt, now: time.Now}
+}
+
+// Middleware rejects the requests without valid credentials with 401
+// and puts the principal of the others into the gin context
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := a.authenticate(c)
+		if err != nil {
+			if !errors.Is(err, ErrNoCredentials) && !errors.Is(err, ErrInvalidAPIKey) &&
+				!errors.Is(err, ErrInvalidToken) && !errors.Is(err, ErrTokenExpired) {
+				slog.ErrorContext(c.Request.Context(), "Failed to authenticate", "error", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+				return
+			}
+			slog.InfoContext(c.Request.Context(), "Authentication failed", "error", err)
+			c.Header("WWW-Authenticate", `Bearer realm="time-tracker"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized", "details": publicReason(err)})
+			return
+		}
+
+		SetPrincipal(c, principal)
+		c.Next()
+	}
+}
+
+// IssueToken returns a bearer token for the user valid for ttl and the time it expires at
+func (a *Authenticator) IssueToken(userID uint, ttl time.Duration) (string, time.Time, error) {
+	if len(a.jwt.SigningKey) == 0 {
+		return "", time.Time{}, errors.New("bearer tokens are not accepted, JWT_SIGNING_KEY is not set")
+	}
+	now := a.now()
+	expiresAt := now.Add(ttl).Truncate(time.Second)
+	claims := Claims{
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		Issuer:    a.jwt.Issuer,
+		ExpiresAt: expiresAt.Unix(),
+		IssuedAt:  now.Unix(),
+	}
+	if a.jwt.Audience != "" {
+		claims.Audience = audience{a.jwt.Audience}
+	}
+	token, err := SignJWT(a.jwt.SigningKey, claims)
+	return token, expiresAt, err
+}
+
+// authenticate returns the principal of the request by its API key or bearer token
+func (a *Authenticator) authenticate(c *gin.Context) (Principal, error) {
+	// The organization of the request is not known yet, the credentials are looked up in all organizations
+	ctx := repository.WithSystem(c.Request.Context())
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		apiKey, err := a.keys.GetByHash(ctx, HashAPIKey(key))
+		if errors.Is(err, repository.ErrNotFound) {
+			return Principal{}, ErrInvalidAPIKey
+		}
+		if err != nil {
+			return Principal{}, err
+		}
+		return Principal{
+			Subject:        "api-key:" + apiKey.Name,
+			Method:         MethodAPIKey,
+			Role:           models.RoleAdmin,
+			OrganizationID: apiKey.OrganizationID,
+			APIKeyID:       apiKey.ID,
+		}, nil
+	}
+
+	scheme, token, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, tokenPrefix) {
+		return a.authenticateToken(ctx, token)
+	}
+	if len(a.jwt.SigningKey) == 0 {
+		return Principal{}, errors.Join(ErrInvalidToken, errors.New("bearer tokens are not accepted"))
+	}
+	claims, err := a.jwt.Verify(token, a.now())
+	if err != nil {
+		return Principal{}, err
+	}
+
+	// The subject is the ID of the user, the role is taken from the user as it is now
+	userID, err := strconv.ParseUint(claims.Subject, 10, 0)
+	if err != nil || userID == 0 {
+		return Principal{}, fmt.Errorf("%w: subject is not a user ID", ErrInvalidToken)
+	}
+	user, err := a.users.GetByID(ctx, uint(userID))
+	if errors.Is(err, repository.ErrNotFound) {
+		return Principal{}, fmt.Errorf("%w: unknown user", ErrInvalidToken)
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{
+		Subject:        "user:" + claims.Subject,
+		Method:         MethodJWT,
+		UserID:         user.ID,
+		Role:           user.Role,
+		OrganizationID: user.OrganizationID,
+	}, nil
+}
+
+// authenticateToken returns the principal of the personal access token, it acts as its user within its scopes
+func (a *Authenticator) authenticateToken(ctx context.Context, secret string) (Principal, error) {
+	token, err := a.tokens.GetByHash(ctx, HashAPIKey(secret))
+	if errors.Is(err, repository.ErrNotFound) {
+		return Principal{}, fmt.Errorf("%w: unknown or revoked personal access token", ErrInvalidToken)
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	now := a.now()
+	if token.Expired(now) {
+		return Principal{}, ErrTokenExpired
+	}
+	user, err := a.users.GetByID(ctx, token.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return Principal{}, fmt.Errorf("%w: unknown user", ErrInvalidToken)
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+
+	// Failing to record the use doesn't fail the request
+	if err := a.tokens.Touch(ctx, token.ID, now); err != nil {
+		slog.WarnContext(ctx, "Failed to record the use of the personal access token", "token_id", token.ID, "error", err)
+	}
+	return Principal{
+		Subject:        "user:" + strconv.FormatUint(uint64(user.ID), 10),
+		Method:         MethodToken,
+		UserID:         user.ID,
+		Role:           user.Role,
+		OrganizationID: user.OrganizationID,
+		TokenID:        token.ID,
+		Scopes:         token.Scopes,
+	}, nil
+}
+
+// publicReason tells the client why the credentials were rejected without the details of the check
+func publicReason(err error) string {
+	switch {
+	case errors.Is(err, ErrNoCredentials):
+		return "an API key in " + APIKeyHeader + " or a bearer token is required"
+	case errors.Is(err, ErrInvalidAPIKey):
+		return "invalid API key"
+	case errors.Is(err, ErrTokenExpired):
+		return "token expired"
+	default:
+		return "invalid token"
+	}
+}
+
+// CreateAPIKey generates a new API key and stores its hash.
+// It returns the stored key and the key itself, which can't be recovered later.
+func CreateAPIKey(ctx context.Context, keys repository.APIKeyRepository, name string) (models.APIKey, string, error) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	apiKey := models.APIKey{Name: name, Prefix: APIKeyPrefix(key), Hash: HashAPIKey(key)}
+	if err := keys.Create(ctx, &apiKey); err != nil {
+		return models.APIKey{}, "", err
+	}
+	return apiKey, key, nil
+}
+
+// CreateToken generates a new personal access token and stores it with its hash.
+// It returns the stored token and the token itself, which can't be recovered later.
+func CreateToken(ctx context.Context, tokens repository.TokenRepository, token models.PersonalAccessToken) (models.PersonalAccessToken, string, error) {
+	secret, err := generateSecret(tokenPrefix)
+	if err != nil {
+		return models.PersonalAccessToken{}, "", err
+	}
+	token.Prefix = secret[:len(tokenPrefix)+6]
+	token.Hash = HashAPIKey(secret)
+	if err := tokens.Create(ctx, &token); err != nil {
+		return models.PersonalAccessToken{}, "", err
+	}
+	return token, secret, nil
+}
+
+// GenerateAPIKey returns a new random API key
+func GenerateAPIKey() (string, error) {
+	return generateSecret(apiKeyPrefix)
+}
+
+// generateSecret returns the prefix followed by 32 random bytes
+func generateSecret(prefix string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// HashAPIKey returns the hash the API key or personal access token is stored and looked up by.
+// They are random, so a plain SHA-256 is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix returns the start of the key shown to tell the keys apart
+func APIKeyPrefix(key string) string {
+	if len(key) > len(apiKeyPrefix)+6 {
+		return key[:len(apiKeyPrefix)+6]
+	}
+	return key
+}
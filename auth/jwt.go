@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed, not signed with the key or not meant for the service
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned for tokens past their expiry time
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// minSigningKeyLength is the minimum length of the HS256 signing key in bytes
+const minSigningKeyLength = 32
+
+// JWTConfig configures the validation of HS256 bearer tokens.
+// An empty signing key means bearer tokens are not accepted.
+type JWTConfig struct {
+	SigningKey []byte
+	// Issuer and Audience are checked against the iss and aud claims if set
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew allowed when checking exp and nbf
+	Leeway time.Duration
+}
+
+// JWTConfigFromEnv reads the configuration from the JWT_* environment variables:
+// JWT_SIGNING_KEY is the base64 encoded key of at least 32 bytes, JWT_ISSUER and JWT_AUDIENCE are optional.
+func JWTConfigFromEnv() (JWTConfig, error) {
+	config := JWTConfig{
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+		Leeway:   30 * time.Second,
+	}
+	if value := os.Getenv("JWT_SIGNING_KEY"); value != "" {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return JWTConfig{}, fmt.Errorf("JWT_SIGNING_KEY is not base64: %w", err)
+		}
+		if len(key) < minSigningKeyLength {
+			return JWTConfig{}, fmt.Errorf("JWT_SIGNING_KEY must be at least %d bytes long", minSigningKeyLength)
+		}
+		config.SigningKey = key
+	}
+	return config, nil
+}
+
+// Claims are the claims of the tokens the service accepts
+type Claims struct {
+	// Subject is the ID of the user the token is issued to
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+}
+
+// audience is the aud claim, a single string or an array of them
+type audience []string
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// jwtHeader is the only header the service issues and accepts
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// SignJWT returns an HS256 token with the claims signed with the key
+func SignJWT(key []byte, claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(key, unsigned), nil
+}
+
+// Verify checks the signature and the claims of the token and returns its claims.
+// Only HS256 tokens with a subject and an expiry time are accepted.
+func (c JWTConfig) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return Claims{}, fmt.Errorf("%w: unsupported algorithm", ErrInvalidToken)
+	}
+	if !hmac.Equal([]byte(sign(c.SigningKey, parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return Claims{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	switch {
+	case claims.Subject == "":
+		return Claims{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	case claims.ExpiresAt == 0:
+		return Claims{}, fmt.Errorf("%w: no expiry time", ErrInvalidToken)
+	case now.Add(-c.Leeway).After(time.Unix(claims.ExpiresAt, 0)):
+		return Claims{}, ErrTokenExpired
+	case claims.NotBefore != 0 && now.Add(c.Leeway).Before(time.Unix(claims.NotBefore, 0)):
+		return Claims{}, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	case c.Issuer != "" && claims.Issuer != c.Issuer:
+		return Claims{}, fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	case c.Audience != "" && !contains(claims.Audience, c.Audience):
+		return Claims{}, fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// sign returns the HS256 signature of the unsigned token
+func sign(key []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
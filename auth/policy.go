@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy decides whether the principal may make the request.
+// It returns the reason of a refusal, or an empty reason if the request is allowed.
+type Policy func(c *gin.Context, principal Principal) (string, error)
+
+// Require returns the middleware letting through only the requests the policy allows.
+// The others are rejected with 403 and the reason. Personal access tokens are always rejected.
+func Require(policy Policy) gin.HandlerFunc {
+	return RequireScope("", policy)
+}
+
+// RequireScope is Require for the routes the personal access tokens with the scope may use as well
+func RequireScope(scope string, policy Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		reason := scopeReason(principal, scope)
+		var err error
+		if reason == "" {
+			reason, err = policy(c, principal)
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to check permissions", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if reason != "" {
+			slog.InfoContext(c.Request.Context(), "Access denied", "reason", reason)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "details": reason})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Roles allows the principals with one of the roles
+func Roles(roles ...string) Policy {
+	return func(_ *gin.Context, principal Principal) (string, error) {
+		if slices.Contains(roles, principal.Role) {
+			return "", nil
+		}
+		return rolesReason(roles), nil
+	}
+}
+
+// SelfOr allows the user whose ID is in the path parameter and the principals with one of the roles,
+// only the user if no roles are given
+func SelfOr(param string, roles ...string) Policy {
+	return func(c *gin.Context, principal Principal) (string, error) {
+		if slices.Contains(roles, principal.Role) || isSelf(c, param, principal) {
+			return "", nil
+		}
+		if len(roles) == 0 {
+			return "you may only access your own data", nil
+		}
+		return "you may only access your own data, other users' data " + rolesReason(roles), nil
+	}
+}
+
+// TeamOr allows what SelfOr does and the manager of the user whose ID is in the path parameter
+func TeamOr(users repository.UserRepository, param string, roles ...string) Policy {
+	self := SelfOr(param, roles...)
+	return func(c *gin.Context, principal Principal) (string, error) {
+		reason, err := self(c, principal)
+		if reason == "" || err != nil || principal.Role != models.RoleManager {
+			return reason, err
+		}
+
+		userID, err := strconv.ParseUint(c.Param(param), 10, 0)
+		if err != nil {
+			return reason, nil
+		}
+		user, err := users.GetByID(c.Request.Context(), uint(userID))
+		if errors.Is(err, repository.ErrNotFound) {
+			return "managers may only access the data of their team", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if user.ManagerID == nil || *user.ManagerID != principal.UserID {
+			return "managers may only access the data of their team", nil
+		}
+		return "", nil
+	}
+}
+
+// scopeReason returns why the principal's personal access token may not be used for the scope,
+// empty for the other methods
+func scopeReason(principal Principal, scope string) string {
+	switch {
+	case principal.Method != MethodToken:
+		return ""
+	case scope == "":
+		return "personal access tokens may not be used for this request"
+	case !slices.Contains(principal.Scopes, scope):
+		return "the token lacks the " + scope + " scope"
+	}
+	return ""
+}
+
+// isSelf reports whether the path parameter is the ID of the principal's user
+func isSelf(c *gin.Context, param string, principal Principal) bool {
+	userID, err := strconv.ParseUint(c.Param(param), 10, 0)
+	return err == nil && principal.UserID != 0 && uint(userID) == principal.UserID
+}
+
+// rolesReason tells which roles are required
+func rolesReason(roles []string) string {
+	if len(roles) == 1 {
+		return fmt.Sprintf("requires the %s role", roles[0])
+	}
+	return fmt.Sprintf("requires one of the roles %s", strings.Join(roles, ", "))
+}
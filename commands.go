@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/database"
+	"github.com/ananikitina/time-tracker/encryption"
+	"github.com/ananikitina/time-tracker/logging"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/oidc"
+	"github.com/ananikitina/time-tracker/peopleinfo"
+	"github.com/ananikitina/time-tracker/repository"
+)
+
+// runCommand runs the command given in the command line arguments
+func runCommand(args []string) {
+	switch args[0] {
+	case "migrate":
+		runMigrate(args[1:])
+	case "people-info-stub":
+		runPeopleInfoStub(args[1:])
+	case "oidc-mock":
+		runOIDCMock(args[1:])
+	case "passport-keys":
+		runPassportKeys(args[1:])
+	case "audit":
+		runAudit(args[1:])
+	case "api-keys":
+		runAPIKeys(args[1:])
+	case "organizations":
+		runOrganizations(args[1:])
+	default:
+		logging.Fatal("Unknown command", "command", args[0])
+	}
+}
+
+// usage prints the usage of the command and exits
+func usage(text string) {
+	fmt.Fprintln(os.Stderr, text)
+	os.Exit(2)
+}
+
+const migrateUsage = "usage: time-tracker migrate up | down [steps] | status"
+
+// runMigrate handles the "migrate" command:
+//
+//	migrate up            applies all pending migrations
+//	migrate down [steps]  reverts the last steps migrations, one by default
+//	migrate status        lists migrations and when they were applied
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		usage(migrateUsage)
+	}
+
+	migrations, err := database.Migrations()
+	if err != nil {
+		logging.Fatal("Failed to load migrations", "error", err)
+	}
+
+	database.Connect()
+	migrator := database.NewMigrator(database.DB, migrations)
+	ctx := repository.WithSystem(context.Background())
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied  %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			logging.Fatal("Failed to apply migrations", "error", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				usage(migrateUsage)
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			logging.Fatal("Failed to revert migrations", "error", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logging.Fatal("Failed to get migration status", "error", err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		usage(migrateUsage)
+	}
+}
+
+// runPeopleInfoStub handles the "people-info-stub [address]" command:
+// it serves the stub people info service on the address, :8081 by default
+func runPeopleInfoStub(args []string) {
+	address := ":8081"
+	if len(args) > 0 {
+		address = args[0]
+	}
+
+	slog.Info("Starting people info stub", "address", address)
+	if err := http.ListenAndServe(address, peopleinfo.NewStub(peopleinfo.StubPeople)); err != nil {
+		logging.Fatal("Failed to run people info stub", "error", err)
+	}
+}
+
+// runOIDCMock handles the "oidc-mock [address]" command:
+// it serves the mock OpenID Connect provider on the address, :8082 by default,
+// for the client configured in OIDC_CLIENT_ID and OIDC_CLIENT_SECRET
+func runOIDCMock(args []string) {
+	address := ":8082"
+	if len(args) > 0 {
+		address = args[0]
+	}
+
+	config, err := oidc.ConfigFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to configure OpenID Connect login", "error", err)
+	}
+	mock, err := oidc.NewMock(oidc.MockClient{ID: config.ClientID, Secret: config.ClientSecret}, oidc.MockIdentities)
+	if err != nil {
+		logging.Fatal("Failed to create OIDC mock", "error", err)
+	}
+
+	slog.Info("Starting OIDC mock", "address", address, "client_id", config.ClientID)
+	if err := http.ListenAndServe(address, mock); err != nil {
+		logging.Fatal("Failed to run OIDC mock", "error", err)
+	}
+}
+
+const passportKeysUsage = "usage: time-tracker passport-keys rotate [--all] | decrypt"
+
+// runPassportKeys handles the "passport-keys" command:
+//
+//	passport-keys rotate [--all]  encrypts the passports under the current key (PASSPORT_KEY_ID),
+//	                              --all also re-encrypts the ones already under it, e.g. for a new index key
+//	passport-keys decrypt         stores the passports in plain text before reverting the encryption migration
+func runPassportKeys(args []string) {
+	if len(args) == 0 {
+		usage(passportKeysUsage)
+	}
+
+	keys, err := encryption.KeyringFromEnv("PASSPORT")
+	if err != nil {
+		logging.Fatal("Failed to load passport encryption keys", "error", err)
+	}
+
+	database.Connect()
+	ctx := repository.WithSystem(context.Background())
+
+	switch {
+	case args[0] == "rotate" && len(args) <= 2:
+		all := len(args) == 2
+		if all && args[1] != "--all" {
+			usage(passportKeysUsage)
+		}
+		updated, err := repository.EncryptPassports(ctx, database.DB, keys, all)
+		fmt.Printf("re-encrypted passports of %d users under key %q\n", updated, keys.CurrentKeyID())
+		if err != nil {
+			logging.Fatal("Failed to rotate passport keys", "error", err)
+		}
+	case args[0] == "decrypt" && len(args) == 1:
+		updated, err := repository.DecryptPassports(ctx, database.DB, keys)
+		fmt.Printf("decrypted passports of %d users\n", updated)
+		if err != nil {
+			logging.Fatal("Failed to decrypt passports", "error", err)
+		}
+	default:
+		usage(passportKeysUsage)
+	}
+}
+
+const auditUsage = "usage: time-tracker audit verify"
+
+// runAudit handles the "audit" command:
+//
+//	audit verify  walks the hash chains of the audit log and of the task revisions of every organization
+//	              and reports the first broken link or the head of the chain, it exits with status 1 if a chain is broken
+func runAudit(args []string) {
+	if len(args) != 1 || args[0] != "verify" {
+		usage(auditUsage)
+	}
+
+	database.Connect()
+	chains, err := repository.NewPostgres(database.DB, nil).Audit.Verify(repository.WithSystem(context.Background()))
+	if err != nil {
+		logging.Fatal("Failed to verify audit log", "error", err)
+	}
+
+	broken := false
+	for _, chain := range chains {
+		if chain.Valid {
+			fmt.Printf("%-15s organization %d: ok, %d records, head %s\n", chain.Chain, chain.OrganizationID, chain.Checked, chain.Head)
+			continue
+		}
+		broken = true
+		fmt.Printf("%-15s organization %d: broken at record %d after %d valid records: %s\n",
+			chain.Chain, chain.OrganizationID, chain.BrokenID, chain.Checked, chain.Reason)
+	}
+	if broken {
+		os.Exit(1)
+	}
+}
+
+const apiKeysUsage = "usage: time-tracker api-keys create <name> [organization-id] | list | revoke <id>"
+
+// runAPIKeys handles the "api-keys" command, e.g. to create the first key:
+//
+//	api-keys create <name> [organization-id]  creates an API key with the admin role of the organization,
+//	                                          the default one if not given, and prints it, it is not shown again
+//	api-keys list                             lists the API keys of all organizations
+//	api-keys revoke <id>                      revokes the API key
+func runAPIKeys(args []string) {
+	if len(args) == 0 {
+		usage(apiKeysUsage)
+	}
+
+	database.Connect()
+	repos := repository.NewPostgres(database.DB, nil)
+	keys := repos.APIKeys
+	ctx := repository.WithSystem(context.Background())
+
+	switch {
+	case args[0] == "create" && (len(args) == 2 || len(args) == 3):
+		organizationID := uint64(models.DefaultOrganizationID)
+		if len(args) == 3 {
+			var err error
+			if organizationID, err = strconv.ParseUint(args[2], 10, 0); err != nil {
+				usage(apiKeysUsage)
+			}
+		}
+		organization, err := repos.Organizations.GetByID(ctx, uint(organizationID))
+		if err != nil {
+			logging.Fatal("Failed to find organization", "id", organizationID, "error", err)
+		}
+		apiKey, key, err := auth.CreateAPIKey(repository.WithOrganization(ctx, organization.ID), keys, args[1])
+		if err != nil {
+			logging.Fatal("Failed to create API key", "error", err)
+		}
+		fmt.Printf("created API key %d %q of organization %q, send it in the %s header:\n%s\n",
+			apiKey.ID, apiKey.Name, organization.Name, auth.APIKeyHeader, key)
+	case args[0] == "list" && len(args) == 1:
+		list, err := keys.List(ctx)
+		if err != nil {
+			logging.Fatal("Failed to list API keys", "error", err)
+		}
+		for _, apiKey := range list {
+			status := "active"
+			if apiKey.RevokedAt != nil {
+				status = "revoked " + apiKey.RevokedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%-5d %-12s %-30s organization %-5d %s\n", apiKey.ID, apiKey.Prefix+"…", apiKey.Name, apiKey.OrganizationID, status)
+		}
+	case args[0] == "revoke" && len(args) == 2:
+		id, err := strconv.ParseUint(args[1], 10, 0)
+		if err != nil {
+			usage(apiKeysUsage)
+		}
+		apiKey, err := keys.Revoke(ctx, uint(id))
+		if err != nil {
+			logging.Fatal("Failed to revoke API key", "id", id, "error", err)
+		}
+		fmt.Printf("revoked API key %d %q\n", apiKey.ID, apiKey.Name)
+	default:
+		usage(apiKeysUsage)
+	}
+}
+
+const organizationsUsage = "usage: time-tracker organizations create <name> | list"
+
+// runOrganizations handles the "organizations" command:
+//
+//	organizations create <name>  creates an organization, then create its first API key with api-keys create
+//	organizations list           lists the organizations
+func runOrganizations(args []string) {
+	if len(args) == 0 {
+		usage(organizationsUsage)
+	}
+
+	database.Connect()
+	organizations := repository.NewPostgres(database.DB, nil).Organizations
+	ctx := repository.WithSystem(context.Background())
+
+	switch {
+	case args[0] == "create" && len(args) == 2:
+		organization := models.Organization{Name: args[1]}
+		if err := organizations.Create(ctx, &organization); err != nil {
+			logging.Fatal("Failed to create organization", "error", err)
+		}
+		fmt.Printf("created organization %d %q\n", organization.ID, organization.Name)
+	case args[0] == "list" && len(args) == 1:
+		list, err := organizations.List(ctx)
+		if err != nil {
+			logging.Fatal("Failed to list organizations", "error", err)
+		}
+		for _, organization := range list {
+			fmt.Printf("%-5d %s\n", organization.ID, organization.Name)
+		}
+	default:
+		usage(organizationsUsage)
+	}
+}
@@ -1,15 +1,18 @@
 package database
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
-	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/logging"
+	"github.com/ananikitina/time-tracker/repository"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
@@ -18,7 +21,7 @@ func Connect() {
 	// Load environment variables from .env file
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		logging.Fatal("Error loading .env file", "error", err)
 	}
 
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=%s",
@@ -27,30 +30,33 @@ func Connect() {
 		os.Getenv("DB_PORT"), os.Getenv("DB_TIMEZONE"))
 
 	// Open a connection to the PostgreSQL database
-	log.Printf("Connecting to PostgreSQL database at %s", os.Getenv("DB_HOST"))
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	slog.Info("Connecting to PostgreSQL database", "host", os.Getenv("DB_HOST"))
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		TranslateError: true,
+		Logger:         logging.NewGormLogger(logger.Info),
+	})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
 
 	// Assign the opened database to the global variable DB
 	DB = db
 
-	// Automatically migrate the database schema for User and Task models
-	err = db.AutoMigrate(&models.User{}, &models.Task{})
-	if err != nil {
-		log.Fatalf("Failed to migrate database schema: %v", err)
-	}
-
-	log.Println("Connected to PostgreSQL database successfully")
+	slog.Info("Connected to PostgreSQL database")
 }
 
+// Migrate applies all pending migrations
 func Migrate() {
-	log.Println("Starting database migration")
+	slog.Info("Starting database migration")
+
+	migrations, err := Migrations()
+	if err != nil {
+		logging.Fatal("Failed to load migrations", "error", err)
+	}
 
-	err := DB.AutoMigrate(&models.User{}, &models.Task{})
+	applied, err := NewMigrator(DB, migrations).Up(repository.WithSystem(context.Background()))
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		logging.Fatal("Failed to migrate database", "error", err)
 	}
-	log.Println("Database migration completed")
+	slog.Info("Database migration completed", "applied", len(applied))
 }
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the key of the advisory lock taken while migrating,
+// so that several instances of the service don't migrate at the same time
+const migrationLockID = 7264519803
+
+// migrationFileName matches names like 0001_create_users.up.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change with the SQL to apply and to revert it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied and when
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of the migration history table
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations returns the migrations shipped with the service ordered by version
+func Migrations() ([]Migration, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return LoadMigrations(sub)
+}
+
+// LoadMigrations reads NNNN_name.up.sql and NNNN_name.down.sql files
+// from the root of fsys. Every version must have both files.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations, keeping the history in schema_migrations
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Up applies all pending migrations in order and returns the applied ones
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureHistoryTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range m.migrations {
+		done, err := m.apply(ctx, migration)
+		if err != nil {
+			return applied, err
+		}
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// Down reverts the last steps applied migrations and returns the reverted ones
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if err := m.ensureHistoryTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for len(reverted) < steps {
+		migration, done, err := m.revertLast(ctx)
+		if err != nil {
+			return reverted, err
+		}
+		if !done {
+			break
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// Status returns every known migration with the time it was applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureHistoryTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var history []schemaMigration
+	if err := m.db.WithContext(ctx).Find(&history).Error; err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int64]time.Time, len(history))
+	for _, row := range history {
+		appliedAt[row.Version] = row.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) ensureHistoryTable(ctx context.Context) error {
+	return m.db.WithContext(ctx).Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`).Error
+}
+
+// apply runs the migration and records it in one transaction.
+// It returns false if the migration has already been applied.
+func (m *Migrator) apply(ctx context.Context, migration Migration) (bool, error) {
+	applied := false
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&schemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		slog.InfoContext(ctx, "Applying migration", "version", migration.Version, "name", migration.Name)
+		if err := tx.Exec(migration.Up).Error; err != nil {
+			return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		applied = true
+		return tx.Create(&schemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+		}).Error
+	})
+	return applied, err
+}
+
+// revertLast reverts the latest applied migration and removes it from the history.
+// It returns false if there is nothing to revert.
+func (m *Migrator) revertLast(ctx context.Context) (Migration, bool, error) {
+	var reverted Migration
+	done := false
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+			return err
+		}
+
+		var last schemaMigration
+		err := tx.Order("version DESC").First(&last).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		migration, ok := m.find(last.Version)
+		if !ok {
+			return fmt.Errorf("applied migration %d_%s is unknown to this version of the service", last.Version, last.Name)
+		}
+
+		slog.InfoContext(ctx, "Reverting migration", "version", migration.Version, "name", migration.Name)
+		if err := tx.Exec(migration.Down).Error; err != nil {
+			return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		reverted, done = migration, true
+		return tx.Delete(&schemaMigration{}, last.Version).Error
+	})
+	return reverted, done, err
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS users (
+    id              BIGSERIAL PRIMARY KEY,
+    passport_number TEXT NOT NULL,
+    surname         TEXT,
+    name            TEXT,
+    patronymic      TEXT,
+    address         TEXT,
+    CONSTRAINT uni_users_passport_number UNIQUE (passport_number)
+);
+
+CREATE TABLE IF NOT EXISTS tasks (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL,
+    task_name  TEXT NOT NULL,
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time   TIMESTAMPTZ DEFAULT NULL
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_tasks_user_id_start_time;
+
+ALTER TABLE tasks DROP COLUMN IF EXISTS tags;
+ALTER TABLE tasks DROP COLUMN IF EXISTS project;
+ALTER TABLE tasks DROP COLUMN IF EXISTS description;
@@ -0,0 +1,5 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS project TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS tags JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_user_id_start_time ON tasks (user_id, start_time);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS uni_tasks_active_user_id;
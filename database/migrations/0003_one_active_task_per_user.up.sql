@@ -0,0 +1,14 @@
+-- Closing all but the latest running task of every user at the start of the latest one
+UPDATE tasks AS t
+SET end_time = GREATEST(t.start_time, latest.start_time)
+FROM (
+    SELECT DISTINCT ON (user_id) id, user_id, start_time
+    FROM tasks
+    WHERE end_time IS NULL
+    ORDER BY user_id, start_time DESC, id DESC
+) AS latest
+WHERE t.user_id = latest.user_id
+  AND t.end_time IS NULL
+  AND t.id <> latest.id;
+
+CREATE UNIQUE INDEX uni_tasks_active_user_id ON tasks (user_id) WHERE end_time IS NULL;
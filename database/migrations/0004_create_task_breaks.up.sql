@@ -0,0 +1,10 @@
+CREATE TABLE task_breaks (
+    id         BIGSERIAL PRIMARY KEY,
+    task_id    BIGINT NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time   TIMESTAMPTZ DEFAULT NULL,
+    CONSTRAINT chk_task_breaks_end_time CHECK (end_time IS NULL OR end_time >= start_time)
+);
+
+CREATE INDEX idx_task_breaks_task_id ON task_breaks (task_id);
+CREATE UNIQUE INDEX uni_task_breaks_active_task_id ON task_breaks (task_id) WHERE end_time IS NULL;
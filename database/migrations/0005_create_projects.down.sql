@@ -0,0 +1,11 @@
+ALTER TABLE tasks ADD COLUMN project TEXT NOT NULL DEFAULT '';
+
+UPDATE tasks
+SET project = projects.name
+FROM projects
+WHERE tasks.project_id = projects.id;
+
+DROP INDEX IF EXISTS idx_tasks_project_id;
+ALTER TABLE tasks DROP COLUMN project_id;
+
+DROP TABLE IF EXISTS projects;
@@ -0,0 +1,27 @@
+CREATE TABLE projects (
+    id       BIGSERIAL PRIMARY KEY,
+    name     TEXT NOT NULL,
+    client   TEXT NOT NULL DEFAULT '',
+    color    TEXT NOT NULL DEFAULT '',
+    archived BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE UNIQUE INDEX uni_projects_name ON projects (lower(name));
+
+-- Turning the free-form project names of tasks into projects
+INSERT INTO projects (name)
+SELECT DISTINCT ON (lower(project)) project
+FROM tasks
+WHERE project <> ''
+ORDER BY lower(project), project;
+
+ALTER TABLE tasks ADD COLUMN project_id BIGINT REFERENCES projects (id) ON DELETE SET NULL;
+
+UPDATE tasks
+SET project_id = projects.id
+FROM projects
+WHERE lower(tasks.project) = lower(projects.name);
+
+ALTER TABLE tasks DROP COLUMN project;
+
+CREATE INDEX idx_tasks_project_id ON tasks (project_id);
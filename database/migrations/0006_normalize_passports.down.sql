@@ -0,0 +1,7 @@
+ALTER TABLE users DROP CONSTRAINT chk_users_passport;
+ALTER TABLE users DROP CONSTRAINT uni_users_passport;
+
+UPDATE users SET passport_number = passport_series || ' ' || passport_number;
+
+ALTER TABLE users DROP COLUMN passport_series;
+ALTER TABLE users ADD CONSTRAINT uni_users_passport_number UNIQUE (passport_number);
@@ -0,0 +1,37 @@
+-- Passports are stored as a series of 4 digits and a number of 6 digits,
+-- so that differently written passports of the same person collide
+DO $$
+DECLARE
+    invalid    BIGINT;
+    duplicates BIGINT;
+BEGIN
+    SELECT count(*) INTO invalid
+    FROM users
+    WHERE regexp_replace(passport_number, '[\s-]', '', 'g') !~ '^[0-9]{10}$';
+    IF invalid > 0 THEN
+        RAISE EXCEPTION '% users have a passport other than 4 digits of series and 6 digits of number, fix them before migrating', invalid;
+    END IF;
+
+    SELECT count(*) INTO duplicates
+    FROM (
+        SELECT 1
+        FROM users
+        GROUP BY regexp_replace(passport_number, '[\s-]', '', 'g')
+        HAVING count(*) > 1
+    ) AS passports;
+    IF duplicates > 0 THEN
+        RAISE EXCEPTION '% passports are shared by several users once normalized, merge the users before migrating', duplicates;
+    END IF;
+END $$;
+
+ALTER TABLE users DROP CONSTRAINT uni_users_passport_number;
+ALTER TABLE users ADD COLUMN passport_series TEXT;
+
+UPDATE users
+SET passport_series = substr(regexp_replace(passport_number, '[\s-]', '', 'g'), 1, 4),
+    passport_number = substr(regexp_replace(passport_number, '[\s-]', '', 'g'), 5, 6);
+
+ALTER TABLE users ALTER COLUMN passport_series SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT uni_users_passport UNIQUE (passport_series, passport_number);
+ALTER TABLE users ADD CONSTRAINT chk_users_passport
+    CHECK (passport_series ~ '^[0-9]{4}$' AND passport_number ~ '^[0-9]{6}$');
@@ -0,0 +1,18 @@
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM users WHERE passport_series IS NULL OR passport_number IS NULL) THEN
+        RAISE EXCEPTION 'some passports are stored only encrypted, run "passport-keys decrypt" before reverting';
+    END IF;
+END $$;
+
+ALTER TABLE users DROP CONSTRAINT chk_users_passport_stored;
+ALTER TABLE users DROP CONSTRAINT uni_users_passport_index;
+
+ALTER TABLE users
+    ALTER COLUMN passport_series SET NOT NULL,
+    ALTER COLUMN passport_number SET NOT NULL;
+
+ALTER TABLE users
+    DROP COLUMN passport_ciphertext,
+    DROP COLUMN passport_key_id,
+    DROP COLUMN passport_index;
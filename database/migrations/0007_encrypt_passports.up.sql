@@ -0,0 +1,16 @@
+-- Passports are encrypted by the service, it can't be done in SQL:
+-- the service encrypts the plain text passports on start and clears them
+ALTER TABLE users
+    ADD COLUMN passport_ciphertext BYTEA,
+    ADD COLUMN passport_key_id     TEXT,
+    ADD COLUMN passport_index      TEXT;
+
+ALTER TABLE users
+    ALTER COLUMN passport_series DROP NOT NULL,
+    ALTER COLUMN passport_number DROP NOT NULL;
+
+ALTER TABLE users ADD CONSTRAINT uni_users_passport_index UNIQUE (passport_index);
+ALTER TABLE users ADD CONSTRAINT chk_users_passport_stored CHECK (
+    (passport_ciphertext IS NOT NULL AND passport_key_id IS NOT NULL AND passport_index IS NOT NULL)
+    OR (passport_series IS NOT NULL AND passport_number IS NOT NULL)
+);
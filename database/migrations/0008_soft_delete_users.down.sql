@@ -0,0 +1,19 @@
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS fk_tasks_user;
+
+-- Without soft delete, deleted users would come back: they are removed for good, their tasks stay as before
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+-- Archived tasks go back to the tasks table
+INSERT INTO tasks (id, user_id, task_name, description, project_id, tags, start_time, end_time)
+SELECT id, user_id, task_name, description, project_id, tags, start_time, end_time
+FROM archived_tasks;
+
+INSERT INTO task_breaks (task_id, start_time, end_time)
+SELECT archived_tasks.id, task_break.start_time, task_break.end_time
+FROM archived_tasks,
+     jsonb_to_recordset(archived_tasks.breaks) AS task_break (start_time TIMESTAMPTZ, end_time TIMESTAMPTZ);
+
+DROP TABLE IF EXISTS archived_tasks;
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
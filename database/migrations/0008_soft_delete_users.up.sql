@@ -0,0 +1,37 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+-- Tasks of purged users, kept for the record with their breaks
+CREATE TABLE archived_tasks (
+    id          BIGINT PRIMARY KEY,
+    user_id     BIGINT NOT NULL,
+    task_name   TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    project_id  BIGINT REFERENCES projects (id) ON DELETE SET NULL,
+    tags        JSONB,
+    start_time  TIMESTAMPTZ NOT NULL,
+    end_time    TIMESTAMPTZ,
+    breaks      JSONB NOT NULL DEFAULT '[]',
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_archived_tasks_user_id ON archived_tasks (user_id);
+
+-- Tasks of the users deleted before the foreign key existed are archived
+INSERT INTO archived_tasks (id, user_id, task_name, description, project_id, tags, start_time, end_time, breaks)
+SELECT tasks.id, tasks.user_id, tasks.task_name, tasks.description, tasks.project_id, tasks.tags,
+       tasks.start_time, tasks.end_time,
+       COALESCE((SELECT jsonb_agg(jsonb_build_object('start_time', task_breaks.start_time, 'end_time', task_breaks.end_time)
+                                  ORDER BY task_breaks.start_time)
+                 FROM task_breaks
+                 WHERE task_breaks.task_id = tasks.id), '[]')
+FROM tasks
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE users.id = tasks.user_id);
+
+DELETE FROM tasks
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE users.id = tasks.user_id);
+
+-- Users are purged only together with their tasks, the repository applies the purge policy
+ALTER TABLE tasks
+    ADD CONSTRAINT fk_tasks_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE RESTRICT;
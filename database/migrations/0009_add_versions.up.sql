@@ -0,0 +1,3 @@
+-- Versions of users and tasks for optimistic concurrency control, incremented on every change
+ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE tasks ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
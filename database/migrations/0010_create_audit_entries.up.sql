@@ -0,0 +1,26 @@
+-- Audit log of the changes to users and tasks
+CREATE TABLE audit_entries (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    actor       TEXT NOT NULL,
+    action      TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id   BIGINT NOT NULL,
+    changes     JSONB NOT NULL DEFAULT '{}',
+    request_id  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_audit_entries_entity ON audit_entries (entity_type, entity_id);
+CREATE INDEX idx_audit_entries_actor ON audit_entries (actor);
+CREATE INDEX idx_audit_entries_created_at ON audit_entries (created_at);
+
+-- The audit log is append-only
+CREATE FUNCTION audit_entries_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_entries is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_audit_entries_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_entries
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_entries_append_only();
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS task_revisions;
+DROP FUNCTION IF EXISTS task_revisions_append_only();
+
+ALTER TABLE audit_entries DROP COLUMN IF EXISTS hash;
+ALTER TABLE audit_entries DROP COLUMN IF EXISTS prev_hash;
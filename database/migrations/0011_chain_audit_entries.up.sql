@@ -0,0 +1,28 @@
+-- Every audit entry is chained to the previous one by a SHA-256 hash.
+-- Entries recorded before there were hashes are left out of the chain, the table is append-only.
+ALTER TABLE audit_entries ADD COLUMN prev_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_entries ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+
+-- States of the finished tasks, chained the same way
+CREATE TABLE task_revisions (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    task_id    BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    deleted    BOOLEAN NOT NULL DEFAULT FALSE,
+    task       JSONB NOT NULL,
+    prev_hash  TEXT NOT NULL DEFAULT '',
+    hash       TEXT NOT NULL
+);
+
+CREATE INDEX idx_task_revisions_task_id ON task_revisions (task_id);
+
+CREATE FUNCTION task_revisions_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'task_revisions is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_task_revisions_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON task_revisions
+    FOR EACH STATEMENT EXECUTE FUNCTION task_revisions_append_only();
@@ -0,0 +1,9 @@
+-- API keys, only their SHA-256 hashes are stored
+CREATE TABLE api_keys (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT NOT NULL,
+    prefix     TEXT NOT NULL,
+    hash       TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS manager_id,
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,6 @@
+-- Roles of the users and the teams of the managers
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'employee' CHECK (role IN ('admin', 'manager', 'employee')),
+    ADD COLUMN manager_id BIGINT REFERENCES users (id) ON DELETE SET NULL CHECK (manager_id <> id);
+
+CREATE INDEX idx_users_manager_id ON users (manager_id);
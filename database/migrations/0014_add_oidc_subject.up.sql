@@ -0,0 +1,2 @@
+-- Users logging in with the identity provider are found by its subject
+ALTER TABLE users ADD COLUMN oidc_subject TEXT UNIQUE;
@@ -0,0 +1,15 @@
+-- Personal access tokens of the users, only their SHA-256 hashes are stored
+CREATE TABLE personal_access_tokens (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL,
+    hash         TEXT NOT NULL UNIQUE,
+    scopes       JSONB NOT NULL DEFAULT '[]',
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS uni_projects_name;
+CREATE UNIQUE INDEX uni_projects_name ON projects (lower(name));
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS uni_users_passport;
+ALTER TABLE users ADD CONSTRAINT uni_users_passport UNIQUE (passport_series, passport_number);
+ALTER TABLE users DROP CONSTRAINT IF EXISTS uni_users_passport_index;
+ALTER TABLE users ADD CONSTRAINT uni_users_passport_index UNIQUE (passport_index);
+
+ALTER TABLE audit_entries DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE projects DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,32 @@
+-- Organizations are the tenants of the service, the existing data belongs to the default one
+CREATE TABLE organizations (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO organizations (id, name) VALUES (1, 'Default');
+SELECT setval('organizations_id_seq', 1);
+
+-- Tasks, their revisions and the personal access tokens belong to the organization of their user
+ALTER TABLE users ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE projects ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE api_keys ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE audit_entries ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations (id);
+
+ALTER TABLE users ALTER COLUMN organization_id DROP DEFAULT;
+ALTER TABLE projects ALTER COLUMN organization_id DROP DEFAULT;
+ALTER TABLE api_keys ALTER COLUMN organization_id DROP DEFAULT;
+ALTER TABLE audit_entries ALTER COLUMN organization_id DROP DEFAULT;
+
+CREATE INDEX idx_api_keys_organization_id ON api_keys (organization_id);
+CREATE INDEX idx_audit_entries_organization_id ON audit_entries (organization_id);
+
+-- Passports and project names are unique within an organization
+ALTER TABLE users DROP CONSTRAINT uni_users_passport_index;
+ALTER TABLE users ADD CONSTRAINT uni_users_passport_index UNIQUE (organization_id, passport_index);
+ALTER TABLE users DROP CONSTRAINT uni_users_passport;
+ALTER TABLE users ADD CONSTRAINT uni_users_passport UNIQUE (organization_id, passport_series, passport_number);
+
+DROP INDEX uni_projects_name;
+CREATE UNIQUE INDEX uni_projects_name ON projects (organization_id, lower(name));
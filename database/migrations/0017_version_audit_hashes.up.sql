@@ -0,0 +1,3 @@
+-- The organization is part of the hash of the new audit entries, the existing ones
+-- keep the version of their hashed content which leaves it out
+ALTER TABLE audit_entries ADD COLUMN hash_version SMALLINT NOT NULL DEFAULT 1;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_task_revisions_organization_id;
+DROP INDEX IF EXISTS idx_audit_entries_organization_id;
+CREATE INDEX idx_audit_entries_organization_id ON audit_entries (organization_id);
+
+ALTER TABLE task_revisions DROP COLUMN IF EXISTS hash_version;
+ALTER TABLE task_revisions DROP COLUMN IF EXISTS organization_id;
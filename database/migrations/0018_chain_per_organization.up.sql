@@ -0,0 +1,10 @@
+-- Every organization has its own hash chains, the existing records are the chains of the default one.
+-- The organization is part of the hash of the new task revisions, the existing ones
+-- keep the version of their hashed content which leaves it out.
+ALTER TABLE task_revisions ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE task_revisions ALTER COLUMN organization_id DROP DEFAULT;
+ALTER TABLE task_revisions ADD COLUMN hash_version SMALLINT NOT NULL DEFAULT 1;
+
+DROP INDEX IF EXISTS idx_audit_entries_organization_id;
+CREATE INDEX idx_audit_entries_organization_id ON audit_entries (organization_id, id);
+CREATE INDEX idx_task_revisions_organization_id ON task_revisions (organization_id, id);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS uni_users_oidc_subject;
+ALTER TABLE users ADD CONSTRAINT users_oidc_subject_key UNIQUE (oidc_subject);
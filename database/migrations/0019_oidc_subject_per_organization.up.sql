@@ -0,0 +1,3 @@
+-- Identity provider subjects are unique within an organization
+ALTER TABLE users DROP CONSTRAINT users_oidc_subject_key;
+ALTER TABLE users ADD CONSTRAINT uni_users_oidc_subject UNIQUE (organization_id, oidc_subject);
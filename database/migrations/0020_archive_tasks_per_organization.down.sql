@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_archived_tasks_organization_id;
+ALTER TABLE archived_tasks DROP COLUMN IF EXISTS organization_id;
@@ -0,0 +1,6 @@
+-- Archived tasks keep the organization of their purged user,
+-- the ones archived before belong to the default organization
+ALTER TABLE archived_tasks ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE archived_tasks ALTER COLUMN organization_id DROP DEFAULT;
+
+CREATE INDEX idx_archived_tasks_organization_id ON archived_tasks (organization_id);
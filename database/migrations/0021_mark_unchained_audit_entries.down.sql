@@ -0,0 +1,3 @@
+ALTER TABLE audit_entries DISABLE TRIGGER trg_audit_entries_append_only;
+UPDATE audit_entries SET hash_version = 1 WHERE hash_version = 0;
+ALTER TABLE audit_entries ENABLE TRIGGER trg_audit_entries_append_only;
@@ -0,0 +1,10 @@
+-- The audit entries recorded before the chain existed (migration 0011) get hash version 0.
+-- They are the only records the verification leaves out, any later record without a hash breaks the chain.
+ALTER TABLE audit_entries DISABLE TRIGGER trg_audit_entries_append_only;
+
+UPDATE audit_entries SET hash_version = 0
+WHERE hash = '' AND NOT EXISTS (
+    SELECT 1 FROM audit_entries chained WHERE chained.hash <> '' AND chained.id < audit_entries.id
+);
+
+ALTER TABLE audit_entries ENABLE TRIGGER trg_audit_entries_append_only;
@@ -0,0 +1,143 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown encryption key")
+	ErrDecrypt    = errors.New("failed to decrypt value")
+)
+
+// Keyring encrypts values with AES-256-GCM under the current key and decrypts them
+// under any key it knows, so that values encrypted before a key rotation can be read.
+// It also computes blind indexes: keyed hashes that allow exact-match search on encrypted values.
+type Keyring struct {
+	keys     map[string]cipher.AEAD
+	current  string
+	indexKey []byte
+}
+
+// NewKeyring creates a keyring from 32 byte encryption keys by ID, the ID of the key
+// to encrypt with and a blind index key of at least 32 bytes
+func NewKeyring(keys map[string][]byte, current string, indexKey []byte) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]cipher.AEAD, len(keys)), current: current, indexKey: indexKey}
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ":,") {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes long, got %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if keyring.keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := keyring.keys[current]; !ok {
+		return nil, fmt.Errorf("current key %q: %w", current, ErrUnknownKey)
+	}
+	if len(indexKey) < 32 {
+		return nil, fmt.Errorf("index key must be at least 32 bytes long, got %d", len(indexKey))
+	}
+	return keyring, nil
+}
+
+// KeyringFromEnv creates a keyring from the environment variables:
+//
+//	<prefix>_KEYS       comma separated id:key pairs, keys are base64 encoded
+//	<prefix>_KEY_ID     ID of the key to encrypt with, the last listed key by default
+//	<prefix>_INDEX_KEY  base64 encoded blind index key
+func KeyringFromEnv(prefix string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+	current := os.Getenv(prefix + "_KEY_ID")
+	for _, pair := range strings.Split(os.Getenv(prefix+"_KEYS"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s_KEYS: expected id:key pairs", prefix)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%s_KEYS: key %q is not base64: %w", prefix, id, err)
+		}
+		keys[id] = key
+		if os.Getenv(prefix+"_KEY_ID") == "" {
+			current = id
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s_KEYS is not set", prefix)
+	}
+
+	if os.Getenv(prefix+"_INDEX_KEY") == "" {
+		return nil, fmt.Errorf("%s_INDEX_KEY is not set", prefix)
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(os.Getenv(prefix + "_INDEX_KEY"))
+	if err != nil {
+		return nil, fmt.Errorf("%s_INDEX_KEY is not base64: %w", prefix, err)
+	}
+
+	keyring, err := NewKeyring(keys, current, indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s keys: %w", prefix, err)
+	}
+	return keyring, nil
+}
+
+// CurrentKeyID returns the ID of the key new values are encrypted with
+func (k *Keyring) CurrentKeyID() string {
+	return k.current
+}
+
+// Encrypt encrypts the plaintext under the current key. The additional data is authenticated
+// but not encrypted, the same data must be given to decrypt the value.
+func (k *Keyring) Encrypt(plaintext, additionalData []byte) (keyID string, ciphertext []byte, err error) {
+	aead := k.keys[k.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return k.current, aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Decrypt decrypts the ciphertext encrypted under the key with the ID
+func (k *Keyring) Decrypt(keyID string, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q: %w", keyID, ErrUnknownKey)
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// BlindIndex returns the hex encoded HMAC-SHA256 of the value under the index key
+func (k *Keyring) BlindIndex(value []byte) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write(value)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler serves the endpoints managing the API keys
+type APIKeyHandler struct {
+	keys repository.APIKeyRepository
+}
+
+func NewAPIKeyHandler(keys repository.APIKeyRepository) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// APIKeyRequest describes an API key to create
+type APIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+// CreatedAPIKey is a new API key together with the key itself, which is not shown again
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// @Summary Get API keys
+// @Description Get all API keys including the revoked ones, the keys themselves are not returned
+// @Tags api-keys
+// @Produce  json
+// @Success 200 {array} models.APIKey
+// @Failure 500 {object} ErrorResponse "Failed to fetch API keys"
+// @Router /api-keys [get]
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	keys, err := h.keys.List(c.Request.Context())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch API keys", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// @Summary Create an API key
+// @Description Create an API key, the key is returned only in this response
+// @Tags api-keys
+// @Accept  json
+// @Produce  json
+// @Param key body APIKeyRequest true "API key"
+// @Success 201 {object} CreatedAPIKey
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 500 {object} ErrorResponse "Failed to create API key"
+// @Router /api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": "name must not be blank"})
+		return
+	}
+
+	apiKey, key, err := auth.CreateAPIKey(c.Request.Context(), h.keys, req.Name)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create API key", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Created API key", "api_key_id", apiKey.ID, "name", apiKey.Name)
+	c.JSON(http.StatusCreated, CreatedAPIKey{APIKey: apiKey, Key: key})
+}
+
+// @Summary Revoke an API key
+// @Description Revoke an API key by ID, requests with it are rejected from now on
+// @Tags api-keys
+// @Produce  json
+// @Param id path string true "API key ID"
+// @Success 200 {object} models.APIKey
+// @Failure 400 {object} ErrorResponse "Invalid API key ID"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Failed to revoke API key"
+// @Router /api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	keyID, ok := parseID(c, "id", "Invalid API key ID")
+	if !ok {
+		return
+	}
+
+	key, err := h.keys.Revoke(c.Request.Context(), keyID)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to revoke API key", "api_key_id", keyID, "error", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Revoked API key", "api_key_id", key.ID, "name", key.Name)
+	c.JSON(http.StatusOK, key)
+}
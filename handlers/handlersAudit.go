@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/logging"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// anonymousActor is the actor of the requests without a principal
+const anonymousActor = "anonymous"
+
+// auditRedactedFields are the fields whose values are not kept in the audit log, only the fact they changed
+var auditRedactedFields = []string{"passport_number"}
+
+// AuditHandler serves the audit log
+type AuditHandler struct {
+	audit repository.AuditRepository
+}
+
+func NewAuditHandler(audit repository.AuditRepository) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// @Summary Get the audit log
+// @Description Get the changes to users, tasks and personal access tokens from the newest, with filtering and pagination
+// @Tags audit
+// @Produce  json
+// @Param actor query string false "Actor"
+// @Param action query string false "Action" Enums(create, update, delete, restore, purge, start, finish, pause, resume, revoke)
+// @Param entity_type query string false "Entity type" Enums(user, task, personal_access_token)
+// @Param entity_id query int false "Entity ID"
+// @Param request_id query string false "Request ID"
+// @Param from query string false "Start of the period (RFC3339 format)"
+// @Param to query string false "End of the period, exclusive (RFC3339 format)"
+// @Param page query int false "Page number" default(1)
+// @Param pageSize query int false "Page size" default(50)
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} ErrorResponse "Invalid parameter"
+// @Failure 500 {object} ErrorResponse "Failed to fetch audit log"
+// @Router /audit [get]
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	filter := repository.AuditFilter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		EntityType: c.Query("entity_type"),
+		RequestID:  c.Query("request_id"),
+	}
+	if c.Query("entity_id") != "" {
+		entityID, ok := parseQueryID(c, "entity_id", "Invalid entity_id parameter")
+		if !ok {
+			return
+		}
+		filter.EntityID = entityID
+	}
+	for param, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(param); value != "" {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				slog.InfoContext(c.Request.Context(), "Invalid parameter", "param", param, "error", err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " parameter"})
+				return
+			}
+			*bound = at
+		}
+	}
+
+	// Pagination
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		slog.InfoContext(c.Request.Context(), "Invalid page parameter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page parameter"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if err != nil || pageSize < 1 || pageSize > 500 {
+		slog.InfoContext(c.Request.Context(), "Invalid pageSize parameter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pageSize parameter"})
+		return
+	}
+	filter.Offset = (page - 1) * pageSize
+	filter.Limit = pageSize
+
+	entries, err := h.audit.List(c.Request.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch audit log", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// ChainVerificationResponse is the result of verifying the hash chains
+type ChainVerificationResponse struct {
+	Valid  bool                       `json:"valid"`
+	Chains []models.ChainVerification `json:"chains"`
+}
+
+// @Summary Verify the audit log
+// @Description Walk the hash chains of the audit log and of the finished task revisions of the caller's organization
+// @Description and report the first broken link of each, i.e. the first record changed or removed afterwards.
+// @Description Each chain reports its head, the hash of its last record: keep it outside the database and compare it with the next
+// @Description verification, since a chain rewritten as a whole is valid again. The chains of all organizations are verified by the "audit verify" command.
+// @Tags audit
+// @Produce  json
+// @Success 200 {object} ChainVerificationResponse
+// @Failure 500 {object} ErrorResponse "Failed to verify audit log"
+// @Router /audit/verify [get]
+func (h *AuditHandler) VerifyAuditLog(c *gin.Context) {
+	chains, err := h.audit.Verify(c.Request.Context())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to verify audit log", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit log"})
+		return
+	}
+
+	response := ChainVerificationResponse{Valid: true, Chains: chains}
+	for _, chain := range chains {
+		if !chain.Valid {
+			slog.ErrorContext(c.Request.Context(), "Hash chain is broken",
+				"chain", chain.Chain, "broken_id", chain.BrokenID, "reason", chain.Reason)
+			response.Valid = false
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// actor returns who makes the request, the subject of its principal
+// followed by the personal access token if the request is made with one
+func actor(c *gin.Context) string {
+	principal, ok := auth.CurrentPrincipal(c)
+	if !ok {
+		return anonymousActor
+	}
+	if principal.TokenID != 0 {
+		return principal.Subject + "/token:" + strconv.FormatUint(uint64(principal.TokenID), 10)
+	}
+	return principal.Subject
+}
+
+// recordAudit adds the change of the entity from before to after to the audit log, nil if it didn't exist.
+// It is called in the transaction of the change with its context, so the change is rolled back if it can't be recorded.
+func recordAudit(ctx context.Context, c *gin.Context, audit repository.AuditRepository, action, entityType string, entityID uint, before, after interface{}) error {
+	changes, err := models.AuditDiff(before, after)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to compare audited values", "error", err)
+		changes = map[string]models.AuditChange{}
+	}
+	for _, name := range auditRedactedFields {
+		if change, ok := changes[name]; ok {
+			changes[name] = models.AuditChange{Before: redactAuditValue(change.Before), After: redactAuditValue(change.After)}
+		}
+	}
+
+	entry := models.AuditEntry{
+		Actor:      actor(c),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    changes,
+		RequestID:  logging.RequestID(c.Request.Context()),
+	}
+	if err := audit.Record(ctx, &entry); err != nil {
+		return fmt.Errorf("record audit entry: %w", err)
+	}
+	return nil
+}
+
+// recordRevision adds the state of the finished task, or its deletion, to the task's history.
+// Like recordAudit, it is called in the transaction of the change.
+func recordRevision(ctx context.Context, audit repository.AuditRepository, task models.Task, deleted bool) error {
+	revision, err := models.NewTaskRevision(task, deleted)
+	if err == nil {
+		err = audit.RecordRevision(ctx, &revision)
+	}
+	if err != nil {
+		return fmt.Errorf("record task revision: %w", err)
+	}
+	return nil
+}
+
+// redactAuditValue hides the value, a missing value stays missing
+func redactAuditValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return logging.Mask
+}
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeEntryRequest describes a time entry created by hand.
+// An entry without end_time is running.
+type TimeEntryRequest struct {
+	TaskDetails
+	StartTime time.Time  `json:"start_time" binding:"required"`
+	EndTime   *time.Time `json:"end_time"`
+}
+
+// TimeEntryPatch describes changes to a time entry, omitted fields are kept.
+// The end time can be set, but not removed. A project_id of 0 removes the project.
+type TimeEntryPatch struct {
+	Name        *string    `json:"name" binding:"omitempty,max=255"`
+	Description *string    `json:"description" binding:"omitempty,max=2000"`
+	ProjectID   *uint      `json:"project_id"`
+	Tags        []string   `json:"tags" binding:"max=20,dive,required,max=50"`
+	StartTime   *time.Time `json:"start_time"`
+	EndTime     *time.Time `json:"end_time"`
+}
+
+// @Summary Create a time entry
+// @Description Create a time entry with explicit start and end times for the user.
+// @Description The entry must not be in the future or overlap the user's other entries.
+// @Tags time entries
+// @Accept  json
+// @Produce  json
+// @Param userID path string true "User ID"
+// @Param entry body TimeEntryRequest true "Time entry"
+// @Success 201 {object} models.Task
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "Time entry overlaps another entry"
+// @Failure 500 {object} ErrorResponse "Failed to create time entry"
+// @Router /tasks/{userID}/entries [post]
+func (h *TaskHandler) CreateEntry(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
+
+	// Parsing JSON request body
+	var req TimeEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if !validateTaskDetails(c, &req.TaskDetails) || !h.checkProject(c, req.ProjectID) {
+		return
+	}
+
+	task := newTask(userID, req.TaskDetails, req.StartTime)
+	task.EndTime = req.EndTime
+	if !validateEntryPeriod(c, task, time.Now()) {
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Creating time entry", "task", task)
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		if err := h.tasks.CreateEntry(ctx, &task); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, c, h.audit, models.AuditCreate, models.AuditEntityTask, task.ID, nil, task); err != nil {
+			return err
+		}
+		if task.EndTime == nil {
+			return nil
+		}
+		return recordRevision(ctx, h.audit, task, false)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to create time entry", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, repository.ErrOverlap):
+			c.JSON(http.StatusConflict, gin.H{"error": "Time entry overlaps another entry"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create time entry"})
+		}
+		return
+	}
+
+	setETag(c, task.Version)
+	c.JSON(http.StatusCreated, gin.H{"task": task})
+}
+
+// @Summary Get a time entry
+// @Description Get the user's time entry with its breaks. The ETag header is the version of the entry,
+// @Description with If-None-Match an unchanged entry is not sent again.
+// @Tags time entries
+// @Produce  json
+// @Param userID path string true "User ID"
+// @Param taskID path string true "Time entry ID"
+// @Param If-None-Match header string false "ETag of the time entry the client has"
+// @Success 200 {object} models.Task
+// @Success 304 "Time entry not modified"
+// @Failure 400 {object} ErrorResponse "Invalid time entry ID"
+// @Failure 404 {object} ErrorResponse "Time entry not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch time entry"
+// @Router /tasks/{userID}/entries/{taskID} [get]
+func (h *TaskHandler) GetEntry(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
+	taskID, ok := parseID(c, "taskID", "Invalid time entry ID")
+	if !ok {
+		return
+	}
+
+	task, ok := h.findEntry(c, userID, taskID)
+	if !ok || notModified(c, task.Version) {
+		return
+	}
+
+	setETag(c, task.Version)
+	c.JSON(http.StatusOK, gin.H{"task": task})
+}
+
+// @Summary Update a time entry
+// @Description Change the details or the times of the user's time entry, omitted fields are kept.
+// @Description The entry must not be in the future or overlap the user's other entries.
+// @Tags time entries
+// @Accept  json
+// @Produce  json
+// @Param userID path string true "User ID"
+// @Param taskID path string true "Time entry ID"
+// @Param entry body TimeEntryPatch true "Changes"
+// @Param If-Match header string false "ETag of the time entry the change is based on"
+// @Success 200 {object} models.Task
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 404 {object} ErrorResponse "Time entry not found"
+// @Failure 409 {object} ErrorResponse "Time entry overlaps another entry"
+// @Failure 412 {object} ErrorResponse "Time entry has been changed"
+// @Failure 500 {object} ErrorResponse "Failed to update time entry"
+// @Router /tasks/{userID}/entries/{taskID} [patch]
+func (h *TaskHandler) UpdateEntry(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
+	taskID, ok := parseID(c, "taskID", "Invalid time entry ID")
+	if !ok {
+		return
+	}
+
+	// Parsing JSON request body
+	var req TimeEntryPatch
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	task, ok := h.findEntry(c, userID, taskID)
+	if !ok || !checkIfMatch(c, task.Version, "Time entry has been changed") {
+		return
+	}
+	before := task
+	before.Tags = slices.Clone(task.Tags)
+	before.Breaks = slices.Clone(task.Breaks)
+
+	// Applying the changes on top of the current entry
+	details := TaskDetails{Name: task.TaskName, Description: task.Description, ProjectID: task.ProjectID, Tags: task.Tags}
+	if req.Name != nil {
+		details.Name = *req.Name
+	}
+	if req.Description != nil {
+		details.Description = *req.Description
+	}
+	if req.ProjectID != nil {
+		details.ProjectID = req.ProjectID
+		if *req.ProjectID == 0 {
+			details.ProjectID = nil
+		}
+	}
+	if req.Tags != nil {
+		details.Tags = req.Tags
+	}
+	if !validateTaskDetails(c, &details) {
+		return
+	}
+	// The current project stays valid for the entry even after it is archived
+	if req.ProjectID != nil && details.ProjectID != nil && !h.checkProject(c, details.ProjectID) {
+		return
+	}
+
+	task.TaskName = details.Name
+	task.Description = details.Description
+	task.ProjectID = details.ProjectID
+	task.Tags = details.Tags
+	if req.StartTime != nil {
+		task.StartTime = *req.StartTime
+	}
+	if req.EndTime != nil {
+		task.EndTime = req.EndTime
+	}
+	if !validateEntryPeriod(c, task, time.Now()) {
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Updating time entry", "task_id", taskID, "task", task)
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		if err := h.tasks.UpdateEntry(ctx, &task); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, c, h.audit, models.AuditUpdate, models.AuditEntityTask, task.ID, before, task); err != nil {
+			return err
+		}
+		if task.EndTime == nil {
+			return nil
+		}
+		return recordRevision(ctx, h.audit, task, false)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to update time entry", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Time entry not found"})
+		case errors.Is(err, repository.ErrOverlap):
+			c.JSON(http.StatusConflict, gin.H{"error": "Time entry overlaps another entry"})
+		case errors.Is(err, repository.ErrVersionConflict):
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Time entry has been changed"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update time entry"})
+		}
+		return
+	}
+
+	setETag(c, task.Version)
+	c.JSON(http.StatusOK, gin.H{"task": task})
+}
+
+// @Summary Delete a time entry
+// @Description Delete the user's time entry with its breaks
+// @Tags time entries
+// @Accept  json
+// @Produce  json
+// @Param userID path string true "User ID"
+// @Param taskID path string true "Time entry ID"
+// @Param If-Match header string false "ETag of the time entry the deletion is based on"
+// @Success 200 {object} ErrorResponse "Time entry deleted successfully"
+// @Failure 404 {object} ErrorResponse "Time entry not found"
+// @Failure 412 {object} ErrorResponse "Time entry has been changed"
+// @Failure 500 {object} ErrorResponse "Failed to delete time entry"
+// @Router /tasks/{userID}/entries/{taskID} [delete]
+func (h *TaskHandler) DeleteEntry(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
+	taskID, ok := parseID(c, "taskID", "Invalid time entry ID")
+	if !ok {
+		return
+	}
+
+	task, ok := h.findEntry(c, userID, taskID)
+	if !ok || !checkIfMatch(c, task.Version, "Time entry has been changed") {
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Deleting time entry", "task_id", taskID)
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		if err := h.tasks.Delete(ctx, userID, taskID, task.Version); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, c, h.audit, models.AuditDelete, models.AuditEntityTask, taskID, task, nil); err != nil {
+			return err
+		}
+		if task.EndTime == nil {
+			return nil
+		}
+		return recordRevision(ctx, h.audit, task, true)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to delete time entry", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Time entry not found"})
+		case errors.Is(err, repository.ErrVersionConflict):
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Time entry has been changed"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete time entry"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Time entry deleted successfully"})
+}
+
+// @Summary Get the history of a time entry
+// @Description Get the revisions of the user's time entry from the oldest: its state every time it was finished or changed
+// @Description after that, and its deletion. The revisions are chained by hashes, see /audit/verify.
+// @Tags time entries
+// @Produce  json
+// @Param userID path string true "User ID"
+// @Param taskID path string true "Time entry ID"
+// @Success 200 {array} models.TaskRevision
+// @Failure 400 {object} ErrorResponse "Invalid time entry ID"
+// @Failure 500 {object} ErrorResponse "Failed to fetch time entry history"
+// @Router /tasks/{userID}/entries/{taskID}/revisions [get]
+func (h *TaskHandler) GetEntryRevisions(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
+	taskID, ok := parseID(c, "taskID", "Invalid time entry ID")
+	if !ok {
+		return
+	}
+
+	revisions, err := h.audit.ListRevisions(c.Request.Context(), userID, taskID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch time entry history", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch time entry history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// findEntry fetches the user's time entry.
+// It writes an error response and returns false if there is no such entry.
+func (h *TaskHandler) findEntry(c *gin.Context, userID, taskID uint) (models.Task, bool) {
+	task, err := h.tasks.Get(c.Request.Context(), userID, taskID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			slog.InfoContext(c.Request.Context(), "Time entry not found", "error", err)
+			c.JSON(http.StatusNotFound, gin.H{"error": "Time entry not found"})
+			return models.Task{}, false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch time entry", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch time entry"})
+		return models.Task{}, false
+	}
+	return task, true
+}
+
+// validateEntryPeriod checks the times of a time entry: it must end after it starts,
+// must not be in the future and must contain all its breaks.
+// It writes a 400 response and returns false if the times are invalid.
+func validateEntryPeriod(c *gin.Context, task models.Task, now time.Time) bool {
+	var problems []string
+
+	if task.StartTime.After(now) {
+		problems = append(problems, "start_time must not be in the future")
+	}
+	if task.EndTime != nil {
+		if !task.EndTime.After(task.StartTime) {
+			problems = append(problems, "end_time must be after start_time")
+		}
+		if task.EndTime.After(now) {
+			problems = append(problems, "end_time must not be in the future")
+		}
+	}
+	for _, taskBreak := range task.Breaks {
+		if taskBreak.StartTime.Before(task.StartTime) ||
+			(task.EndTime != nil && taskBreak.EndTime != nil && taskBreak.EndTime.After(*task.EndTime)) ||
+			(task.EndTime != nil && taskBreak.StartTime.After(*task.EndTime)) {
+			problems = append(problems, "breaks must be within the time entry")
+			break
+		}
+	}
+
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time entry", "details": strings.Join(problems, "; ")})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/logging"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/oidc"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginCookie keeps the login between the redirect to the identity provider and the callback
+const loginCookie = "oidc_login"
+
+// LoginHandler serves the login with the OpenID Connect identity provider
+type LoginHandler struct {
+	users         repository.UserRepository
+	audit         repository.AuditRepository
+	tx            repository.Transactor
+	provider      *oidc.Provider
+	authenticator *auth.Authenticator
+}
+
+func NewLoginHandler(users repository.UserRepository, audit repository.AuditRepository, tx repository.Transactor,
+	provider *oidc.Provider, authenticator *auth.Authenticator) *LoginHandler {
+	return &LoginHandler{users: users, audit: audit, tx: tx, provider: provider, authenticator: authenticator}
+}
+
+// LoginResponse is the bearer token issued to the user after logging in
+type LoginResponse struct {
+	Token     string      `json:"token"`
+	TokenType string      `json:"token_type" example:"Bearer"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	User      models.User `json:"user"`
+}
+
+// @Summary Log in
+// @Description Redirect to the identity provider to log in, it sends the user back to /auth/callback
+// @Tags auth
+// @Success 302 "Redirect to the identity provider"
+// @Failure 502 {object} ErrorResponse "Identity provider is unavailable"
+// @Router /auth/login [get]
+func (h *LoginHandler) Login(c *gin.Context) {
+	login, err := oidc.NewLogin()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to start login", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	target, err := h.provider.AuthCodeURL(c.Request.Context(), login)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Identity provider is unavailable", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+	sealed, err := h.provider.SealLogin(login, time.Now())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to start login", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	h.setLoginCookie(c, sealed, 600)
+	c.Redirect(http.StatusFound, target)
+}
+
+// @Summary Finish logging in
+// @Description The identity provider sends the user back here. The identity is matched to a user by its subject, then by the passport claim,
+// @Description and a new user is created if the service is configured to. The response is a bearer token for the API.
+// @Tags auth
+// @Produce  json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State of the login"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} ErrorResponse "Invalid login state"
+// @Failure 401 {object} ErrorResponse "Login failed"
+// @Failure 403 {object} ErrorResponse "No user for this identity, or the user with its passport can't be linked"
+// @Failure 409 {object} ErrorResponse "User with this passport number already exists"
+// @Failure 500 {object} ErrorResponse "Failed to log in"
+// @Failure 502 {object} ErrorResponse "Identity provider is unavailable"
+// @Router /auth/callback [get]
+func (h *LoginHandler) Callback(c *gin.Context) {
+	sealed, err := c.Cookie(loginCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state", "details": "login was not started"})
+		return
+	}
+	h.setLoginCookie(c, "", -1)
+	login, err := h.provider.OpenLogin(sealed, time.Now())
+	if err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid login state", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state", "details": err.Error()})
+		return
+	}
+	if c.Query("state") != login.State {
+		slog.WarnContext(c.Request.Context(), "Login state does not match")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state", "details": "state does not match"})
+		return
+	}
+	if reason := c.Query("error"); reason != "" {
+		slog.InfoContext(c.Request.Context(), "Identity provider refused the login", "error", reason)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed", "details": reason})
+		return
+	}
+
+	identity, err := h.provider.Exchange(c.Request.Context(), c.Query("code"), login)
+	if err != nil {
+		if errors.Is(err, oidc.ErrUnavailable) {
+			slog.ErrorContext(c.Request.Context(), "Identity provider is unavailable", "error", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+			return
+		}
+		slog.WarnContext(c.Request.Context(), "Login failed", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed"})
+		return
+	}
+	logging.AddAttrs(c.Request.Context(), slog.String("oidc_subject", identity.Subject))
+
+	user, ok := h.findUser(c, identity)
+	if !ok {
+		return
+	}
+
+	token, expiresAt, err := h.authenticator.IssueToken(user.ID, h.provider.Config().SessionTTL)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to issue token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "User logged in", "user_id", user.ID)
+	c.JSON(http.StatusOK, LoginResponse{Token: token, TokenType: "Bearer", ExpiresAt: expiresAt, User: user})
+}
+
+// findUser returns the user of the identity in the organization of the provider: the one linked to its subject,
+// the one with its passport, which is linked now if the service links users by the passport,
+// or a new one if the service creates users. It responds with an error if there is none.
+func (h *LoginHandler) findUser(c *gin.Context, identity oidc.Identity) (models.User, bool) {
+	ctx := repository.WithOrganization(c.Request.Context(), h.provider.Config().OrganizationID)
+	users, err := h.users.List(ctx, repository.UserFilter{OIDCSubject: identity.Subject, Limit: 1})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch user", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return models.User{}, false
+	}
+	if len(users) > 0 {
+		return users[0], true
+	}
+
+	var existing []models.User
+	if identity.Passport != "" && h.provider.Config().LinkByPassport {
+		if passport, err := models.ParsePassport(identity.Passport); err == nil {
+			existing, err = h.users.List(ctx, repository.UserFilter{Passport: &passport, Limit: 1})
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to fetch user", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+				return models.User{}, false
+			}
+		}
+	}
+
+	// Changes made on the first login are made by the user logging in
+	if len(existing) > 0 {
+		user := existing[0]
+		// Linking takes over the user, only employees not signing in another way are linked,
+		// managers and admins keep their access to their team or organization
+		if user.OIDCSubject != nil || user.Role != models.RoleEmployee {
+			slog.WarnContext(ctx, "Refused to link user to identity", "user_id", user.ID, "role", user.Role)
+			c.JSON(http.StatusForbidden, gin.H{"error": "The user with this passport can't be linked to this identity"})
+			return models.User{}, false
+		}
+		h.setPrincipal(c, user)
+		before := user
+		subject := identity.Subject
+		user.OIDCSubject = &subject
+		err := h.tx.Transaction(ctx, func(ctx context.Context) error {
+			if err := h.users.Update(ctx, &user); err != nil {
+				return err
+			}
+			return recordAudit(ctx, c, h.audit, models.AuditUpdate, models.AuditEntityUser, user.ID, before, user)
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to link user", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return models.User{}, false
+		}
+		slog.InfoContext(ctx, "User linked to identity", "user_id", user.ID)
+		return user, true
+	}
+
+	if !h.provider.Config().CreateUsers {
+		slog.InfoContext(ctx, "No user for identity")
+		c.JSON(http.StatusForbidden, gin.H{"error": "No user for this identity"})
+		return models.User{}, false
+	}
+	user, err := identity.User()
+	if err != nil {
+		slog.InfoContext(ctx, "Can't create user for identity", "error", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "No user for this identity", "details": err.Error()})
+		return models.User{}, false
+	}
+	err = h.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := h.users.Create(ctx, &user); err != nil {
+			return err
+		}
+		h.setPrincipal(c, user)
+		return recordAudit(ctx, c, h.audit, models.AuditCreate, models.AuditEntityUser, user.ID, nil, user)
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to save user", "error", err)
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "User with this passport number already exists"})
+			return models.User{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return models.User{}, false
+	}
+	slog.InfoContext(ctx, "User created on first login", "user_id", user.ID)
+	return user, true
+}
+
+// setPrincipal makes the user logging in the principal of the request
+func (h *LoginHandler) setPrincipal(c *gin.Context, user models.User) {
+	auth.SetPrincipal(c, auth.Principal{
+		Subject:        "user:" + strconv.FormatUint(uint64(user.ID), 10),
+		Method:         auth.MethodOIDC,
+		UserID:         user.ID,
+		Role:           user.Role,
+		OrganizationID: user.OrganizationID,
+	})
+}
+
+// setLoginCookie sets the login cookie, a negative maxAge removes it
+func (h *LoginHandler) setLoginCookie(c *gin.Context, value string, maxAge int) {
+	secure := strings.HasPrefix(h.provider.Config().RedirectURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(loginCookie, value, maxAge, "/auth", "", secure, true)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrganizationHandler serves the organization of the caller, organizations are created with the organizations command
+type OrganizationHandler struct {
+	organizations repository.OrganizationRepository
+}
+
+func NewOrganizationHandler(organizations repository.OrganizationRepository) *OrganizationHandler {
+	return &OrganizationHandler{organizations: organizations}
+}
+
+// @Summary Get the organization
+// @Description Get the organization of the caller. Every request sees only the users, tasks, projects, API keys and audit log of its organization.
+// @Tags organizations
+// @Produce  json
+// @Success 200 {object} models.Organization
+// @Failure 500 {object} ErrorResponse "Failed to fetch organization"
+// @Router /organization [get]
+func (h *OrganizationHandler) GetOrganization(c *gin.Context) {
+	organization, err := h.organizations.GetByID(c.Request.Context(), repository.OrganizationFrom(c.Request.Context()))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch organization", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, organization)
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProjectHandler serves the project endpoints
+type ProjectHandler struct {
+	projects repository.ProjectRepository
+}
+
+func NewProjectHandler(projects repository.ProjectRepository) *ProjectHandler {
+	return &ProjectHandler{projects: projects}
+}
+
+// ProjectRequest describes a project to create or the new state of a project
+type ProjectRequest struct {
+	Name     string `json:"name" binding:"required,max=255"`
+	Client   string `json:"client" binding:"max=255"`
+	Color    string `json:"color" binding:"omitempty,hexcolor"`
+	Archived bool   `json:"archived"`
+}
+
+// @Summary Get projects
+// @Description Get projects ordered by name
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param client query string false "Client"
+// @Param archived query bool false "Archived projects only (true) or active projects only (false)"
+// @Success 200 {array} models.Project
+// @Failure 400 {object} ErrorResponse "Invalid archived parameter"
+// @Failure 500 {object} ErrorResponse "Failed to fetch projects"
+// @Router /projects [get]
+func (h *ProjectHandler) GetProjects(c *gin.Context) {
+	filter := repository.ProjectFilter{Client: c.Query("client")}
+	if archived := c.Query("archived"); archived != "" {
+		value, err := strconv.ParseBool(archived)
+		if err != nil {
+			slog.InfoContext(c.Request.Context(), "Invalid archived parameter", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid archived parameter"})
+			return
+		}
+		filter.Archived = &value
+	}
+
+	projects, err := h.projects.List(c.Request.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch projects", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, projects)
+}
+
+// @Summary Get a project
+// @Description Get a project by ID
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Project ID"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} ErrorResponse "Invalid project ID"
+// @Failure 404 {object} ErrorResponse "Project not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch project"
+// @Router /projects/{id} [get]
+func (h *ProjectHandler) GetProject(c *gin.Context) {
+	projectID, ok := parseID(c, "id", "Invalid project ID")
+	if !ok {
+		return
+	}
+
+	project, ok := h.findProject(c, projectID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+// @Summary Add a new project
+// @Description Add a new project, project names are unique ignoring case
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param project body ProjectRequest true "Project"
+// @Success 201 {object} models.Project
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 409 {object} ErrorResponse "Project with this name already exists"
+// @Failure 500 {object} ErrorResponse "Failed to save project"
+// @Router /projects [post]
+func (h *ProjectHandler) AddProject(c *gin.Context) {
+	var project models.Project
+	if !bindProject(c, &project) {
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Creating project", "project", project)
+	if err := h.projects.Create(c.Request.Context(), &project); err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to save project", "error", err)
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Project with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save project"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, project)
+}
+
+// @Summary Update a project
+// @Description Replace a project by ID
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Project ID"
+// @Param project body ProjectRequest true "Project"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 404 {object} ErrorResponse "Project not found"
+// @Failure 409 {object} ErrorResponse "Project with this name already exists"
+// @Failure 500 {object} ErrorResponse "Failed to update project"
+// @Router /projects/{id} [put]
+func (h *ProjectHandler) UpdateProject(c *gin.Context) {
+	projectID, ok := parseID(c, "id", "Invalid project ID")
+	if !ok {
+		return
+	}
+
+	project, ok := h.findProject(c, projectID)
+	if !ok {
+		return
+	}
+	if !bindProject(c, &project) {
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Updating project", "project_id", projectID, "project", project)
+	if err := h.projects.Update(c.Request.Context(), &project); err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to update project", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		case errors.Is(err, repository.ErrDuplicate):
+			c.JSON(http.StatusConflict, gin.H{"error": "Project with this name already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+// @Summary Delete a project
+// @Description Delete a project by ID, its tasks are kept without a project
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Project ID"
+// @Success 200 {object} ErrorResponse "Project deleted successfully"
+// @Failure 400 {object} ErrorResponse "Invalid project ID"
+// @Failure 404 {object} ErrorResponse "Project not found"
+// @Failure 500 {object} ErrorResponse "Failed to delete project"
+// @Router /projects/{id} [delete]
+func (h *ProjectHandler) DeleteProject(c *gin.Context) {
+	projectID, ok := parseID(c, "id", "Invalid project ID")
+	if !ok {
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Deleting project", "project_id", projectID)
+	if err := h.projects.Delete(c.Request.Context(), projectID); err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to delete project", "error", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Project deleted successfully"})
+}
+
+// findProject fetches the project by ID.
+// It writes an error response and returns false if there is no such project.
+func (h *ProjectHandler) findProject(c *gin.Context, id uint) (models.Project, bool) {
+	project, err := h.projects.GetByID(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			slog.InfoContext(c.Request.Context(), "Project not found", "error", err)
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return models.Project{}, false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch project", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch project"})
+		return models.Project{}, false
+	}
+	return project, true
+}
+
+// bindProject parses the request body onto the project.
+// It writes a 400 response and returns false if the body is invalid.
+func bindProject(c *gin.Context, project *models.Project) bool {
+	var req ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": "name must not be blank"})
+		return false
+	}
+
+	project.Name = req.Name
+	project.Client = strings.TrimSpace(req.Client)
+	project.Color = strings.ToLower(req.Color)
+	project.Archived = req.Archived
+	return true
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReportHandler serves the report endpoints
+type ReportHandler struct {
+	users repository.UserRepository
+	tasks repository.TaskRepository
+}
+
+func NewReportHandler(users repository.UserRepository, tasks repository.TaskRepository) *ReportHandler {
+	return &ReportHandler{users: users, tasks: tasks}
+}
+
+// @Summary User workload report
+// @Description Get the user's workload over a period of time: task - sum of hours and minutes, sorted from the largest to the smallest.
+// @Description Running tasks are counted up to the current moment unless include_active is false.
+// @Description The report can be limited to a project and grouped by task (default) or by project.
+// @Tags reports
+// @Accept  json
+// @Produce  json
+// @Param userID path string true "User ID"
+// @Param start_time query string true "Period start (RFC3339 format)"
+// @Param end_time query string true "Period end (RFC3339 format)"
+// @Param include_active query bool false "Count running tasks up to now" default(true)
+// @Param project_id query int false "Project ID"
+// @Param group_by query string false "Grouping" Enums(task, project) default(task)
+// @Success 200 {array} models.TaskWorkload
+// @Failure 400 {object} ErrorResponse "Invalid period"
+// @Failure 400 {object} ErrorResponse "Invalid group_by parameter"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Failed to build report"
+// @Router /tasks/{userID}/report [get]
+func (h *ReportHandler) GetWorkload(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
+
+	// Parsing the period
+	start, end, ok := parsePeriod(c)
+	if !ok {
+		return
+	}
+
+	includeActive, err := strconv.ParseBool(c.DefaultQuery("include_active", "true"))
+	if err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid include_active parameter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid include_active parameter"})
+		return
+	}
+
+	filter := repository.WorkloadFilter{
+		Start:         start,
+		End:           end,
+		Now:           time.Now(),
+		IncludeActive: includeActive,
+		GroupBy:       c.DefaultQuery("group_by", repository.WorkloadByTask),
+	}
+	if filter.GroupBy != repository.WorkloadByTask && filter.GroupBy != repository.WorkloadByProject {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_by parameter"})
+		return
+	}
+	if c.Query("project_id") != "" {
+		projectID, ok := parseQueryID(c, "project_id", "Invalid project_id parameter")
+		if !ok {
+			return
+		}
+		filter.ProjectID = &projectID
+	}
+
+	// Searching for a user by ID
+	user, ok := findUser(c, h.users, userID)
+	if !ok {
+		return
+	}
+	filter.UserID = user.ID
+
+	slog.DebugContext(c.Request.Context(), "Building workload report", "start", start, "end", end)
+	workload, err := h.tasks.Workload(c.Request.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to build report", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, workload)
+}
+
+// @Summary Team time report
+// @Description Get the time of several users over a period of time grouped by any combination of user, day, week, task and project.
+// @Description Rows are ordered by the dimensions in the given order, every group is followed by its subtotals and the grand total comes last.
+// @Description Days and weeks (starting on Monday) are taken in the given time zone, tasks spanning midnight are split between days.
+// @Tags reports
+// @Accept  json
+// @Produce  json
+// @Param start_time query string true "Period start (RFC3339 format)"
+// @Param end_time query string true "Period end (RFC3339 format)"
+// @Param group_by query string false "Comma separated dimensions: user, day, week, task, project" default(user)
+// @Param user_id query []int false "User IDs, all users by default, the manager and the team for managers" collectionFormat(multi)
+// @Param project_id query int false "Project ID"
+// @Param include_active query bool false "Count running tasks up to now" default(true)
+// @Param timezone query string false "IANA time zone of days and weeks" default(UTC)
+// @Success 200 {array} models.TimeReportRow
+// @Failure 400 {object} ErrorResponse "Invalid period"
+// @Failure 400 {object} ErrorResponse "Invalid group_by parameter"
+// @Failure 403 {object} ErrorResponse "User is not in your team"
+// @Failure 500 {object} ErrorResponse "Failed to build report"
+// @Router /reports/time [get]
+func (h *ReportHandler) GetTeamReport(c *gin.Context) {
+	// Parsing the period
+	start, end, ok := parsePeriod(c)
+	if !ok {
+		return
+	}
+
+	includeActive, err := strconv.ParseBool(c.DefaultQuery("include_active", "true"))
+	if err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid include_active parameter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid include_active parameter"})
+		return
+	}
+
+	location, err := time.LoadLocation(c.DefaultQuery("timezone", "UTC"))
+	if err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid timezone parameter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone parameter"})
+		return
+	}
+
+	groupBy, ok := parseGroupBy(c)
+	if !ok {
+		return
+	}
+
+	filter := repository.TeamReportFilter{
+		Start:         start,
+		End:           end,
+		Now:           time.Now(),
+		Location:      location,
+		IncludeActive: includeActive,
+		GroupBy:       groupBy,
+	}
+	for _, value := range c.QueryArray("user_id") {
+		userID, err := strconv.ParseUint(value, 10, 0)
+		if err != nil || userID == 0 {
+			slog.InfoContext(c.Request.Context(), "Invalid user_id parameter", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id parameter"})
+			return
+		}
+		filter.UserIDs = append(filter.UserIDs, uint(userID))
+	}
+	if c.Query("project_id") != "" {
+		projectID, ok := parseQueryID(c, "project_id", "Invalid project_id parameter")
+		if !ok {
+			return
+		}
+		filter.ProjectID = &projectID
+	}
+	if !h.scopeToTeam(c, &filter) {
+		return
+	}
+
+	slog.DebugContext(c.Request.Context(), "Building team report", "start", start, "end", end, "group_by", groupBy)
+	report, err := h.tasks.TeamReport(c.Request.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to build report", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// scopeToTeam limits the report of a manager to the manager and the team.
+// It writes an error response and returns false if the report asks for other users.
+func (h *ReportHandler) scopeToTeam(c *gin.Context, filter *repository.TeamReportFilter) bool {
+	principal, ok := auth.CurrentPrincipal(c)
+	if !ok || principal.Role != models.RoleManager {
+		return true
+	}
+
+	members, err := h.users.List(c.Request.Context(), repository.UserFilter{ManagerID: &principal.UserID})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch team", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+		return false
+	}
+	team := []uint{principal.UserID}
+	for _, member := range members {
+		team = append(team, member.ID)
+	}
+
+	if len(filter.UserIDs) == 0 {
+		filter.UserIDs = team
+		return true
+	}
+	for _, userID := range filter.UserIDs {
+		if !slices.Contains(team, userID) {
+			slog.InfoContext(c.Request.Context(), "Access denied", "reason", "user is not in the team", "report_user_id", userID)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "details": fmt.Sprintf("user %d is not in your team", userID)})
+			return false
+		}
+	}
+	return true
+}
+
+// parseGroupBy reads the comma separated team report dimensions from the group_by query parameter.
+// It writes a 400 response and returns false if a dimension is unknown or repeated.
+func parseGroupBy(c *gin.Context) ([]string, bool) {
+	dimensions := strings.Split(c.DefaultQuery("group_by", repository.ReportByUser), ",")
+	seen := make(map[string]bool, len(dimensions))
+	for i, dimension := range dimensions {
+		dimension = strings.TrimSpace(dimension)
+		switch dimension {
+		case repository.ReportByUser, repository.ReportByDay, repository.ReportByWeek,
+			repository.ReportByTask, repository.ReportByProject:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_by parameter", "details": "unknown dimension " + strconv.Quote(dimension)})
+			return nil, false
+		}
+		if seen[dimension] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_by parameter", "details": "repeated dimension " + strconv.Quote(dimension)})
+			return nil, false
+		}
+		seen[dimension] = true
+		dimensions[i] = dimension
+	}
+	return dimensions, true
+}
+
+// parsePeriod reads the start_time and end_time query parameters.
+// It writes a 400 response and returns false if they are missing or invalid.
+func parsePeriod(c *gin.Context) (time.Time, time.Time, bool) {
+	start, err := time.Parse(time.RFC3339, c.Query("start_time"))
+	if err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid start_time parameter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time parameter"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	end, err := time.Parse(time.RFC3339, c.Query("end_time"))
+	if err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid end_time parameter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time parameter"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must be after start_time"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	return start, end, true
+}
+
+// parseQueryID reads an ID from the query parameter.
+// It writes a 400 response with the message and returns false if the ID is invalid.
+func parseQueryID(c *gin.Context, param, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Query(param), 10, 0)
+	if err != nil || id == 0 {
+		slog.InfoContext(c.Request.Context(), "Invalid parameter", "param", param, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return uint(id), true
+}
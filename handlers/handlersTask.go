@@ -1,17 +1,34 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
-	"github.com/ananikitina/time-tracker/database"
 	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
+// TaskHandler serves the task endpoints
+type TaskHandler struct {
+	users    repository.UserRepository
+	tasks    repository.TaskRepository
+	projects repository.ProjectRepository
+	audit    repository.AuditRepository
+	tx       repository.Transactor
+}
+
+func NewTaskHandler(users repository.UserRepository, tasks repository.TaskRepository,
+	projects repository.ProjectRepository, audit repository.AuditRepository, tx repository.Transactor) *TaskHandler {
+	return &TaskHandler{users: users, tasks: tasks, projects: projects, audit: audit, tx: tx}
+}
+
 // @Summary Sort user tasks
 // @Description SortTasks sorts the user's tasks in descending order over a period of time.
 // @Tags tasks
@@ -21,41 +38,40 @@ import (
 // @Param start_time query string true "Start time filter (RFC3339 format)"
 // @Param end_time query string true "End time filter (RFC3339 format)"
 // @Success 200 {object} []models.Task
+// @Failure 400 {object} ErrorResponse "Invalid period"
 // @Failure 404 {object} ErrorResponse "User not found"
 // @Failure 500 {object} ErrorResponse "Failed to retrieve tasks"
-// @Router /user/{userID}/tasks/sort [get]
-func SortTasks(c *gin.Context) {
-	log.Println("Handling SortTasks request")
+// @Router /tasks/{userID}/sort [get]
+func (h *TaskHandler) SortTasks(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
 
-	var user models.User
-	userID := c.Param("userID")
-	startTime := c.Query("start_time")
-	endTime := c.Query("end_time")
+	startTime, endTime, ok := parsePeriod(c)
+	if !ok {
+		return
+	}
 
 	// Searching for a user by ID
-	log.Printf("Finding user with ID: %s", userID)
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		log.Printf("User not found: %v", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	user, ok := findUser(c, h.users, userID)
+	if !ok {
 		return
 	}
 
 	// Fetching user's tasks for a specified time period
-	log.Printf("Fetching tasks for user %s between %s and %s", userID, startTime, endTime)
-	var tasks []models.Task
-	if err := database.DB.Where("user_id = ? AND start_time >= ? AND end_time <= ?", user.ID, startTime, endTime).
-		Find(&tasks).Error; err != nil {
-		log.Printf("Failed to retrieve tasks: %v", err)
+	slog.DebugContext(c.Request.Context(), "Fetching tasks", "start", startTime, "end", endTime)
+	tasks, err := h.tasks.ListFinished(c.Request.Context(), user.ID, startTime, endTime)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve tasks", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tasks"})
 		return
 	}
 
-	// Calculating the duration of the task
+	// Calculating the duration of the task without breaks
+	now := time.Now()
 	calculateDuration := func(task models.Task) time.Duration {
-		if task.EndTime != nil {
-			return task.EndTime.Sub(task.StartTime)
-		}
-		return time.Duration(0)
+		return task.Duration(now)
 	}
 
 	// Sorting tasks in descending order
@@ -67,50 +83,166 @@ func SortTasks(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
 }
 
+// TaskDetails describes what a task is about
+type TaskDetails struct {
+	Name        string   `json:"name" binding:"required,max=255"`
+	Description string   `json:"description" binding:"max=2000"`
+	ProjectID   *uint    `json:"project_id"`
+	Tags        []string `json:"tags" binding:"max=20,dive,required,max=50"`
+}
+
+// StartTaskRequest describes the task to start
+type StartTaskRequest struct {
+	TaskDetails
+	// StopActive finishes the running task instead of rejecting the request
+	StopActive bool `json:"stop_active"`
+}
+
 // @Summary Start a new task
-// @Description Start a new task for the user
+// @Description Start a new task for the user. A user can have only one running task:
+// @Description if there is one, it is finished when stop_active is true, otherwise the request is rejected.
 // @Tags tasks
 // @Accept  json
 // @Produce  json
 // @Param userID path string true "User ID"
+// @Param task body StartTaskRequest true "Task to start"
 // @Success 201 {object} models.Task
+// @Failure 400 {object} ErrorResponse "Invalid request body"
 // @Failure 404 {object} ErrorResponse "User not found"
-// @Router /user/{userID}/tasks/start [post]
-func StartTask(c *gin.Context) {
-	log.Println("Handling StartTask request")
+// @Failure 409 {object} ErrorResponse "User already has an active task"
+// @Failure 500 {object} ErrorResponse "Failed to create task"
+// @Router /tasks/{userID}/start [post]
+func (h *TaskHandler) StartTask(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
 
-	var user models.User
-	userID := c.Param("userID")
+	// Parsing JSON request body
+	var req StartTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
 
-	// Searching for a user by ID
-	log.Printf("Finding user with ID: %s", userID)
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		log.Printf("User not found: %v", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	if !validateTaskDetails(c, &req.TaskDetails) || !h.checkProject(c, req.ProjectID) {
 		return
 	}
 
 	// Creation of a new task
-	task := models.Task{
-		UserID:    user.ID,
-		TaskName:  "Новая задача",
-		StartTime: time.Now(),
-		EndTime:   nil,
-	}
+	task := newTask(userID, req.TaskDetails, time.Now())
 
 	// Saving a task in a database
-	log.Printf("Creating task for user %s: %+v", userID, task)
-	if err := database.DB.Create(&task).Error; err != nil {
-		log.Printf("Failed to create task: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+	slog.InfoContext(c.Request.Context(), "Creating task", "task", task)
+	var stopped *models.Task
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		var err error
+		if stopped, err = h.tasks.Start(ctx, &task, req.StopActive); err != nil {
+			return err
+		}
+		if stopped != nil {
+			before := beforeFinish(*stopped)
+			if err := recordAudit(ctx, c, h.audit, models.AuditFinish, models.AuditEntityTask, stopped.ID, before, stopped); err != nil {
+				return err
+			}
+			if err := recordRevision(ctx, h.audit, *stopped, false); err != nil {
+				return err
+			}
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditStart, models.AuditEntityTask, task.ID, nil, task)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to create task", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, repository.ErrActiveTask):
+			c.JSON(http.StatusConflict, gin.H{"error": "User already has an active task"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"task": task})
+	response := gin.H{"task": task}
+	if stopped != nil {
+		slog.InfoContext(c.Request.Context(), "Finished previous task", "task_id", stopped.ID)
+		response["stopped_task"] = stopped
+	}
+	setETag(c, task.Version)
+	c.JSON(http.StatusCreated, response)
+}
+
+// @Summary Switch to another task
+// @Description Finish the active task and start a new one at the same moment in a single transaction
+// @Tags tasks
+// @Accept  json
+// @Produce  json
+// @Param userID path string true "User ID"
+// @Param task body TaskDetails true "Task to switch to"
+// @Success 201 {object} models.Task
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 404 {object} ErrorResponse "No active task found for the user"
+// @Failure 500 {object} ErrorResponse "Failed to switch task"
+// @Router /tasks/{userID}/switch [post]
+func (h *TaskHandler) SwitchTask(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
+
+	// Parsing JSON request body
+	var req TaskDetails
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if !validateTaskDetails(c, &req) || !h.checkProject(c, req.ProjectID) {
+		return
+	}
+
+	// Searching for a user by ID
+	if _, ok := findUser(c, h.users, userID); !ok {
+		return
+	}
+
+	// Both tasks share the same timestamp, so no time is lost in between
+	task := newTask(userID, req, time.Now())
+
+	slog.InfoContext(c.Request.Context(), "Switching task", "task", task)
+	var stopped models.Task
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		var err error
+		if stopped, err = h.tasks.Switch(ctx, &task); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, c, h.audit, models.AuditFinish, models.AuditEntityTask, stopped.ID, beforeFinish(stopped), stopped); err != nil {
+			return err
+		}
+		if err := recordRevision(ctx, h.audit, stopped, false); err != nil {
+			return err
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditStart, models.AuditEntityTask, task.ID, nil, task)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to switch task", "error", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No active task found for the user"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch task"})
+		return
+	}
+
+	setETag(c, task.Version)
+	c.JSON(http.StatusCreated, gin.H{"task": task, "stopped_task": stopped})
 }
 
 // @Summary Finish active task
-// @Description Finish the active task for the user
+// @Description Finish the active task for the user, a break in progress ends together with the task
 // @Tags tasks
 // @Accept  json
 // @Produce  json
@@ -119,42 +251,140 @@ func StartTask(c *gin.Context) {
 // @Failure 404 {object} ErrorResponse "User not found"
 // @Failure 404 {object} ErrorResponse "No active task found for the user"
 // @Failure 500 {object} ErrorResponse "Failed to finish task"
-// @Router /user/{userID}/tasks/finish [put]
-func FinishTask(c *gin.Context) {
-	log.Println("Handling FinishTask request")
+// @Router /tasks/{userID}/finish [put]
+func (h *TaskHandler) FinishTask(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
 
-	var user models.User
-	userID := c.Param("userID")
+	// Searching for a user by ID
+	if _, ok := findUser(c, h.users, userID); !ok {
+		return
+	}
+
+	// Finishing the active task for the user
+	slog.InfoContext(c.Request.Context(), "Finishing active task")
+	var task models.Task
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		var err error
+		if task, err = h.tasks.Finish(ctx, userID, time.Now()); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, c, h.audit, models.AuditFinish, models.AuditEntityTask, task.ID, beforeFinish(task), task); err != nil {
+			return err
+		}
+		return recordRevision(ctx, h.audit, task, false)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to finish task", "error", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No active task found for the user"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finish task"})
+		return
+	}
+
+	setETag(c, task.Version)
+	c.JSON(http.StatusOK, gin.H{"task": task})
+}
+
+// @Summary Pause active task
+// @Description Start a break in the active task for the user. Breaks are not counted in the task duration.
+// @Tags tasks
+// @Accept  json
+// @Produce  json
+// @Param userID path string true "User ID"
+// @Success 200 {object} models.Task
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 404 {object} ErrorResponse "No active task found for the user"
+// @Failure 409 {object} ErrorResponse "Task is already paused"
+// @Failure 500 {object} ErrorResponse "Failed to pause task"
+// @Router /tasks/{userID}/pause [put]
+func (h *TaskHandler) PauseTask(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
+		return
+	}
 
 	// Searching for a user by ID
-	log.Printf("Finding user with ID: %s", userID)
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		log.Printf("User not found: %v", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	if _, ok := findUser(c, h.users, userID); !ok {
 		return
 	}
 
-	// Finding the active task for the user
-	log.Printf("Finding active task for user %s", userID)
+	slog.InfoContext(c.Request.Context(), "Pausing active task")
 	var task models.Task
-	if err := database.DB.Where("user_id = ? AND end_time IS NULL", userID).First(&task).Error; err != nil {
-		log.Printf("No active task found for user %s: %v", userID, err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "No active task found for the user"})
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		var err error
+		if task, err = h.tasks.Pause(ctx, userID, time.Now()); err != nil {
+			return err
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditPause, models.AuditEntityTask, task.ID, beforePause(task), task)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to pause task", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No active task found for the user"})
+		case errors.Is(err, repository.ErrTaskPaused):
+			c.JSON(http.StatusConflict, gin.H{"error": "Task is already paused"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pause task"})
+		}
 		return
 	}
 
-	// Seting the end time to now
-	now := time.Now()
-	task.EndTime = &now
+	setETag(c, task.Version)
+	c.JSON(http.StatusOK, gin.H{"task": task})
+}
 
-	// Saving the updated task to the database
-	log.Printf("Finishing task for user %s: %+v", userID, task)
-	if err := database.DB.Save(&task).Error; err != nil {
-		log.Printf("Failed to finish task: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finish task"})
+// @Summary Resume paused task
+// @Description Finish the break in the active task for the user
+// @Tags tasks
+// @Accept  json
+// @Produce  json
+// @Param userID path string true "User ID"
+// @Success 200 {object} models.Task
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 404 {object} ErrorResponse "No active task found for the user"
+// @Failure 409 {object} ErrorResponse "Task is not paused"
+// @Failure 500 {object} ErrorResponse "Failed to resume task"
+// @Router /tasks/{userID}/resume [put]
+func (h *TaskHandler) ResumeTask(c *gin.Context) {
+	userID, ok := parseUserID(c, "userID")
+	if !ok {
 		return
 	}
 
+	// Searching for a user by ID
+	if _, ok := findUser(c, h.users, userID); !ok {
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Resuming active task")
+	var task models.Task
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		var err error
+		if task, err = h.tasks.Resume(ctx, userID, time.Now()); err != nil {
+			return err
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditResume, models.AuditEntityTask, task.ID, beforeResume(task), task)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to resume task", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No active task found for the user"})
+		case errors.Is(err, repository.ErrTaskNotPaused):
+			c.JSON(http.StatusConflict, gin.H{"error": "Task is not paused"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume task"})
+		}
+		return
+	}
+
+	setETag(c, task.Version)
 	c.JSON(http.StatusOK, gin.H{"task": task})
 }
 
@@ -165,31 +395,143 @@ func FinishTask(c *gin.Context) {
 // @Produce  json
 // @Param id path string true "User ID"
 // @Success 200 {array} models.Task
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
 // @Failure 404 {object} ErrorResponse "No tasks found for the user"
 // @Failure 500 {object} ErrorResponse "Failed to fetch tasks"
-// @Router /user/{id}/tasks [get]
-func GetUserTasks(c *gin.Context) {
-	log.Println("Handling GetUserTasks request")
-
+// @Router /users/{id}/tasks [get]
+func (h *TaskHandler) GetUserTasks(c *gin.Context) {
 	// Extract user ID from URL parameter
-	userID := c.Param("id")
-	log.Printf("Fetching tasks for user with ID: %s", userID)
-
-	var tasks []models.Task
+	userID, ok := parseUserID(c, "id")
+	if !ok {
+		return
+	}
+	slog.DebugContext(c.Request.Context(), "Fetching tasks")
 
 	// Fetching user's tasks
-	if err := database.DB.Where("user_id = ?", userID).Find(&tasks).Error; err != nil {
-		log.Printf("Failed to fetch tasks: %v", err)
+	tasks, err := h.tasks.ListByUser(c.Request.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch tasks", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
 		return
 	}
 
 	// Check if tasks are found
 	if len(tasks) == 0 {
-		log.Printf("No tasks found for user with ID: %s", userID)
+		slog.InfoContext(c.Request.Context(), "No tasks found")
 		c.JSON(http.StatusNotFound, gin.H{"error": "No tasks found for the user"})
 		return
 	}
 
 	c.JSON(http.StatusOK, tasks)
 }
+
+// validateTaskDetails trims the task details and checks what binding can't.
+// It writes a 400 response and returns false if they are invalid.
+func validateTaskDetails(c *gin.Context, details *TaskDetails) bool {
+	details.Name = strings.TrimSpace(details.Name)
+	details.Description = strings.TrimSpace(details.Description)
+	details.Tags = normalizeTags(details.Tags)
+
+	if details.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": "name must not be blank"})
+		return false
+	}
+	return true
+}
+
+// checkProject checks that time can be tracked on the project: it must exist and not be archived.
+// It writes an error response and returns false otherwise, a nil project is always allowed.
+func (h *TaskHandler) checkProject(c *gin.Context, projectID *uint) bool {
+	if projectID == nil {
+		return true
+	}
+
+	project, err := h.projects.GetByID(c.Request.Context(), *projectID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			slog.InfoContext(c.Request.Context(), "Project not found", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": "project not found"})
+			return false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch project", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch project"})
+		return false
+	}
+	if project.Archived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": "project is archived"})
+		return false
+	}
+	return true
+}
+
+// The before* functions return the running task as it was before the change,
+// for the audit log. They rebuild it from the task returned by the change,
+// which is read under the same lock, instead of reading the task again.
+// Breaks are in chronological order, only the last one can be unfinished.
+
+// beforeFinish returns the task before it was finished: running, with the last break
+// unfinished if it ended together with the task
+func beforeFinish(task models.Task) models.Task {
+	before := copyTask(task)
+	if n := len(before.Breaks); n > 0 && task.EndTime != nil {
+		last := &before.Breaks[n-1]
+		if last.EndTime != nil && !last.EndTime.Before(*task.EndTime) {
+			last.EndTime = nil
+		}
+	}
+	before.EndTime = nil
+	return before
+}
+
+// beforePause returns the task before the break started
+func beforePause(task models.Task) models.Task {
+	before := copyTask(task)
+	if n := len(before.Breaks); n > 0 {
+		before.Breaks = before.Breaks[:n-1]
+	}
+	return before
+}
+
+// beforeResume returns the task before the break finished
+func beforeResume(task models.Task) models.Task {
+	before := copyTask(task)
+	if n := len(before.Breaks); n > 0 {
+		before.Breaks[n-1].EndTime = nil
+	}
+	return before
+}
+
+// copyTask returns a copy of the task with its own breaks, so that the state before a change
+// can be rebuilt without changing the task the change returned
+func copyTask(task models.Task) models.Task {
+	task.Breaks = append([]models.TaskBreak(nil), task.Breaks...)
+	return task
+}
+
+// newTask creates a running task of the user started at the given moment
+func newTask(userID uint, details TaskDetails, start time.Time) models.Task {
+	return models.Task{
+		UserID:      userID,
+		TaskName:    details.Name,
+		Description: details.Description,
+		ProjectID:   details.ProjectID,
+		Tags:        details.Tags,
+		StartTime:   start,
+		EndTime:     nil,
+	}
+}
+
+// normalizeTags trims the tags and drops duplicates, keeping the original order
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
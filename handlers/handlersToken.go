@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultTokenTTL is how long a personal access token is valid if no expiry time is given
+const defaultTokenTTL = 90 * 24 * time.Hour
+
+// TokenHandler serves the endpoints managing the personal access tokens of the users
+type TokenHandler struct {
+	users  repository.UserRepository
+	tokens repository.TokenRepository
+	audit  repository.AuditRepository
+	tx     repository.Transactor
+}
+
+func NewTokenHandler(users repository.UserRepository, tokens repository.TokenRepository, audit repository.AuditRepository,
+	tx repository.Transactor) *TokenHandler {
+	return &TokenHandler{users: users, tokens: tokens, audit: audit, tx: tx}
+}
+
+// TokenRequest describes a personal access token to create
+type TokenRequest struct {
+	Name   string   `json:"name" binding:"required,max=255"`
+	Scopes []string `json:"scopes" binding:"required" enums:"tasks:read,tasks:write,reports:read"`
+	// ExpiresAt is when the token stops working, 90 days from now by default
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedToken is a new personal access token together with the token itself, which is not shown again
+type CreatedToken struct {
+	models.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// @Summary Get personal access tokens
+// @Description Get the user's personal access tokens including the revoked and expired ones, the tokens themselves are not returned
+// @Tags tokens
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {array} models.PersonalAccessToken
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch tokens"
+// @Router /users/{id}/tokens [get]
+func (h *TokenHandler) GetTokens(c *gin.Context) {
+	userID, ok := parseUserID(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := findUser(c, h.users, userID); !ok {
+		return
+	}
+
+	tokens, err := h.tokens.List(c.Request.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch tokens", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// @Summary Create a personal access token
+// @Description Create a token acting for the user within the scopes, for scripts and widgets. Only the user may create their tokens.
+// @Description The token is returned only in this response and is sent as a bearer token. It may only be used for the routes of its scopes:
+// @Description tasks:read, tasks:write, reports:read.
+// @Tags tokens
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Param token body TokenRequest true "Token"
+// @Success 201 {object} CreatedToken
+// @Failure 400 {object} ValidationErrorResponse "Invalid request body"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Failed to create token"
+// @Router /users/{id}/tokens [post]
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	userID, ok := parseUserID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req TokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	token := models.PersonalAccessToken{UserID: userID, Name: strings.TrimSpace(req.Name), ExpiresAt: req.ExpiresAt}
+	var fields []FieldError
+	if token.Name == "" {
+		fields = append(fields, FieldError{Field: "name", Code: "required", Message: "name must not be blank"})
+	}
+	for _, scope := range req.Scopes {
+		if !models.ValidScope(scope) {
+			fields = append(fields, FieldError{Field: "scopes", Code: "invalid",
+				Message: "each scope must be one of " + strings.Join(models.Scopes, ", ")})
+			break
+		}
+		if !slices.Contains(token.Scopes, scope) {
+			token.Scopes = append(token.Scopes, scope)
+		}
+	}
+	if len(req.Scopes) == 0 {
+		fields = append(fields, FieldError{Field: "scopes", Code: "required", Message: "at least one scope is required"})
+	}
+	if token.ExpiresAt == nil {
+		expiresAt := time.Now().Add(defaultTokenTTL).Truncate(time.Second)
+		token.ExpiresAt = &expiresAt
+	} else if !token.ExpiresAt.After(time.Now()) {
+		fields = append(fields, FieldError{Field: "expires_at", Code: "invalid", Message: "expires_at must be in the future"})
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{Error: "Invalid request body", Fields: fields})
+		return
+	}
+
+	if _, ok := findUser(c, h.users, userID); !ok {
+		return
+	}
+	// Saving together with the audit entry
+	var secret string
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		var err error
+		token, secret, err = auth.CreateToken(ctx, h.tokens, token)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditCreate, models.AuditEntityToken, token.ID, nil, token)
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Created personal access token", "token_id", token.ID, "scopes", token.Scopes)
+	c.JSON(http.StatusCreated, CreatedToken{PersonalAccessToken: token, Token: secret})
+}
+
+// @Summary Revoke a personal access token
+// @Description Revoke the user's personal access token by ID, requests with it are rejected from now on
+// @Tags tokens
+// @Produce  json
+// @Param id path string true "User ID"
+// @Param tokenID path string true "Token ID"
+// @Success 200 {object} models.PersonalAccessToken
+// @Failure 400 {object} ErrorResponse "Invalid token ID"
+// @Failure 404 {object} ErrorResponse "Token not found"
+// @Failure 500 {object} ErrorResponse "Failed to revoke token"
+// @Router /users/{id}/tokens/{tokenID} [delete]
+func (h *TokenHandler) RevokeToken(c *gin.Context) {
+	userID, ok := parseUserID(c, "id")
+	if !ok {
+		return
+	}
+	tokenID, ok := parseID(c, "tokenID", "Invalid token ID")
+	if !ok {
+		return
+	}
+
+	var token models.PersonalAccessToken
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		var err error
+		token, err = h.tokens.Revoke(ctx, userID, tokenID)
+		if err != nil {
+			return err
+		}
+		before := token
+		before.RevokedAt = nil
+		return recordAudit(ctx, c, h.audit, models.AuditRevoke, models.AuditEntityToken, token.ID, before, token)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to revoke token", "token_id", tokenID, "error", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Revoked personal access token", "token_id", token.ID)
+	c.JSON(http.StatusOK, token)
+}
@@ -1,12 +1,21 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/ananikitina/time-tracker/database"
+	"github.com/ananikitina/time-tracker/logging"
 	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/peopleinfo"
+	"github.com/ananikitina/time-tracker/repository"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,71 +25,109 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// FieldError describes an invalid field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse is the error response listing the invalid fields
+type ValidationErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// UserHandler serves the user endpoints
+type UserHandler struct {
+	users repository.UserRepository
+	audit repository.AuditRepository
+	tx    repository.Transactor
+	// people fills in the details of new users, nil if the service is not used
+	people peopleinfo.Service
+}
+
+func NewUserHandler(users repository.UserRepository, audit repository.AuditRepository, tx repository.Transactor,
+	people peopleinfo.Service) *UserHandler {
+	return &UserHandler{users: users, audit: audit, tx: tx, people: people}
+}
+
 // @Summary Get users
 // @Description Get users with filtering and pagination
 // @Tags users
 // @Accept  json
 // @Produce  json
-// @Param passportNumber query string false "Passport Number"
+// @Param passportNumber query string false "Passport series and number, e.g. 1234 567890"
 // @Param surname query string false "Surname"
 // @Param name query string false "Name"
 // @Param patronymic query string false "Patronymic"
 // @Param address query string false "Address"
+// @Param role query string false "Role" Enums(admin, manager, employee)
+// @Param deleted query string false "Soft deleted users: include or only, hidden by default" Enums(include, only)
 // @Param page query int false "Page number" default(1)
 // @Param pageSize query int false "Page size" default(10)
 // @Success 200 {array} models.User
+// @Failure 400 {object} ValidationErrorResponse "Invalid passportNumber parameter"
+// @Failure 400 {object} ErrorResponse "Invalid deleted parameter"
 // @Failure 400 {object} ErrorResponse "Invalid page parameter"
 // @Failure 400 {object} ErrorResponse "Invalid pageSize parameter"
 // @Failure 404 {object} ErrorResponse "No users found with specified filters"
+// @Failure 500 {object} ErrorResponse "Failed to fetch users"
 // @Router /users [get]
-func GetUsers(c *gin.Context) {
-	log.Println("Handling GetUsers request")
-
-	var users []models.User
-	query := database.DB
-
+func (h *UserHandler) GetUsers(c *gin.Context) {
 	// Filtering
-	if passportNumber := c.Query("passportNumber"); passportNumber != "" {
-		log.Printf("Filtering by passportNumber: %s", passportNumber)
-		query = query.Where("passport_number = ?", passportNumber)
-	}
-	if surname := c.Query("surname"); surname != "" {
-		log.Printf("Filtering by surname: %s", surname)
-		query = query.Where("surname = ?", surname)
+	filter := repository.UserFilter{
+		Surname:    c.Query("surname"),
+		Name:       c.Query("name"),
+		Patronymic: c.Query("patronymic"),
+		Address:    c.Query("address"),
+		Role:       c.Query("role"),
+		Deleted:    c.Query("deleted"),
 	}
-	if name := c.Query("name"); name != "" {
-		log.Printf("Filtering by name: %s", name)
-		query = query.Where("name = ?", name)
-	}
-	if patronymic := c.Query("patronymic"); patronymic != "" {
-		log.Printf("Filtering by patronymic: %s", patronymic)
-		query = query.Where("patronymic = ?", patronymic)
+	switch filter.Deleted {
+	case repository.DeletedExclude, repository.DeletedInclude, repository.DeletedOnly:
+	default:
+		slog.InfoContext(c.Request.Context(), "Invalid deleted parameter", "deleted", filter.Deleted)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deleted parameter"})
+		return
 	}
-	if address := c.Query("address"); address != "" {
-		log.Printf("Filtering by address: %s", address)
-		query = query.Where("address = ?", address)
+	if value := c.Query("passportNumber"); value != "" {
+		passport, err := models.ParsePassport(value)
+		if err != nil {
+			slog.InfoContext(c.Request.Context(), "Invalid passportNumber parameter", "error", err)
+			respondPassportError(c, "Invalid passportNumber parameter", "passportNumber", err)
+			return
+		}
+		filter.Passport = &passport
 	}
+	slog.DebugContext(c.Request.Context(), "Filtering users", "filter", filter)
 
 	// Pagination
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
-	if err != nil {
-		log.Printf("Error converting page to int: %v", err)
+	if err != nil || page < 1 {
+		slog.InfoContext(c.Request.Context(), "Invalid page parameter", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page parameter"})
 		return
 	}
 
 	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
-	if err != nil {
-		log.Printf("Error converting pageSize to int: %v", err)
+	if err != nil || pageSize < 1 {
+		slog.InfoContext(c.Request.Context(), "Invalid pageSize parameter", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pageSize parameter"})
 		return
 	}
 
-	offset := (page - 1) * pageSize
-	log.Printf("Pagination - Page: %d, PageSize: %d, Offset: %d", page, pageSize, offset)
+	filter.Offset = (page - 1) * pageSize
+	filter.Limit = pageSize
+	slog.DebugContext(c.Request.Context(), "Paginating users", "page", page, "page_size", pageSize, "offset", filter.Offset)
 
-	query.Offset(offset).Limit(pageSize).Find(&users)
-	log.Printf("Found %d users", len(users))
+	users, err := h.users.List(c.Request.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch users", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	slog.DebugContext(c.Request.Context(), "Found users", "count", len(users))
 
 	// Check if users are found
 	if len(users) == 0 {
@@ -91,124 +138,686 @@ func GetUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, users)
 }
 
+// AddUserRequest describes a new user. Only the passport is required:
+// if the surname or the name is missing, the details are taken from the people info service.
+type AddUserRequest struct {
+	// PassportNumber is the passport series and number, e.g. "1234 567890"
+	PassportNumber string `json:"passportNumber" example:"1234 567890"`
+	// PassportNumberAlias is the passport under the name the user has in responses
+	PassportNumberAlias string `json:"passport_number"`
+	Surname             string `json:"surname"`
+	Name                string `json:"name"`
+	Patronymic          string `json:"patronymic"`
+	Address             string `json:"address"`
+	// Role is employee by default
+	Role      string `json:"role" enums:"admin,manager,employee"`
+	ManagerID *uint  `json:"manager_id"`
+}
+
 // @Summary Add a new user
-// @Description Add a new user
+// @Description Add a new user. The missing details are taken from the people info service by the passport.
 // @Tags users
 // @Accept  json
 // @Produce  json
-// @Param   user     body    models.User     true  "User"
+// @Param   user     body    AddUserRequest     true  "User"
 // @Success 200 {object} models.User
-// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 400 {object} ValidationErrorResponse "Invalid request body"
+// @Failure 409 {object} ErrorResponse "User with this passport number already exists"
+// @Failure 422 {object} ErrorResponse "Person with this passport number not found"
 // @Failure 500 {object} ErrorResponse "Failed to save user to database"
-// @Router /user [post]
-func AddUser(c *gin.Context) {
-	log.Println("Handling AddUser request")
-
-	var newUser models.User
+// @Failure 502 {object} ErrorResponse "Failed to fetch user details"
+// @Router /users [post]
+func (h *UserHandler) AddUser(c *gin.Context) {
+	var req AddUserRequest
 
 	// Parsing JSON request body
-	if err := c.ShouldBindJSON(&newUser); err != nil {
-		log.Printf("Error binding JSON: %v", err)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid request body", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	log.Printf("Parsed user: %v", newUser)
+	field, value := "passportNumber", req.PassportNumber
+	if value == "" && req.PassportNumberAlias != "" {
+		field, value = "passport_number", req.PassportNumberAlias
+	}
+	passport, err := models.ParsePassport(value)
+	if err != nil {
+		slog.InfoContext(c.Request.Context(), "Invalid passport", "field", field, "error", err)
+		respondPassportError(c, "Invalid request body", field, err)
+		return
+	}
+
+	newUser := models.User{
+		Passport:   passport,
+		Surname:    strings.TrimSpace(req.Surname),
+		Name:       strings.TrimSpace(req.Name),
+		Patronymic: strings.TrimSpace(req.Patronymic),
+		Address:    strings.TrimSpace(req.Address),
+		Role:       models.RoleEmployee,
+		ManagerID:  req.ManagerID,
+	}
+	if req.Role != "" {
+		if fieldError := setRole(&newUser, req.Role); fieldError != nil {
+			c.JSON(http.StatusBadRequest, ValidationErrorResponse{Error: "Invalid request body", Fields: []FieldError{*fieldError}})
+			return
+		}
+	}
+	fieldError, ok := h.checkManager(c, newUser)
+	if !ok {
+		return
+	}
+	if fieldError != nil {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{Error: "Invalid request body", Fields: []FieldError{*fieldError}})
+		return
+	}
+
+	slog.DebugContext(c.Request.Context(), "Parsed user", "user", newUser)
 
-	// Saving to database
-	if err := database.DB.Create(&newUser).Error; err != nil {
-		log.Printf("Error saving user to database: %v", err)
+	if !h.enrich(c, &newUser) {
+		return
+	}
+
+	// Saving to database together with the audit entry
+	err = h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		if err := h.users.Create(ctx, &newUser); err != nil {
+			return err
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditCreate, models.AuditEntityUser, newUser.ID, nil, newUser)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to save user", "error", err)
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "User with this passport number already exists"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user to database"})
 		return
 	}
-	log.Printf("User saved: %v", newUser)
+	logging.AddAttrs(c.Request.Context(), slog.Uint64("user_id", uint64(newUser.ID)))
+	slog.InfoContext(c.Request.Context(), "User saved", "user", newUser)
 
+	setETag(c, newUser.Version)
 	c.JSON(http.StatusOK, newUser)
 }
 
+// @Summary Get a user
+// @Description Get a user by ID. The ETag header is the version of the user, with If-None-Match an unchanged user is not sent again.
+// @Tags users
+// @Produce  json
+// @Param id path string true "User ID"
+// @Param If-None-Match header string false "ETag of the user the client has"
+// @Success 200 {object} models.User
+// @Success 304 "User not modified"
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch user"
+// @Router /users/{id} [get]
+func (h *UserHandler) GetUser(c *gin.Context) {
+	userID, ok := parseUserID(c, "id")
+	if !ok {
+		return
+	}
+
+	user, ok := findUser(c, h.users, userID)
+	if !ok || notModified(c, user.Version) {
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, user)
+}
+
 // @Summary Delete a user
-// @Description Delete a user by ID
+// @Description Soft delete a user by ID: the user is hidden but can be restored, the user's tasks are kept
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param id path string true "User ID"
+// @Param If-Match header string false "ETag of the user the deletion is based on"
 // @Success 200 {object} ErrorResponse "User deleted successfully"
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
 // @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 412 {object} ErrorResponse "User has been changed"
 // @Failure 500 {object} ErrorResponse  "Failed to delete user"
-// @Router /user/{id} [delete]
-func DeleteUser(c *gin.Context) {
-	log.Println("Handling DeleteUser request")
-
+// @Router /users/{id} [delete]
+func (h *UserHandler) DeleteUser(c *gin.Context) {
 	// Extracting user ID from URL parameter
-	userID := c.Param("id")
-	log.Printf("User ID to delete: %s", userID)
+	userID, ok := parseUserID(c, "id")
+	if !ok {
+		return
+	}
+
+	user, ok := findUser(c, h.users, userID)
+	if !ok || !checkIfMatch(c, user.Version, "User has been changed") {
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Deleting user")
+
+	// Deleting the user unless it was changed since it was fetched
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		if err := h.users.Delete(ctx, userID, user.Version); err != nil {
+			return err
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditDelete, models.AuditEntityUser, userID, user, nil)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to delete user", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, repository.ErrVersionConflict):
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "User has been changed"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		}
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "User deleted")
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// @Summary Restore a user
+// @Description Restore a soft deleted user by ID
+// @Tags users
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 404 {object} ErrorResponse "Deleted user not found"
+// @Failure 500 {object} ErrorResponse "Failed to restore user"
+// @Router /users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	userID, ok := parseUserID(c, "id")
+	if !ok {
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Restoring user")
 
-	// Checking if user exists
 	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		log.Printf("User not found: %v", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		var err error
+		if user, err = h.users.Restore(ctx, userID); err != nil {
+			return err
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditRestore, models.AuditEntityUser, userID, nil, user)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to restore user", "error", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deleted user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore user"})
 		return
 	}
 
-	// Deleting the user
-	if err := database.DB.Delete(&user).Error; err != nil {
-		log.Printf("Error deleting user: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+	slog.InfoContext(c.Request.Context(), "User restored")
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, user)
+}
+
+// @Summary Purge a user
+// @Description Permanently remove a user by ID, soft deleted or not. The tasks parameter tells what happens to the user's tasks:
+// @Description keep refuses to purge a user who has tasks, archive moves them to the archive, delete deletes them.
+// @Tags users
+// @Produce  json
+// @Param id path string true "User ID"
+// @Param tasks query string false "What to do with the user's tasks" Enums(keep, archive, delete) default(keep)
+// @Success 200 {object} ErrorResponse "User purged successfully"
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 400 {object} ErrorResponse "Invalid tasks parameter"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "User has tasks"
+// @Failure 500 {object} ErrorResponse "Failed to purge user"
+// @Router /users/{id}/purge [delete]
+func (h *UserHandler) PurgeUser(c *gin.Context) {
+	userID, ok := parseUserID(c, "id")
+	if !ok {
+		return
+	}
+
+	policy := c.DefaultQuery("tasks", repository.TasksKeep)
+	switch policy {
+	case repository.TasksKeep, repository.TasksArchive, repository.TasksDelete:
+	default:
+		slog.InfoContext(c.Request.Context(), "Invalid tasks parameter", "tasks", policy)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tasks parameter"})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Purging user", "tasks", policy)
+
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		if err := h.users.Purge(ctx, userID, policy); err != nil {
+			return err
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditPurge, models.AuditEntityUser, userID, nil, nil)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to purge user", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, repository.ErrUserHasTasks):
+			c.JSON(http.StatusConflict, gin.H{"error": "User has tasks, purge with tasks=archive or tasks=delete"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge user"})
+		}
 		return
 	}
 
-	log.Println("User deleted successfully")
+	slog.InfoContext(c.Request.Context(), "User purged")
+	c.JSON(http.StatusOK, gin.H{"message": "User purged successfully"})
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+// UserRequest describes the fields of a user that clients can change.
+// PUT replaces all of them: the passport, the surname and the name are required, the missing optional fields are cleared
+// except the role and the manager, which are kept unless sent.
+// PATCH is a JSON merge patch (RFC 7396): only the fields sent are changed, null clears an optional field.
+type UserRequest struct {
+	PassportNumber string `json:"passport_number" example:"1234 567890"`
+	Surname        string `json:"surname"`
+	Name           string `json:"name"`
+	Patronymic     string `json:"patronymic"`
+	Address        string `json:"address"`
+	// Role is employee if it is cleared
+	Role      string `json:"role" enums:"admin,manager,employee"`
+	ManagerID *uint  `json:"manager_id"`
 }
 
-// @Summary Update a user
-// @Description Update a user by ID
+// mergePatchContentType is the media type of JSON merge patches
+const mergePatchContentType = "application/merge-patch+json"
+
+// @Summary Replace a user
+// @Description Replace the details of a user by ID, the missing optional fields are cleared.
+// @Description The role and the manager are kept unless sent, null clears them.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param id path string true "User ID"
-// @Param user body map[string]interface{} true "User data to update"
+// @Param user body UserRequest true "User"
+// @Param If-Match header string false "ETag of the user the change is based on"
 // @Success 200 {object} models.User
-// @Failure 400 {object} ErrorResponse "User not found"
-// @Failure 404 {object} ErrorResponse "Invalid JSON format"
+// @Failure 400 {object} ValidationErrorResponse "Invalid request body"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "User with this passport number already exists"
+// @Failure 412 {object} ErrorResponse "User has been changed"
 // @Failure 500 {object} ErrorResponse "Failed to update user"
-// @Router /user/{id} [put]
-func UpdateUser(c *gin.Context) {
-	log.Println("Handling UpdateUser request")
+// @Router /users/{id} [put]
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	h.updateUser(c, false)
+}
 
-	var user models.User
+// @Summary Patch a user
+// @Description Change some details of a user by ID with a JSON merge patch (RFC 7396):
+// @Description the fields sent are changed, null clears an optional field, the other fields are kept
+// @Tags users
+// @Accept  application/merge-patch+json
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Param user body UserRequest true "Fields to change"
+// @Param If-Match header string false "ETag of the user the change is based on"
+// @Success 200 {object} models.User
+// @Failure 400 {object} ValidationErrorResponse "Invalid request body"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "User with this passport number already exists"
+// @Failure 412 {object} ErrorResponse "User has been changed"
+// @Failure 415 {object} ErrorResponse "Unsupported content type"
+// @Failure 500 {object} ErrorResponse "Failed to update user"
+// @Router /users/{id} [patch]
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	if contentType := c.ContentType(); contentType != mergePatchContentType && contentType != "application/json" {
+		slog.InfoContext(c.Request.Context(), "Unsupported content type", "content_type", contentType)
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported content type, expected " + mergePatchContentType})
+		return
+	}
+	h.updateUser(c, true)
+}
 
-	// Extracting user ID from URL parameter
-	userID := c.Param("id")
-	log.Printf("User ID to update: %s", userID)
+// updateUser applies the fields of the request body to the user and returns the updated user.
+// A patch changes only the fields sent, otherwise all fields are replaced.
+// The change is based on the version of the user fetched, so concurrent changes are not overwritten.
+func (h *UserHandler) updateUser(c *gin.Context, patch bool) {
+	userID, ok := parseUserID(c, "id")
+	if !ok {
+		return
+	}
 
-	// Checking if user exists
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		log.Printf("User not found: %v", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	user, ok := findUser(c, h.users, userID)
+	if !ok || !checkIfMatch(c, user.Version, "User has been changed") {
 		return
 	}
+	before := user
 
-	// Binding JSON to the user structure
-	var newUserData map[string]interface{}
-	if err := c.ShouldBindJSON(&newUserData); err != nil {
-		log.Printf("Error binding JSON: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+	// The body must be a JSON object, its values are checked field by field
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&fields); err != nil || fields == nil {
+		slog.InfoContext(c.Request.Context(), "Invalid request body", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body, expected a JSON object"})
 		return
 	}
 
-	log.Printf("Updating user %s with data: %v", userID, newUserData)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	if !patch {
+		// The fields missing from a replacement are set to null, except the kept ones
+		for name, field := range userFields {
+			if _, ok := fields[name]; !ok && !field.kept {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
 
-	// Updating user's info
-	if err := database.DB.Model(&user).Updates(newUserData).Error; err != nil {
-		log.Printf("Error updating user: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user", "details": err.Error()})
+	var fieldErrors []FieldError
+	for _, name := range names {
+		if fieldError := setUserField(&user, name, fields[name]); fieldError != nil {
+			fieldErrors = append(fieldErrors, *fieldError)
+		}
+	}
+	if len(fieldErrors) == 0 {
+		fieldError, ok := h.checkManager(c, user)
+		if !ok {
+			return
+		}
+		if fieldError != nil {
+			fieldErrors = append(fieldErrors, *fieldError)
+		}
+	}
+	if len(fieldErrors) > 0 {
+		slog.InfoContext(c.Request.Context(), "Invalid user fields", "fields", fieldErrors)
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{Error: "Invalid request body", Fields: fieldErrors})
 		return
 	}
 
-	log.Println("User updated successfully")
+	slog.InfoContext(c.Request.Context(), "Updating user", "fields", names)
+	err := h.tx.Transaction(c.Request.Context(), func(ctx context.Context) error {
+		if err := h.users.Update(ctx, &user); err != nil {
+			return err
+		}
+		return recordAudit(ctx, c, h.audit, models.AuditUpdate, models.AuditEntityUser, userID, before, user)
+	})
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to update user", "error", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, repository.ErrDuplicate):
+			c.JSON(http.StatusConflict, gin.H{"error": "User with this passport number already exists"})
+		case errors.Is(err, repository.ErrVersionConflict):
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "User has been changed"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		}
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "User updated")
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, user)
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+// userField is a field of a user that clients can change
+type userField struct {
+	required  bool
+	maxLength int
+	// kept fields are not cleared by a replacement missing them, so that replacing the details doesn't change the permissions
+	kept bool
+	// set sets the trimmed non-empty value or clears the field if the value is empty
+	set func(user *models.User, value string) *FieldError
+	// setJSON sets a field that is not a string from its JSON value, nil if it is missing or null
+	setJSON func(user *models.User, value json.RawMessage) *FieldError
+}
+
+// userFields are the fields of a user that clients can change, by their JSON names
+var userFields = map[string]userField{
+	"passport_number": {required: true, set: func(user *models.User, value string) *FieldError {
+		if value == "" {
+			user.Passport = models.Passport{}
+			return nil
+		}
+		passport, err := models.ParsePassport(value)
+		if err != nil {
+			fieldError := passportFieldError("passport_number", err)
+			return &fieldError
+		}
+		user.Passport = passport
+		return nil
+	}},
+	"surname":    {required: true, maxLength: 255, set: setString(func(user *models.User) *string { return &user.Surname })},
+	"name":       {required: true, maxLength: 255, set: setString(func(user *models.User) *string { return &user.Name })},
+	"patronymic": {maxLength: 255, set: setString(func(user *models.User) *string { return &user.Patronymic })},
+	"address":    {maxLength: 1000, set: setString(func(user *models.User) *string { return &user.Address })},
+	"role":       {kept: true, set: setRole},
+	"manager_id": {kept: true, setJSON: func(user *models.User, value json.RawMessage) *FieldError {
+		var managerID *uint
+		if value != nil {
+			if err := json.Unmarshal(value, &managerID); err != nil || (managerID != nil && *managerID == 0) {
+				return &FieldError{Field: "manager_id", Code: "invalid_type", Message: "manager_id must be a user ID or null"}
+			}
+		}
+		user.ManagerID = managerID
+		return nil
+	}},
+}
+
+// setRole sets the role of the user, a cleared role is employee
+func setRole(user *models.User, value string) *FieldError {
+	switch {
+	case value == "":
+		user.Role = models.RoleEmployee
+	case models.ValidRole(value):
+		user.Role = value
+	default:
+		return &FieldError{Field: "role", Code: "invalid", Message: "role must be one of admin, manager, employee"}
+	}
+	return nil
+}
+
+func setString(field func(user *models.User) *string) func(user *models.User, value string) *FieldError {
+	return func(user *models.User, value string) *FieldError {
+		*field(user) = value
+		return nil
+	}
+}
+
+// setUserField sets the field of the user from its JSON value, a null or missing value clears it.
+// It returns the error if the field is unknown or the value is invalid.
+func setUserField(user *models.User, name string, value json.RawMessage) *FieldError {
+	field, ok := userFields[name]
+	if !ok {
+		return &FieldError{Field: name, Code: "unknown_field", Message: name + " is not a field that can be changed"}
+	}
+	if field.setJSON != nil {
+		return field.setJSON(user, value)
+	}
+
+	var text *string
+	if value != nil {
+		if err := json.Unmarshal(value, &text); err != nil {
+			return &FieldError{Field: name, Code: "invalid_type", Message: name + " must be a string or null"}
+		}
+	}
+	trimmed := ""
+	if text != nil {
+		trimmed = strings.TrimSpace(*text)
+	}
+
+	switch {
+	case trimmed == "" && field.required:
+		return &FieldError{Field: name, Code: "required", Message: name + " is required"}
+	case field.maxLength > 0 && utf8.RuneCountInString(trimmed) > field.maxLength:
+		return &FieldError{Field: name, Code: "too_long", Message: fmt.Sprintf("%s must be at most %d characters long", name, field.maxLength)}
+	}
+	return field.set(user, trimmed)
+}
+
+// checkManager checks that the manager of the user's team is another user with the manager or admin role.
+// It returns the field error if not. It writes an error response and returns false if the manager can't be fetched.
+func (h *UserHandler) checkManager(c *gin.Context, user models.User) (*FieldError, bool) {
+	if user.ManagerID == nil {
+		return nil, true
+	}
+	if *user.ManagerID == user.ID {
+		return &FieldError{Field: "manager_id", Code: "invalid", Message: "a user can't be their own manager"}, true
+	}
+
+	manager, err := h.users.GetByID(c.Request.Context(), *user.ManagerID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return &FieldError{Field: "manager_id", Code: "not_found", Message: "manager not found"}, true
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch manager", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch manager"})
+		return nil, false
+	case manager.Role != models.RoleManager && manager.Role != models.RoleAdmin:
+		return &FieldError{Field: "manager_id", Code: "not_manager", Message: "manager_id must be a user with the manager or admin role"}, true
+	}
+	return nil, true
+}
+
+// enrich fills in the missing details of the new user from the people info service.
+// It writes an error response and returns false if the details can't be fetched.
+func (h *UserHandler) enrich(c *gin.Context, user *models.User) bool {
+	if h.people == nil || (user.Surname != "" && user.Name != "") {
+		return true
+	}
+
+	slog.DebugContext(c.Request.Context(), "Fetching user details from the people info service")
+	person, err := h.people.Lookup(c.Request.Context(), user.Passport.Series, user.Passport.Number)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to fetch user details", "error", err)
+		if errors.Is(err, peopleinfo.ErrNotFound) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Person with this passport number not found"})
+			return false
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch user details"})
+		return false
+	}
+
+	// The details sent by the client take precedence
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&user.Surname, person.Surname)
+	fill(&user.Name, person.Name)
+	fill(&user.Patronymic, person.Patronymic)
+	fill(&user.Address, person.Address)
+	return true
+}
+
+// respondPassportError writes a 400 response with the field error of the invalid passport
+func respondPassportError(c *gin.Context, message, field string, err error) {
+	c.JSON(http.StatusBadRequest, ValidationErrorResponse{Error: message, Fields: []FieldError{passportFieldError(field, err)}})
+}
+
+// passportFieldError returns the field error of the invalid passport
+func passportFieldError(field string, err error) FieldError {
+	fieldError := FieldError{Field: field, Code: "invalid", Message: err.Error()}
+	var passportErr *models.PassportError
+	if errors.As(err, &passportErr) {
+		fieldError.Code = passportErr.Code
+		fieldError.Message = passportErr.Message
+	}
+	return fieldError
+}
+
+// findUser fetches the user by ID from the repository.
+// It writes an error response and returns false if there is no such user.
+func findUser(c *gin.Context, users repository.UserRepository, id uint) (models.User, bool) {
+	slog.DebugContext(c.Request.Context(), "Finding user")
+	user, err := users.GetByID(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			slog.InfoContext(c.Request.Context(), "User not found", "error", err)
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return models.User{}, false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch user", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// parseUserID reads the user ID from the URL parameter and adds it to the request's logs.
+// It writes a 400 response and returns false if the ID is invalid.
+func parseUserID(c *gin.Context, param string) (uint, bool) {
+	userID, ok := parseID(c, param, "Invalid user ID")
+	if ok {
+		logging.AddAttrs(c.Request.Context(), slog.Uint64("user_id", uint64(userID)))
+	}
+	return userID, ok
+}
+
+// parseID reads a numeric ID from the URL parameter.
+// It writes a 400 response with the message and returns false if the ID is invalid.
+func parseID(c *gin.Context, param, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 0)
+	if err != nil || id == 0 {
+		slog.InfoContext(c.Request.Context(), "Invalid parameter", "param", param, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// etag returns the entity tag of a record at the version
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// setETag sets the ETag header of the response to the version of the record sent
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", etag(version))
+}
+
+// checkIfMatch checks the If-Match header, if any, against the current version of the record.
+// It writes a 412 response with the message and returns false if the client's version is stale.
+func checkIfMatch(c *gin.Context, version int64, message string) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || matchETag(header, version, false) {
+		return true
+	}
+	slog.InfoContext(c.Request.Context(), "Stale If-Match", "if_match", header, "version", version)
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": message})
+	return false
+}
+
+// notModified checks the If-None-Match header against the current version of the record.
+// It writes a 304 response and returns true if the client already has the version.
+func notModified(c *gin.Context, version int64) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" || !matchETag(header, version, true) {
+		return false
+	}
+	setETag(c, version)
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// matchETag reports whether the header, a list of entity tags or "*", matches the version.
+// Weak tags match only with the weak comparison.
+func matchETag(header string, version int64, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	tag := etag(version)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
 }
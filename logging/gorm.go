@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// gormLogger writes GORM's logs to slog in the context of the query,
+// so that they carry the attributes of the request
+type gormLogger struct {
+	level         logger.LogLevel
+	slowThreshold time.Duration
+}
+
+// NewGormLogger returns a GORM logger writing to the default slog logger: failed queries as errors,
+// slow ones as warnings and the rest as debug records, if the level allows it.
+// Queries are logged with placeholders instead of the values, so no personal data gets into the logs.
+func NewGormLogger(level logger.LogLevel) logger.Interface {
+	return &gormLogger{level: level, slowThreshold: 200 * time.Millisecond}
+}
+
+func (l *gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	level, msg := slog.LevelDebug, "Query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		level, msg = slog.LevelError, "Query failed"
+	case elapsed > l.slowThreshold && l.level >= logger.Warn:
+		level, msg = slog.LevelWarn, "Slow query"
+	case l.level < logger.Info:
+		return
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("elapsed_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if level == slog.LevelError {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter drops the values of the query, GORM then logs the query with placeholders
+func (l *gormLogger) ParamsFilter(_ context.Context, sql string, _ ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Setup makes a logger writing JSON records to out the default one, for the standard log package too.
+// Records below the level are dropped.
+func Setup(out io.Writer, level slog.Leveler) {
+	slog.SetDefault(New(out, level))
+}
+
+// New returns a logger writing JSON records to out with the personal data masked
+// and the attributes of the request handled added from the context
+func New(out io.Writer, level slog.Leveler) *slog.Logger {
+	handler := slog.NewJSONHandler(NewWriter(out), &slog.HandlerOptions{Level: level, ReplaceAttr: replaceAttr})
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+// LevelFromEnv returns the level set in LOG_LEVEL: debug, info, warn or error, info by default
+func LevelFromEnv() (slog.Level, error) {
+	value := os.Getenv("LOG_LEVEL")
+	if value == "" {
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("invalid LOG_LEVEL %q", value)
+	}
+	return level, nil
+}
+
+// replaceAttr masks the sensitive attributes and the sensitive fields of the logged values
+func replaceAttr(_ []string, attr slog.Attr) slog.Attr {
+	if IsSensitive(attr.Key) {
+		return slog.String(attr.Key, Mask)
+	}
+	if attr.Value.Kind() == slog.KindAny {
+		return slog.Any(attr.Key, Redact(attr.Value.Any()))
+	}
+	return attr
+}
+
+type contextKey struct{}
+
+// requestAttrs are the attributes added to every record logged in the context of a request
+type requestAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+func (r *requestAttrs) get() []slog.Attr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]slog.Attr(nil), r.attrs...)
+}
+
+// WithAttrs returns a context whose records carry the attributes, and those added later with AddAttrs
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	if parent, ok := ctx.Value(contextKey{}).(*requestAttrs); ok {
+		attrs = append(parent.get(), attrs...)
+	}
+	return context.WithValue(ctx, contextKey{}, &requestAttrs{attrs: attrs})
+}
+
+// AddAttrs adds the attributes to the records of the context created by WithAttrs,
+// e.g. the user ID once the handler has parsed it. It does nothing for other contexts.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if request, ok := ctx.Value(contextKey{}).(*requestAttrs); ok {
+		request.mu.Lock()
+		request.attrs = append(request.attrs, attrs...)
+		request.mu.Unlock()
+	}
+}
+
+// RequestID returns the ID of the request handled in the context, empty if there is none
+func RequestID(ctx context.Context) string {
+	if request, ok := ctx.Value(contextKey{}).(*requestAttrs); ok {
+		for _, attr := range request.get() {
+			if attr.Key == "request_id" {
+				return attr.Value.String()
+			}
+		}
+	}
+	return ""
+}
+
+// contextHandler adds the attributes of the request to the records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if request, ok := ctx.Value(contextKey{}).(*requestAttrs); ok {
+		record.AddAttrs(request.get()...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// Fatal logs the error and exits, like log.Fatal does
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
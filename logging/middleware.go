@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID from the client and back in the response
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware gives every request an ID, taken from the X-Request-ID header or generated,
+// and returns it in the response. The request ID, the method and the route are added
+// to everything logged while handling the request, the user ID once the handler adds it.
+// When the request is handled, it is logged with its status and latency.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := WithAttrs(c.Request.Context(),
+			slog.String("request_id", requestID),
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+		)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		slog.LogAttrs(ctx, level, "Request handled",
+			slog.String("path", RedactURL(c.Request.URL.RequestURI())),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// validRequestID reports whether the request ID sent by the client can be used:
+// it must be short and printable so that it can't forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// RedactURL masks the values of the sensitive query parameters of the path
+func RedactURL(path string) string {
+	base, query, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		if name, _, ok := strings.Cut(param, "="); ok && IsSensitive(name) {
+			params[i] = name + "=" + Mask
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
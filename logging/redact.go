@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ananikitina/time-tracker/models"
+)
+
+// Mask replaces personal data in the logs
+const Mask = "[REDACTED]"
+
+// sensitiveFields are the names of the fields holding personal data,
+// in lower case without separators, so that passport_number and passportNumber both match
+var sensitiveFields = map[string]bool{
+	"passport":       true,
+	"passportnumber": true,
+	"passportserie":  true,
+	"passportseries": true,
+	"address":        true,
+}
+
+// IsSensitive reports whether the field or the parameter with the name holds personal data
+func IsSensitive(name string) bool {
+	name = strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+	return sensitiveFields[name]
+}
+
+// Redact returns a copy of the value safe to log: structs and maps become maps
+// with the sensitive fields masked, passports are masked wherever they are.
+// Fields hidden from JSON are left out, values that format themselves are kept as they are.
+func Redact(value interface{}) interface{} {
+	return redact(reflect.ValueOf(value))
+}
+
+func redact(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.CanInterface() {
+		switch value := v.Interface().(type) {
+		case models.Passport:
+			return Mask
+		case fmt.Stringer, error, json.Marshaler:
+			if v.Kind() != reflect.Pointer || !v.IsNil() {
+				return value
+			}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redact(v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			fields[name] = redactField(name, v.Field(i))
+		}
+		return fields
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		entries := make(map[string]interface{}, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			name := iter.Key().String()
+			entries[name] = redactField(name, iter.Value())
+		}
+		return entries
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("[%d bytes]", v.Len())
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = redact(v.Index(i))
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
+
+func redactField(name string, v reflect.Value) interface{} {
+	if IsSensitive(name) {
+		return Mask
+	}
+	return redact(v)
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"io"
+	"regexp"
+)
+
+// passportFieldPattern matches the values of the fields and parameters named after passports,
+// e.g. "passport_number":"4510890231", passportSerie=4510 and passport: 45 10 890231.
+// The name is kept, the value is masked.
+var passportFieldPattern = regexp.MustCompile(`(?i)(passport\w*\\?["']?\s*[:=]\s*\\?["']?)\d(?:[\d +\-]|%20)*\d`)
+
+// separatedPassportPattern matches passports written with separators, including URL encoded ones,
+// e.g. "1234 567890", "12 34 567890", "1234-567890" and "1234+567890". Passports written
+// without separators look like any other 10 digit number and are masked only next to their name.
+var separatedPassportPattern = regexp.MustCompile(`\b(?:\d{2}(?:[ +]|%20)\d{2}(?:[ +\-]|%20)?|\d{4}(?:[ +\-]|%20))\d{6}\b`)
+
+// writer masks passports in the log lines written to it
+type writer struct {
+	out io.Writer
+}
+
+// NewWriter returns a writer masking passport fields and separated passports before writing to out.
+// It is the last line of defence for the values that Redact doesn't see, e.g. in URLs and error messages.
+func NewWriter(out io.Writer) io.Writer {
+	return &writer{out: out}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	masked := passportFieldPattern.ReplaceAll(p, []byte("${1}"+Mask))
+	masked = separatedPassportPattern.ReplaceAll(masked, []byte(Mask))
+	if _, err := w.out.Write(masked); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
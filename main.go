@@ -1,9 +1,20 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"os"
 
+	// Time zones of the reports don't depend on the system time zone database
+	_ "time/tzdata"
+
+	"github.com/ananikitina/time-tracker/auth"
 	"github.com/ananikitina/time-tracker/database"
+	"github.com/ananikitina/time-tracker/encryption"
+	"github.com/ananikitina/time-tracker/logging"
+	"github.com/ananikitina/time-tracker/oidc"
+	"github.com/ananikitina/time-tracker/peopleinfo"
+	"github.com/ananikitina/time-tracker/repository"
 	"github.com/ananikitina/time-tracker/routes"
 
 	_ "github.com/ananikitina/time-tracker/docs"
@@ -29,29 +40,111 @@ import (
 // @host localhost:8080
 // @BasePath /
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key created with POST /api-keys or the api-keys command
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description HS256 JWT or personal access token as "Bearer <token>"
+
+// @security ApiKeyAuth
+// @security BearerAuth
+
 func main() {
+	// Structured logs with the personal data masked, the level is set from LOG_LEVEL once .env is loaded
+	var logLevel slog.LevelVar
+	logging.Setup(os.Stderr, &logLevel)
+	gin.DefaultWriter = logging.NewWriter(os.Stdout)
+	gin.DefaultErrorWriter = logging.NewWriter(os.Stderr)
+
 	// Load environment variables from .env file
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		logging.Fatal("Error loading .env file", "error", err)
+	}
+	level, err := logging.LevelFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to configure logging", "error", err)
+	}
+	logLevel.Set(level)
+
+	// Running a command instead of the server
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
+	passportKeys, err := encryption.KeyringFromEnv("PASSPORT")
+	if err != nil {
+		logging.Fatal("Failed to load passport encryption keys", "error", err)
 	}
 
 	database.Connect()
 	database.Migrate()
 
+	// Passports stored in plain text or under an old key are encrypted under the current key
+	encrypted, err := repository.EncryptPassports(repository.WithSystem(context.Background()), database.DB, passportKeys, false)
+	if err != nil {
+		logging.Fatal("Failed to encrypt passports", "error", err)
+	}
+	if encrypted > 0 {
+		slog.Info("Encrypted passports", "users", encrypted)
+	}
+
+	// People info service fills in the details of new users
+	peopleConfig, err := peopleinfo.ConfigFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to configure people info service", "error", err)
+	}
+	var people peopleinfo.Service
+	if peopleConfig.URL != "" {
+		people = peopleinfo.NewClient(peopleConfig)
+	} else {
+		slog.Info("PEOPLE_INFO_URL is not set, new users are saved as sent")
+	}
+
+	// JWT bearer tokens are accepted only if their signing key is configured, API keys and personal access tokens always
+	jwtConfig, err := auth.JWTConfigFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to configure JWT authentication", "error", err)
+	}
+	if len(jwtConfig.SigningKey) == 0 {
+		slog.Info("JWT_SIGNING_KEY is not set, JWT bearer tokens are not accepted")
+	}
+
+	// Users log in with the identity provider and get a bearer token signed with the JWT key
+	oidcConfig, err := oidc.ConfigFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to configure OpenID Connect login", "error", err)
+	}
+	var sso *oidc.Provider
+	if oidcConfig.IssuerURL != "" {
+		if len(jwtConfig.SigningKey) == 0 {
+			logging.Fatal("OIDC_ISSUER_URL requires JWT_SIGNING_KEY to issue tokens")
+		}
+		sso = oidc.NewProvider(oidcConfig, jwtConfig.SigningKey)
+	} else {
+		slog.Info("OIDC_ISSUER_URL is not set, logging in with an identity provider is disabled")
+	}
+
 	// Gin initialization
-	r := gin.Default()
+	r := gin.New()
+	r.Use(logging.Middleware(), gin.Recovery())
 
 	// Routes registration
-	routes.SetupRouter(r)
+	repos := repository.NewPostgres(database.DB, passportKeys)
+	routes.SetupRouter(r, repos, people, auth.NewAuthenticator(repos.APIKeys, repos.Tokens, repos.Users, jwtConfig), sso)
 
 	// Swagger endpoint
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// Starting the server
 	port := ":8080"
-	log.Printf("Starting server on port %s", port)
+	slog.Info("Starting server", "port", port)
 	if err := r.Run(port); err != nil {
-		log.Fatalf("Failed to run server: %v", err)
+		logging.Fatal("Failed to run server", "error", err)
 	}
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// APIKey authenticates scripts and services calling the API.
+// Only the hash of the key is stored, the key itself is shown once when it is created.
+type APIKey struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"column:name;not null"`
+	// OrganizationID is the organization the key administers
+	OrganizationID uint `json:"organization_id" gorm:"column:organization_id;not null"`
+	// Prefix is the start of the key to tell the keys apart
+	Prefix    string     `json:"prefix" gorm:"column:prefix;not null"`
+	Hash      string     `json:"-" gorm:"column:hash;not null;uniqueIndex"`
+	CreatedAt time.Time  `json:"created_at" gorm:"column:created_at;not null"`
+	RevokedAt *time.Time `json:"revoked_at" gorm:"column:revoked_at"`
+}
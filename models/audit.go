@@ -0,0 +1,155 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Audited entity types
+const (
+	AuditEntityUser  = "user"
+	AuditEntityTask  = "task"
+	AuditEntityToken = "personal_access_token"
+)
+
+// Audited actions
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+	AuditStart   = "start"
+	AuditFinish  = "finish"
+	AuditPause   = "pause"
+	AuditResume  = "resume"
+	AuditRevoke  = "revoke"
+)
+
+// AuditEntry records who changed a user, a task or a personal access token, how and when.
+// Entries are only ever added, never changed or deleted.
+type AuditEntry struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;not null"`
+	// OrganizationID is the organization whose data changed
+	OrganizationID uint   `json:"organization_id" gorm:"column:organization_id;not null"`
+	Actor          string `json:"actor" gorm:"column:actor;not null"`
+	Action         string `json:"action" gorm:"column:action;not null"`
+	EntityType     string `json:"entity_type" gorm:"column:entity_type;not null"`
+	EntityID       uint   `json:"entity_id" gorm:"column:entity_id;not null"`
+	// Changes are the changed fields of the entity by their JSON names
+	Changes   map[string]AuditChange `json:"changes" gorm:"column:changes;type:jsonb;serializer:json;not null"`
+	RequestID string                 `json:"request_id" gorm:"column:request_id;not null;default:''"`
+
+	// PrevHash is the hash of the previous entry, Hash chains this entry to it
+	PrevHash string `json:"prev_hash" gorm:"column:prev_hash;not null;default:''"`
+	Hash     string `json:"hash" gorm:"column:hash;not null;default:''"`
+	// HashVersion is the version of the hashed content, entries of version 1 leave the organization out
+	// and entries of version 0, recorded before the chain existed, have no hash
+	HashVersion int `json:"hash_version" gorm:"column:hash_version;not null;default:1"`
+}
+
+// TaskRevision is a state of a finished task, or its deletion, chained like the audit log
+// to prove the time entries were not changed afterwards without a trace
+type TaskRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;not null"`
+	// OrganizationID is the organization of the user of the task
+	OrganizationID uint `json:"organization_id" gorm:"column:organization_id;not null"`
+	TaskID         uint `json:"task_id" gorm:"column:task_id;not null"`
+	UserID         uint `json:"user_id" gorm:"column:user_id;not null"`
+	Deleted        bool `json:"deleted" gorm:"column:deleted;not null;default:false"`
+	// Task is the JSON form of the task as the API returns it
+	Task map[string]interface{} `json:"task" gorm:"column:task;type:jsonb;serializer:json;not null"`
+
+	PrevHash string `json:"prev_hash" gorm:"column:prev_hash;not null;default:''"`
+	Hash     string `json:"hash" gorm:"column:hash;not null"`
+	// HashVersion is the version of the hashed content, revisions of version 1 leave the organization out
+	HashVersion int `json:"hash_version" gorm:"column:hash_version;not null;default:1"`
+}
+
+// NewTaskRevision returns the revision of the task
+func NewTaskRevision(task Task, deleted bool) (TaskRevision, error) {
+	fields, err := jsonFields(task)
+	if err != nil {
+		return TaskRevision{}, err
+	}
+	return TaskRevision{TaskID: task.ID, UserID: task.UserID, Deleted: deleted, Task: fields}, nil
+}
+
+// Hash chains
+const (
+	ChainAudit         = "audit"
+	ChainTaskRevisions = "task_revisions"
+)
+
+// ChainVerification is the result of walking a hash chain.
+// Every organization has its own chain of the audit entries and of the task revisions.
+type ChainVerification struct {
+	Chain          string `json:"chain"`
+	OrganizationID uint   `json:"organization_id"`
+	// Checked is the number of records checked up to the first broken link
+	Checked int  `json:"checked"`
+	Valid   bool `json:"valid"`
+	// BrokenID is the ID of the first record that doesn't match its hash or the previous record
+	BrokenID uint   `json:"broken_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	// Head is the hash of the last checked record. The chain is not keyed, so a rewrite of the whole chain
+	// is only detected by comparing its head with one kept outside the database.
+	Head string `json:"head,omitempty"`
+}
+
+// AuditChange is the value of a field before and after the change, null if the field didn't exist
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditDiff returns the fields that differ between the JSON forms of the entity before and after the change.
+// A nil entity has no fields, so creations and deletions list all fields. The version is bookkeeping and is left out.
+func AuditDiff(before, after interface{}) (map[string]AuditChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]AuditChange)
+	for name, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[name]) {
+			changes[name] = AuditChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok && value != nil {
+			changes[name] = AuditChange{After: value}
+		}
+	}
+	for name := range changes {
+		if strings.EqualFold(name, "version") {
+			delete(changes, name)
+		}
+	}
+	return changes, nil
+}
+
+// jsonFields returns the top level fields of the JSON form of the value
+func jsonFields(value interface{}) (map[string]interface{}, error) {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Pointer && reflect.ValueOf(value).IsNil()) {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
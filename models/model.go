@@ -1,20 +1,197 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User roles
+const (
+	// RoleAdmin manages users and may do everything
+	RoleAdmin = "admin"
+	// RoleManager tracks their own time and reads the tasks and reports of their team
+	RoleManager = "manager"
+	// RoleEmployee tracks their own time only
+	RoleEmployee = "employee"
+)
+
+// ValidRole reports whether the role is one of the user roles
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleManager || role == RoleEmployee
+}
 
 type User struct {
-	ID             uint   `gorm:"primaryKey"`
-	PassportNumber string `json:"passport_number" gorm:"column:passport_number;unique;not null"`
-	Surname        string `json:"surname" gorm:"column:surname"`
-	Name           string `json:"name" gorm:"column:name"`
-	Patronymic     string `json:"patronymic" gorm:"column:patronymic"`
-	Address        string `json:"address" gorm:"column:address"`
+	ID             uint     `gorm:"primaryKey"`
+	OrganizationID uint     `json:"organization_id" gorm:"column:organization_id;not null"`
+	Passport       Passport `json:"passport_number" gorm:"-" swaggertype:"string" example:"1234 567890"`
+	Surname        string   `json:"surname" gorm:"column:surname"`
+	Name           string   `json:"name" gorm:"column:name"`
+	Patronymic     string   `json:"patronymic" gorm:"column:patronymic"`
+	Address        string   `json:"address" gorm:"column:address"`
+	Role           string   `json:"role" gorm:"column:role;not null;default:employee" enums:"admin,manager,employee"`
+	// ManagerID is the manager of the user's team, nil if the user is not in a team
+	ManagerID *uint `json:"manager_id" gorm:"column:manager_id"`
+	// OIDCSubject is the subject of the user at the identity provider, nil until the user logs in with it
+	OIDCSubject *string `json:"oidc_subject,omitempty" gorm:"column:oidc_subject"`
+
+	// The passport is stored encrypted, the blind index allows finding users by passport.
+	// The PostgreSQL repository fills these in from Passport and back.
+	PassportCiphertext []byte `json:"-" gorm:"column:passport_ciphertext"`
+	PassportKeyID      string `json:"-" gorm:"column:passport_key_id"`
+	PassportIndex      string `json:"-" gorm:"column:passport_index"`
+
+	// DeletedAt is set when the user is soft deleted, such users are hidden unless asked for
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"column:deleted_at;index" swaggertype:"string" format:"date-time"`
+	// Version is incremented on every change, it is the ETag of the user
+	Version int64 `json:"version" gorm:"column:version;not null;default:1"`
 }
 
 type Task struct {
+	ID          uint        `gorm:"primaryKey;autoIncrement"`
+	UserID      uint        `gorm:"not null"`
+	TaskName    string      `gorm:"not null"`
+	Description string      `gorm:"not null;default:''"`
+	ProjectID   *uint       `gorm:"default:null"`
+	Tags        []string    `gorm:"type:jsonb;serializer:json"`
+	StartTime   time.Time   `gorm:"not null"`
+	EndTime     *time.Time  `gorm:"default:null"`
+	Breaks      []TaskBreak `gorm:"foreignKey:TaskID"`
+	// Version is incremented on every change of the task or its breaks, it is the ETag of the task
+	Version int64 `gorm:"not null;default:1"`
+}
+
+// Project groups the tasks done for the same client work
+type Project struct {
+	ID             uint   `gorm:"primaryKey"`
+	OrganizationID uint   `json:"organization_id" gorm:"column:organization_id;not null"`
+	Name           string `json:"name" gorm:"column:name;not null"`
+	Client         string `json:"client" gorm:"column:client;not null;default:''"`
+	Color          string `json:"color" gorm:"column:color;not null;default:''"`
+	Archived       bool   `json:"archived" gorm:"column:archived;not null;default:false"`
+}
+
+// TaskBreak is a pause in a task, it has no end time while the task is paused
+type TaskBreak struct {
 	ID        uint       `gorm:"primaryKey;autoIncrement"`
-	UserID    uint       `gorm:"not null"`
-	TaskName  string     `gorm:"not null"`
+	TaskID    uint       `gorm:"not null"`
 	StartTime time.Time  `gorm:"not null"`
 	EndTime   *time.Time `gorm:"default:null"`
 }
+
+// Finish sets the end time of the task, but not earlier than its start.
+// An unfinished break ends together with the task.
+func (t *Task) Finish(at time.Time) {
+	if at.Before(t.StartTime) {
+		at = t.StartTime
+	}
+	t.EndTime = &at
+
+	for i := range t.Breaks {
+		if t.Breaks[i].EndTime == nil {
+			end := at
+			if end.Before(t.Breaks[i].StartTime) {
+				end = t.Breaks[i].StartTime
+			}
+			t.Breaks[i].EndTime = &end
+		}
+	}
+}
+
+// Paused reports whether the task has an unfinished break
+func (t Task) Paused() bool {
+	for _, taskBreak := range t.Breaks {
+		if taskBreak.EndTime == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Duration returns the time worked on the task excluding breaks.
+// An unfinished task lasts until now.
+func (t Task) Duration(now time.Time) time.Duration {
+	end := now
+	if t.EndTime != nil {
+		end = *t.EndTime
+	}
+	return t.WorkedWithin(t.StartTime, end, now)
+}
+
+// WorkedWithin returns the time worked on the task within the period excluding breaks.
+// An unfinished task lasts until now, an unfinished break lasts until the end of the task.
+func (t Task) WorkedWithin(from, to, now time.Time) time.Duration {
+	end := now
+	if t.EndTime != nil {
+		end = *t.EndTime
+	}
+
+	worked := overlap(t.StartTime, end, from, to)
+	for _, taskBreak := range t.Breaks {
+		breakEnd := end
+		if taskBreak.EndTime != nil {
+			breakEnd = *taskBreak.EndTime
+		}
+		worked -= overlap(taskBreak.StartTime, breakEnd, from, to)
+	}
+
+	if worked < 0 {
+		return 0
+	}
+	return worked
+}
+
+// overlap returns how long the intervals [start1, end1) and [start2, end2) overlap
+func overlap(start1, end1, start2, end2 time.Time) time.Duration {
+	if start2.After(start1) {
+		start1 = start2
+	}
+	if end2.Before(end1) {
+		end1 = end2
+	}
+	if !end1.After(start1) {
+		return 0
+	}
+	return end1.Sub(start1)
+}
+
+// TaskWorkload is the time a user spent on one task or project over a period
+type TaskWorkload struct {
+	Task         string `json:"task,omitempty"`
+	ProjectID    *uint  `json:"project_id,omitempty"`
+	Project      string `json:"project,omitempty"`
+	Hours        int64  `json:"hours"`
+	Minutes      int64  `json:"minutes"`
+	TotalSeconds int64  `json:"total_seconds"`
+}
+
+// SetTotal sets the total time and splits it into hours and minutes
+func (w *TaskWorkload) SetTotal(seconds int64) {
+	w.TotalSeconds = seconds
+	w.Hours = seconds / 3600
+	w.Minutes = seconds % 3600 / 60
+}
+
+// TimeReportRow is the time worked in one group of a team report.
+// GroupedBy lists the dimensions of the group, the others are omitted:
+// a row with fewer dimensions than the report is a subtotal, a row without any is the grand total.
+type TimeReportRow struct {
+	GroupedBy    []string `json:"grouped_by" gorm:"-"`
+	UserID       *uint    `json:"user_id,omitempty"`
+	User         string   `json:"user,omitempty"`
+	Day          string   `json:"day,omitempty"`
+	Week         string   `json:"week,omitempty"`
+	Task         string   `json:"task,omitempty"`
+	ProjectID    *uint    `json:"project_id,omitempty"`
+	Project      string   `json:"project,omitempty"`
+	Hours        int64    `json:"hours"`
+	Minutes      int64    `json:"minutes"`
+	TotalSeconds int64    `json:"total_seconds"`
+}
+
+// SetTotal sets the total time and splits it into hours and minutes
+func (r *TimeReportRow) SetTotal(seconds int64) {
+	r.TotalSeconds = seconds
+	r.Hours = seconds / 3600
+	r.Minutes = seconds % 3600 / 60
+}
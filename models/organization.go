@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DefaultOrganizationID is the organization the data created before there were organizations belongs to
+const DefaultOrganizationID = 1
+
+// Organization is a tenant of the service. Its users, their tasks, its projects, API keys
+// and audit log are invisible to the other organizations.
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"column:name;not null;uniqueIndex"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;not null"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Passport is a Russian passport: a series of 4 digits and a number of 6 digits.
+// Its canonical form is "1234 567890".
+type Passport struct {
+	Series string
+	Number string
+}
+
+// Passport error codes
+const (
+	PassportRequired         = "required"
+	PassportInvalidCharacter = "invalid_character"
+	PassportInvalidLength    = "invalid_length"
+)
+
+// PassportError tells why a passport can't be parsed
+type PassportError struct {
+	Code    string
+	Message string
+}
+
+func (e *PassportError) Error() string {
+	return "invalid passport: " + e.Message
+}
+
+// ParsePassport parses a passport written with or without spaces and dashes,
+// e.g. "1234 567890", "1234567890", "12 34 567890" or "1234-567890".
+// It returns a *PassportError if the value is not a passport.
+func ParsePassport(value string) (Passport, error) {
+	var digits strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '\t':
+		default:
+			return Passport{}, &PassportError{
+				Code:    PassportInvalidCharacter,
+				Message: "passport may contain only digits, spaces and dashes",
+			}
+		}
+	}
+
+	switch digits.Len() {
+	case 0:
+		return Passport{}, &PassportError{Code: PassportRequired, Message: "passport is required"}
+	case 10:
+		return Passport{Series: digits.String()[:4], Number: digits.String()[4:]}, nil
+	default:
+		return Passport{}, &PassportError{
+			Code:    PassportInvalidLength,
+			Message: "passport must have 10 digits: 4 of the series and 6 of the number",
+		}
+	}
+}
+
+// String returns the passport in the canonical form
+func (p Passport) String() string {
+	return p.Series + " " + p.Number
+}
+
+// IsZero reports whether the passport is not set
+func (p Passport) IsZero() bool {
+	return p == Passport{}
+}
+
+func (p Passport) MarshalJSON() ([]byte, error) {
+	if p.IsZero() {
+		return []byte(`""`), nil
+	}
+	return json.Marshal(p.String())
+}
+
+func (p *Passport) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	passport, err := ParsePassport(value)
+	if err != nil {
+		return err
+	}
+	*p = passport
+	return nil
+}
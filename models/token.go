@@ -0,0 +1,44 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Scopes of the personal access tokens, a token may only be used for the routes of its scopes
+const (
+	ScopeTasksRead   = "tasks:read"
+	ScopeTasksWrite  = "tasks:write"
+	ScopeReportsRead = "reports:read"
+)
+
+// Scopes are all scopes a token may have
+var Scopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeReportsRead}
+
+// ValidScope reports whether the scope is one of the token scopes
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// PersonalAccessToken lets scripts and widgets act for one user with limited scopes.
+// Only the hash of the token is stored, the token itself is shown once when it is created.
+type PersonalAccessToken struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	UserID uint   `json:"user_id" gorm:"column:user_id;not null;index"`
+	Name   string `json:"name" gorm:"column:name;not null"`
+	// Prefix is the start of the token to tell the tokens apart
+	Prefix string   `json:"prefix" gorm:"column:prefix;not null"`
+	Hash   string   `json:"-" gorm:"column:hash;not null;uniqueIndex"`
+	Scopes []string `json:"scopes" gorm:"column:scopes;type:jsonb;not null;serializer:json" enums:"tasks:read,tasks:write,reports:read"`
+	// ExpiresAt is when the token stops working, nil if it never expires
+	ExpiresAt *time.Time `json:"expires_at" gorm:"column:expires_at"`
+	// LastUsedAt is when the token was last used, nil if it never was
+	LastUsedAt *time.Time `json:"last_used_at" gorm:"column:last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"column:created_at;not null"`
+	RevokedAt  *time.Time `json:"revoked_at" gorm:"column:revoked_at"`
+}
+
+// Expired reports whether the token has expired at the time
+func (t PersonalAccessToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
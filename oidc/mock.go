@@ -0,0 +1,269 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// MockIdentity is a person the mock provider can log in
+type MockIdentity struct {
+	Subject    string
+	Email      string
+	GivenName  string
+	FamilyName string
+	MiddleName string
+	Address    string
+	// Passport is sent in the passport_number claim
+	Passport string
+}
+
+// MockIdentities are the people the mock provider knows by default, the first one is logged in without a login_hint
+var MockIdentities = []MockIdentity{
+	{
+		Subject:    "ivanov",
+		Email:      "ivanov@example.com",
+		GivenName:  "Иван",
+		FamilyName: "Иванов",
+		MiddleName: "Иванович",
+		Address:    "г. Москва, ул. Ленина, д. 5, кв. 1",
+		Passport:   "1234 567890",
+	},
+	{
+		Subject:    "petrova",
+		Email:      "petrova@example.com",
+		GivenName:  "Анна",
+		FamilyName: "Петрова",
+		Address:    "г. Санкт-Петербург, Невский пр., д. 10",
+		Passport:   "4321 098765",
+	},
+}
+
+// MockClient is the client registered at the mock provider
+type MockClient struct {
+	ID     string
+	Secret string
+}
+
+// mockKeyID is the key ID of the mock provider's only signing key
+const mockKeyID = "mock-1"
+
+// mockCode is an issued authorization code
+type mockCode struct {
+	identity    MockIdentity
+	redirectURI string
+	nonce       string
+	challenge   string
+	expiresAt   time.Time
+}
+
+// NewMock returns a handler acting as an OpenID Connect provider for testing without a real one.
+// The authorization endpoint logs in the identity named by the login_hint parameter without asking anything.
+// The issuer is the URL the mock is requested at.
+func NewMock(client MockClient, identities []MockIdentity) (http.Handler, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	codes := make(map[string]mockCode)
+	issuer := func(r *http.Request) string {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		return scheme + "://" + r.Host
+	}
+	writeJSON := func(w http.ResponseWriter, r *http.Request, status int, value interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(value); err != nil {
+			slog.ErrorContext(r.Context(), "OIDC mock: failed to write response", "error", err)
+		}
+	}
+	tokenError := func(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+		slog.InfoContext(r.Context(), "OIDC mock: token request rejected", "error", code, "description", description)
+		writeJSON(w, r, status, map[string]string{"error": code, "error_description": description})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		base := issuer(r)
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{
+			"issuer":                                base,
+			"authorization_endpoint":                base + "/authorize",
+			"token_endpoint":                        base + "/token",
+			"jwks_uri":                              base + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": mockKeyID,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		redirectURI := query.Get("redirect_uri")
+		target, err := url.Parse(redirectURI)
+		if err != nil || redirectURI == "" || query.Get("client_id") != client.ID {
+			http.Error(w, "unknown client or redirect_uri", http.StatusBadRequest)
+			return
+		}
+
+		params := target.Query()
+		params.Set("state", query.Get("state"))
+		redirect := func() {
+			target.RawQuery = params.Encode()
+			http.Redirect(w, r, target.String(), http.StatusFound)
+		}
+		if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+			params.Set("error", "invalid_request")
+			redirect()
+			return
+		}
+
+		var identity *MockIdentity
+		for i := range identities {
+			if hint := query.Get("login_hint"); hint == "" || hint == identities[i].Subject {
+				identity = &identities[i]
+				break
+			}
+		}
+		if identity == nil {
+			params.Set("error", "access_denied")
+			redirect()
+			return
+		}
+
+		code, err := randomString()
+		if err != nil {
+			http.Error(w, "failed to issue code", http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		codes[code] = mockCode{
+			identity:    *identity,
+			redirectURI: redirectURI,
+			nonce:       query.Get("nonce"),
+			challenge:   query.Get("code_challenge"),
+			expiresAt:   time.Now().Add(time.Minute),
+		}
+		mu.Unlock()
+		params.Set("code", code)
+		redirect()
+	})
+
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			tokenError(w, r, http.StatusBadRequest, "invalid_request", "malformed form")
+			return
+		}
+		id, secret, ok := r.BasicAuth()
+		if ok {
+			id, _ = url.QueryUnescape(id)
+			secret, _ = url.QueryUnescape(secret)
+		} else {
+			id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		if id != client.ID || secret != client.Secret {
+			tokenError(w, r, http.StatusUnauthorized, "invalid_client", "unknown client or wrong secret")
+			return
+		}
+		if r.PostForm.Get("grant_type") != "authorization_code" {
+			tokenError(w, r, http.StatusBadRequest, "unsupported_grant_type", "only authorization_code is supported")
+			return
+		}
+
+		// Codes are used once
+		mu.Lock()
+		code, ok := codes[r.PostForm.Get("code")]
+		delete(codes, r.PostForm.Get("code"))
+		mu.Unlock()
+		switch {
+		case !ok || time.Now().After(code.expiresAt):
+			tokenError(w, r, http.StatusBadRequest, "invalid_grant", "unknown or expired code")
+			return
+		case r.PostForm.Get("redirect_uri") != code.redirectURI:
+			tokenError(w, r, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+			return
+		case codeChallenge(r.PostForm.Get("code_verifier")) != code.challenge:
+			tokenError(w, r, http.StatusBadRequest, "invalid_grant", "code_verifier does not match")
+			return
+		}
+
+		now := time.Now()
+		idToken, err := signRS256(key, map[string]interface{}{
+			"iss":             issuer(r),
+			"sub":             code.identity.Subject,
+			"aud":             client.ID,
+			"exp":             now.Add(5 * time.Minute).Unix(),
+			"iat":             now.Unix(),
+			"nonce":           code.nonce,
+			"email":           code.identity.Email,
+			"given_name":      code.identity.GivenName,
+			"family_name":     code.identity.FamilyName,
+			"middle_name":     code.identity.MiddleName,
+			"address":         map[string]string{"formatted": code.identity.Address},
+			"passport_number": code.identity.Passport,
+		})
+		if err != nil {
+			tokenError(w, r, http.StatusInternalServerError, "server_error", "failed to sign ID token")
+			return
+		}
+		accessToken, err := randomString()
+		if err != nil {
+			tokenError(w, r, http.StatusInternalServerError, "server_error", "failed to issue access token")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     idToken,
+		})
+	})
+	return mux, nil
+}
+
+// signRS256 returns a JWT with the claims signed with the key
+func signRS256(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": mockKeyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,488 @@
+// Package oidc logs users in with an OpenID Connect identity provider using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+)
+
+var (
+	// ErrUnavailable is returned when the identity provider can't be reached or fails
+	ErrUnavailable = errors.New("identity provider is unavailable")
+	// ErrInvalidToken is returned for ID tokens that are not signed by the provider or not meant for the service
+	ErrInvalidToken = errors.New("invalid ID token")
+	// ErrLoginFailed is returned when the provider refuses to exchange the code
+	ErrLoginFailed = errors.New("login failed")
+)
+
+// Config describes the identity provider and how its users become users of the service
+type Config struct {
+	// IssuerURL is the issuer of the provider, its configuration is discovered from it.
+	// An empty URL means logging in with the provider is disabled.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback of the service the provider sends the user back to
+	RedirectURL string
+	// CreateUsers creates the users logging in for the first time, otherwise they must exist
+	CreateUsers bool
+	// LinkByPassport links the users logging in for the first time to the existing users with their passport.
+	// Only employees not linked to another identity yet are linked, managers and admins never are.
+	LinkByPassport bool
+	// OrganizationID is the organization the users are found in and created in, the default one if it is zero
+	OrganizationID uint
+	// PassportClaim is the claim holding the passport series and number
+	PassportClaim string
+	// SessionTTL is how long the token issued after logging in is valid
+	SessionTTL time.Duration
+	Timeout    time.Duration
+}
+
+// ConfigFromEnv reads the configuration from the OIDC_* environment variables
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		IssuerURL:      strings.TrimSuffix(os.Getenv("OIDC_ISSUER_URL"), "/"),
+		ClientID:       os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:   os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:    os.Getenv("OIDC_REDIRECT_URL"),
+		PassportClaim:  "passport_number",
+		OrganizationID: models.DefaultOrganizationID,
+		SessionTTL:     8 * time.Hour,
+		Timeout:        10 * time.Second,
+	}
+
+	var err error
+	if value := os.Getenv("OIDC_CREATE_USERS"); value != "" {
+		if config.CreateUsers, err = strconv.ParseBool(value); err != nil {
+			return Config{}, fmt.Errorf("invalid OIDC_CREATE_USERS %q", value)
+		}
+	}
+	if value := os.Getenv("OIDC_LINK_BY_PASSPORT"); value != "" {
+		if config.LinkByPassport, err = strconv.ParseBool(value); err != nil {
+			return Config{}, fmt.Errorf("invalid OIDC_LINK_BY_PASSPORT %q", value)
+		}
+	}
+	if value := os.Getenv("OIDC_ORGANIZATION_ID"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 0)
+		if err != nil || id == 0 {
+			return Config{}, fmt.Errorf("invalid OIDC_ORGANIZATION_ID %q", value)
+		}
+		config.OrganizationID = uint(id)
+	}
+	if value := os.Getenv("OIDC_PASSPORT_CLAIM"); value != "" {
+		config.PassportClaim = value
+	}
+	if value := os.Getenv("OIDC_SESSION_TTL"); value != "" {
+		if config.SessionTTL, err = time.ParseDuration(value); err != nil || config.SessionTTL <= 0 {
+			return Config{}, fmt.Errorf("invalid OIDC_SESSION_TTL %q", value)
+		}
+	}
+	if config.IssuerURL != "" && (config.ClientID == "" || config.RedirectURL == "") {
+		return Config{}, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER_URL")
+	}
+	return config, nil
+}
+
+// Identity is the person the provider logged in, taken from the claims of the ID token
+type Identity struct {
+	Subject    string
+	Email      string
+	GivenName  string
+	FamilyName string
+	MiddleName string
+	Address    string
+	// Passport is the value of the passport claim, empty if the provider doesn't send it
+	Passport string
+}
+
+// User returns a new user with the details of the identity.
+// It returns an error if the identity has no valid passport, which every user must have.
+func (i Identity) User() (models.User, error) {
+	if i.Passport == "" {
+		return models.User{}, errors.New("identity has no passport")
+	}
+	passport, err := models.ParsePassport(i.Passport)
+	if err != nil {
+		return models.User{}, err
+	}
+	subject := i.Subject
+	return models.User{
+		Passport:    passport,
+		Surname:     i.FamilyName,
+		Name:        i.GivenName,
+		Patronymic:  i.MiddleName,
+		Address:     i.Address,
+		Role:        models.RoleEmployee,
+		OIDCSubject: &subject,
+	}, nil
+}
+
+// Login is what the service remembers between sending the user to the provider and the callback
+type Login struct {
+	State string `json:"state"`
+	Nonce string `json:"nonce"`
+	// Verifier is the PKCE code verifier
+	Verifier  string `json:"verifier"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// NewLogin returns a login with random state, nonce and code verifier
+func NewLogin() (Login, error) {
+	values := make([]string, 3)
+	for i := range values {
+		value, err := randomString()
+		if err != nil {
+			return Login{}, err
+		}
+		values[i] = value
+	}
+	return Login{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// Provider talks to the identity provider. Its configuration and keys are fetched on first use.
+type Provider struct {
+	config Config
+	http   *http.Client
+	// stateKey signs the logins kept in the browser between the redirects
+	stateKey []byte
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]*rsa.PublicKey
+}
+
+// discovery is the part of the provider configuration the service uses
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewProvider(config Config, stateKey []byte) *Provider {
+	// Users are never looked up in all organizations
+	if config.OrganizationID == 0 {
+		config.OrganizationID = models.DefaultOrganizationID
+	}
+	return &Provider{config: config, http: &http.Client{Timeout: config.Timeout}, stateKey: stateKey}
+}
+
+// Config returns the configuration of the provider
+func (p *Provider) Config() Config {
+	return p.config
+}
+
+// loginTTL is how long the user has to log in with the provider
+const loginTTL = 10 * time.Minute
+
+// SealLogin returns the login signed with the state key to keep in a cookie until the callback
+func (p *Provider) SealLogin(login Login, now time.Time) (string, error) {
+	login.ExpiresAt = now.Add(loginTTL).Unix()
+	payload, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + p.signState(encoded), nil
+}
+
+// OpenLogin checks the signature and the expiry time of the sealed login and returns it
+func (p *Provider) OpenLogin(sealed string, now time.Time) (Login, error) {
+	encoded, signature, _ := strings.Cut(sealed, ".")
+	if !hmac.Equal([]byte(p.signState(encoded)), []byte(signature)) {
+		return Login{}, errors.New("login state is not signed by the service")
+	}
+	var login Login
+	if err := decodeSegment(encoded, &login); err != nil {
+		return Login{}, fmt.Errorf("malformed login state: %w", err)
+	}
+	if now.After(time.Unix(login.ExpiresAt, 0)) {
+		return Login{}, errors.New("login state expired")
+	}
+	return login, nil
+}
+
+// signState returns the HMAC-SHA256 signature of the encoded login
+func (p *Provider) signState(encoded string) string {
+	mac := hmac.New(sha256.New, p.stateKey)
+	mac.Write([]byte("oidc-login." + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// AuthCodeURL returns the URL of the provider's login page for the login
+func (p *Provider) AuthCodeURL(ctx context.Context, login Login) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", "openid profile email address")
+	query.Set("state", login.State)
+	query.Set("nonce", login.Nonce)
+	query.Set("code_challenge", codeChallenge(login.Verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for the ID token of the login and returns its identity
+func (p *Provider) Exchange(ctx context.Context, code string, login Login) (Identity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", login.Verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&token)
+	switch {
+	case resp.StatusCode >= 500:
+		return Identity{}, fmt.Errorf("%w: token endpoint returned %s", ErrUnavailable, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return Identity{}, fmt.Errorf("%w: %s %s", ErrLoginFailed, token.Error, token.ErrorDescription)
+	case decodeErr != nil:
+		return Identity{}, fmt.Errorf("%w: decoding token response: %v", ErrUnavailable, decodeErr)
+	case token.IDToken == "":
+		return Identity{}, fmt.Errorf("%w: no ID token", ErrInvalidToken)
+	}
+
+	return p.verify(ctx, token.IDToken, login.Nonce, time.Now())
+}
+
+// verify checks the signature and the claims of the ID token and returns its identity
+func (p *Provider) verify(ctx context.Context, token, nonce string, now time.Time) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "RS256" {
+		return Identity{}, fmt.Errorf("%w: unsupported algorithm", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return Identity{}, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return Identity{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	text := func(name string) string {
+		value, _ := claims[name].(string)
+		return value
+	}
+	expiresAt, _ := claims["exp"].(float64)
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	switch {
+	case text("iss") != discovery.Issuer:
+		return Identity{}, fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	case !hasAudience(claims["aud"], p.config.ClientID):
+		return Identity{}, fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	case expiresAt == 0 || now.Add(-time.Minute).After(time.Unix(int64(expiresAt), 0)):
+		return Identity{}, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case text("nonce") != nonce:
+		return Identity{}, fmt.Errorf("%w: wrong nonce", ErrInvalidToken)
+	case text("sub") == "":
+		return Identity{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	identity := Identity{
+		Subject:    text("sub"),
+		Email:      text("email"),
+		GivenName:  text("given_name"),
+		FamilyName: text("family_name"),
+		MiddleName: text("middle_name"),
+		Passport:   text(p.config.PassportClaim),
+	}
+	if address, ok := claims["address"].(map[string]interface{}); ok {
+		identity.Address, _ = address["formatted"].(string)
+	}
+	return identity, nil
+}
+
+// discover fetches the configuration of the provider once
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var config discovery
+	if err := p.getJSON(ctx, p.config.IssuerURL+"/.well-known/openid-configuration", &config); err != nil {
+		return nil, err
+	}
+	if config.Issuer != p.config.IssuerURL {
+		return nil, fmt.Errorf("%w: provider issuer %q does not match %q", ErrUnavailable, config.Issuer, p.config.IssuerURL)
+	}
+	p.discovery = &config
+	return p.discovery, nil
+}
+
+// key returns the signing key of the provider, the keys are fetched again for an unknown key ID
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	p.keys = make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		p.keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// getJSON fetches the JSON document from the provider
+func (p *Provider) getJSON(ctx context.Context, target string, value interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %s", ErrUnavailable, target, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+		return fmt.Errorf("%w: decoding %s: %v", ErrUnavailable, target, err)
+	}
+	return nil
+}
+
+// hasAudience reports whether the aud claim, a string or an array of them, contains the client
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, value := range aud {
+			if value == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// codeChallenge returns the S256 PKCE challenge of the verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomString returns 32 random bytes encoded for URLs
+func randomString() (string, error) {
+	value := make([]byte, 32)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
@@ -0,0 +1,169 @@
+package peopleinfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("person not found")
+	ErrUnavailable = errors.New("people info service is unavailable")
+)
+
+// People describes a person known to the people info service
+type People struct {
+	Surname    string `json:"surname"`
+	Name       string `json:"name"`
+	Patronymic string `json:"patronymic,omitempty"`
+	Address    string `json:"address"`
+}
+
+// Service looks up people by passport series and number
+type Service interface {
+	Lookup(ctx context.Context, series, number string) (People, error)
+}
+
+// What to do when the service doesn't know the passport
+const (
+	// NotFoundReject returns ErrNotFound
+	NotFoundReject = "reject"
+	// NotFoundAllow returns empty details, the user keeps the details sent by the client
+	NotFoundAllow = "allow"
+)
+
+// Config describes how to reach the people info service
+type Config struct {
+	// URL is the base URL of the service, the client calls URL/info
+	URL string
+	// Timeout limits every attempt
+	Timeout time.Duration
+	// Retries is the number of attempts after the first one failed
+	// with a network error, 429 or 5xx
+	Retries int
+	// RetryDelay is the delay before the first retry, it doubles for every next one
+	RetryDelay time.Duration
+	NotFound   string
+}
+
+// ConfigFromEnv reads the configuration from the PEOPLE_INFO_* environment variables.
+// An empty URL means the service is not used.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		URL:        strings.TrimSuffix(os.Getenv("PEOPLE_INFO_URL"), "/"),
+		Timeout:    5 * time.Second,
+		Retries:    2,
+		RetryDelay: 200 * time.Millisecond,
+		NotFound:   NotFoundReject,
+	}
+
+	var err error
+	if value := os.Getenv("PEOPLE_INFO_TIMEOUT"); value != "" {
+		if config.Timeout, err = time.ParseDuration(value); err != nil || config.Timeout <= 0 {
+			return Config{}, fmt.Errorf("invalid PEOPLE_INFO_TIMEOUT %q", value)
+		}
+	}
+	if value := os.Getenv("PEOPLE_INFO_RETRIES"); value != "" {
+		if config.Retries, err = strconv.Atoi(value); err != nil || config.Retries < 0 {
+			return Config{}, fmt.Errorf("invalid PEOPLE_INFO_RETRIES %q", value)
+		}
+	}
+	if value := os.Getenv("PEOPLE_INFO_RETRY_DELAY"); value != "" {
+		if config.RetryDelay, err = time.ParseDuration(value); err != nil || config.RetryDelay < 0 {
+			return Config{}, fmt.Errorf("invalid PEOPLE_INFO_RETRY_DELAY %q", value)
+		}
+	}
+	if value := os.Getenv("PEOPLE_INFO_NOT_FOUND"); value != "" {
+		if value != NotFoundReject && value != NotFoundAllow {
+			return Config{}, fmt.Errorf("invalid PEOPLE_INFO_NOT_FOUND %q, expected %q or %q", value, NotFoundReject, NotFoundAllow)
+		}
+		config.NotFound = value
+	}
+	return config, nil
+}
+
+// Client calls the people info service over HTTP
+type Client struct {
+	config Config
+	http   *http.Client
+}
+
+func NewClient(config Config) *Client {
+	return &Client{config: config, http: &http.Client{Timeout: config.Timeout}}
+}
+
+// Lookup fetches the person with the passport.
+// It returns ErrUnavailable if the service still fails after all retries.
+func (c *Client) Lookup(ctx context.Context, series, number string) (People, error) {
+	query := url.Values{}
+	query.Set("passportSerie", series)
+	query.Set("passportNumber", number)
+	target := c.config.URL + "/info?" + query.Encode()
+
+	delay := c.config.RetryDelay
+	for attempt := 0; ; attempt++ {
+		people, retry, err := c.get(ctx, target)
+		if err == nil || !retry || attempt >= c.config.Retries {
+			if errors.Is(err, ErrNotFound) && c.config.NotFound == NotFoundAllow {
+				return People{}, nil
+			}
+			if retry {
+				err = fmt.Errorf("%w: %v", ErrUnavailable, err)
+			}
+			return people, err
+		}
+
+		slog.WarnContext(ctx, "People info request failed, retrying", "delay", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return People{}, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// get makes a single request, it reports whether the failed request is worth retrying
+func (c *Client) get(ctx context.Context, target string) (People, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return People{}, false, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// The URL holds the passport, keep it out of the error and so out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = fmt.Errorf("%s %s: %w", urlErr.Op, c.config.URL+"/info", urlErr.Err)
+		}
+		// The caller's context ending is not a failure of the service
+		return People{}, ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusNotFound:
+		return People{}, false, ErrNotFound
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return People{}, true, fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return People{}, false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var people People
+	if err := json.NewDecoder(resp.Body).Decode(&people); err != nil {
+		return People{}, true, fmt.Errorf("decoding response: %w", err)
+	}
+	return people, false, nil
+}
@@ -0,0 +1,49 @@
+package peopleinfo
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// StubPeople are the people the stub server knows by default, keyed by "series number"
+var StubPeople = map[string]People{
+	"1234 567890": {
+		Surname:    "Иванов",
+		Name:       "Иван",
+		Patronymic: "Иванович",
+		Address:    "г. Москва, ул. Ленина, д. 5, кв. 1",
+	},
+	"4321 098765": {
+		Surname: "Петрова",
+		Name:    "Анна",
+		Address: "г. Санкт-Петербург, Невский пр., д. 10",
+	},
+}
+
+// NewStub returns a handler serving GET /info like the people info service does,
+// for testing without the real service
+func NewStub(people map[string]People) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", func(w http.ResponseWriter, r *http.Request) {
+		series, number := r.URL.Query().Get("passportSerie"), r.URL.Query().Get("passportNumber")
+
+		if series == "" || number == "" {
+			http.Error(w, "passportSerie and passportNumber are required", http.StatusBadRequest)
+			return
+		}
+
+		person, ok := people[series+" "+number]
+		if !ok {
+			slog.InfoContext(r.Context(), "People info stub: person not found")
+			http.Error(w, "person not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(person); err != nil {
+			slog.ErrorContext(r.Context(), "People info stub: failed to write response", "error", err)
+		}
+	})
+	return mux
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+)
+
+// chainBatchSize is the number of records read at once when verifying a chain
+const chainBatchSize = 1000
+
+// Versions of the hashed content of the records: new records are hashed with the current one,
+// every record is verified with its own. The legacy content leaves the organization out.
+// The audit entries recorded before the chain existed are marked unchained by a migration,
+// no other record may be.
+const (
+	chainVersionUnchained    = 0
+	chainVersionLegacy       = 1
+	chainVersionOrganization = 2
+)
+
+// chainLink is what a record of a hash chain is checked by
+type chainLink struct {
+	ID       uint
+	Version  int
+	PrevHash string
+	Hash     string
+	// Content is the hashed part of the record
+	Content interface{}
+}
+
+// chainHash returns the SHA-256 hash of the content chained to the hash of the previous record
+func chainHash(prevHash string, content interface{}) (string, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	sum.Write([]byte(prevHash))
+	sum.Write([]byte{'\n'})
+	sum.Write(data)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// chainTime returns the time as it is stored, PostgreSQL keeps microseconds
+func chainTime(at time.Time) time.Time {
+	return at.UTC().Truncate(time.Microsecond)
+}
+
+func auditLink(entry models.AuditEntry) chainLink {
+	link := chainLink{ID: entry.ID, Version: entry.HashVersion, PrevHash: entry.PrevHash, Hash: entry.Hash}
+	createdAt := chainTime(entry.CreatedAt).Format(time.RFC3339Nano)
+	if entry.HashVersion < chainVersionOrganization {
+		link.Content = struct {
+			CreatedAt  string                        `json:"created_at"`
+			Actor      string                        `json:"actor"`
+			Action     string                        `json:"action"`
+			EntityType string                        `json:"entity_type"`
+			EntityID   uint                          `json:"entity_id"`
+			Changes    map[string]models.AuditChange `json:"changes"`
+			RequestID  string                        `json:"request_id"`
+		}{createdAt, entry.Actor, entry.Action, entry.EntityType, entry.EntityID, entry.Changes, entry.RequestID}
+		return link
+	}
+	link.Content = struct {
+		CreatedAt      string                        `json:"created_at"`
+		OrganizationID uint                          `json:"organization_id"`
+		Actor          string                        `json:"actor"`
+		Action         string                        `json:"action"`
+		EntityType     string                        `json:"entity_type"`
+		EntityID       uint                          `json:"entity_id"`
+		Changes        map[string]models.AuditChange `json:"changes"`
+		RequestID      string                        `json:"request_id"`
+	}{createdAt, entry.OrganizationID, entry.Actor, entry.Action, entry.EntityType, entry.EntityID, entry.Changes, entry.RequestID}
+	return link
+}
+
+func revisionLink(revision models.TaskRevision) chainLink {
+	link := chainLink{ID: revision.ID, Version: revision.HashVersion, PrevHash: revision.PrevHash, Hash: revision.Hash}
+	createdAt := chainTime(revision.CreatedAt).Format(time.RFC3339Nano)
+	if revision.HashVersion < chainVersionOrganization {
+		link.Content = struct {
+			CreatedAt string                 `json:"created_at"`
+			TaskID    uint                   `json:"task_id"`
+			UserID    uint                   `json:"user_id"`
+			Deleted   bool                   `json:"deleted"`
+			Task      map[string]interface{} `json:"task"`
+		}{createdAt, revision.TaskID, revision.UserID, revision.Deleted, revision.Task}
+		return link
+	}
+	link.Content = struct {
+		CreatedAt      string                 `json:"created_at"`
+		OrganizationID uint                   `json:"organization_id"`
+		TaskID         uint                   `json:"task_id"`
+		UserID         uint                   `json:"user_id"`
+		Deleted        bool                   `json:"deleted"`
+		Task           map[string]interface{} `json:"task"`
+	}{createdAt, revision.OrganizationID, revision.TaskID, revision.UserID, revision.Deleted, revision.Task}
+	return link
+}
+
+// sealAuditEntry sets the creation time of the entry and chains it to the hash of the previous entry of its organization
+func sealAuditEntry(entry *models.AuditEntry, prevHash string) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	entry.CreatedAt = chainTime(entry.CreatedAt)
+	// The content is hashed as it is read back, after its JSON round trip
+	if err := roundTrip(&entry.Changes); err != nil {
+		return err
+	}
+
+	entry.PrevHash = prevHash
+	entry.HashVersion = chainVersionOrganization
+	hash, err := chainHash(prevHash, auditLink(*entry).Content)
+	entry.Hash = hash
+	return err
+}
+
+// sealRevision sets the creation time of the revision and chains it to the hash of the previous revision of its organization
+func sealRevision(revision *models.TaskRevision, prevHash string) error {
+	revision.CreatedAt = chainTime(time.Now())
+	if err := roundTrip(&revision.Task); err != nil {
+		return err
+	}
+
+	revision.PrevHash = prevHash
+	revision.HashVersion = chainVersionOrganization
+	hash, err := chainHash(prevHash, revisionLink(*revision).Content)
+	revision.Hash = hash
+	return err
+}
+
+// roundTrip replaces the value with its JSON encoding decoded back
+func roundTrip[T any](value *T) error {
+	data, err := json.Marshal(*value)
+	if err != nil {
+		return err
+	}
+	var decoded T
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*value = decoded
+	return nil
+}
+
+// VerifyAuditLog checks the chain of the audit entries of an organization ordered by ID, e.g. of an exported log
+func VerifyAuditLog(entries []models.AuditEntry) (models.ChainVerification, error) {
+	verifier := newChainVerifier(models.ChainAudit, 0)
+	if len(entries) > 0 {
+		verifier.result.OrganizationID = entries[0].OrganizationID
+	}
+	for _, entry := range entries {
+		if err := verifier.check(auditLink(entry)); err != nil {
+			return models.ChainVerification{}, err
+		}
+	}
+	return verifier.result, nil
+}
+
+// VerifyTaskRevisions checks the chain of the task revisions of an organization ordered by ID
+func VerifyTaskRevisions(revisions []models.TaskRevision) (models.ChainVerification, error) {
+	verifier := newChainVerifier(models.ChainTaskRevisions, 0)
+	if len(revisions) > 0 {
+		verifier.result.OrganizationID = revisions[0].OrganizationID
+	}
+	for _, revision := range revisions {
+		if err := verifier.check(revisionLink(revision)); err != nil {
+			return models.ChainVerification{}, err
+		}
+	}
+	return verifier.result, nil
+}
+
+// chainVerifier walks a hash chain in the order of the record IDs
+// and remembers the first broken link
+type chainVerifier struct {
+	result   models.ChainVerification
+	prevHash string
+	started  bool
+}
+
+func newChainVerifier(chain string, organizationID uint) *chainVerifier {
+	return &chainVerifier{result: models.ChainVerification{Chain: chain, OrganizationID: organizationID, Valid: true}}
+}
+
+// check checks the next record of the chain, records after a broken link are not checked
+func (v *chainVerifier) check(link chainLink) error {
+	if !v.result.Valid {
+		return nil
+	}
+	// Only the records from before the chain existed are left out, they all precede it
+	if link.Version == chainVersionUnchained && !v.started {
+		return nil
+	}
+	v.started = true
+
+	expected, err := chainHash(link.PrevHash, link.Content)
+	if err != nil {
+		return err
+	}
+	switch {
+	case link.Version == chainVersionUnchained || link.Hash == "":
+		v.fail(link.ID, "record inside the chain has no hash")
+	case link.PrevHash != v.prevHash:
+		v.fail(link.ID, "previous hash does not match the previous record")
+	case link.Hash != expected:
+		v.fail(link.ID, "hash does not match the record")
+	default:
+		v.result.Checked++
+		v.result.Head = link.Hash
+		v.prevHash = link.Hash
+	}
+	return nil
+}
+
+func (v *chainVerifier) fail(id uint, reason string) {
+	v.result.Valid = false
+	v.result.BrokenID = id
+	v.result.Reason = reason
+}
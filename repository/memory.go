@@ -0,0 +1,1289 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+
+	"gorm.io/gorm"
+)
+
+// NewMemory returns repositories that keep everything in memory.
+// They behave like the PostgreSQL ones and are meant for tests.
+func NewMemory() Repositories {
+	store := &memoryStore{memoryData: memoryData{
+		users:    make(map[uint]models.User),
+		tasks:    make(map[uint]models.Task),
+		projects: make(map[uint]models.Project),
+		organizations: []models.Organization{
+			{ID: models.DefaultOrganizationID, Name: "Default", CreatedAt: time.Now()},
+		},
+	}}
+	return Repositories{
+		Users:    &memoryUserRepository{store},
+		Tasks:    &memoryTaskRepository{store},
+		Projects: &memoryProjectRepository{store},
+		Audit:    &memoryAuditRepository{store},
+		APIKeys:  &memoryAPIKeyRepository{store},
+		Tokens:   &memoryTokenRepository{store},
+
+		Organizations: &memoryOrganizationRepository{store},
+		Tx:            store,
+	}
+}
+
+// memoryStore holds the data of all in-memory repositories
+type memoryStore struct {
+	mu sync.RWMutex
+	// txMu serializes the transactions
+	txMu sync.Mutex
+
+	memoryData
+}
+
+// memoryData is the data of the in-memory repositories, a transaction rolls it back to a copy
+type memoryData struct {
+	users      map[uint]models.User
+	lastUserID uint
+
+	tasks      map[uint]models.Task
+	lastTaskID uint
+	// archivedTasks are the tasks of the purged users
+	archivedTasks []archivedTask
+
+	lastBreakID uint
+
+	projects      map[uint]models.Project
+	lastProjectID uint
+
+	auditEntries  []models.AuditEntry
+	taskRevisions []models.TaskRevision
+
+	apiKeys []models.APIKey
+	tokens  []models.PersonalAccessToken
+
+	organizations []models.Organization
+}
+
+// archivedTask is a task of a purged user with the organization of the user
+type archivedTask struct {
+	models.Task
+	OrganizationID uint
+}
+
+// clone copies the data deep enough that changing the stored records doesn't change the copy
+func (d *memoryData) clone() memoryData {
+	clone := *d
+	clone.users = maps.Clone(d.users)
+	clone.tasks = make(map[uint]models.Task, len(d.tasks))
+	for id, task := range d.tasks {
+		clone.tasks[id] = cloneTask(task)
+	}
+	clone.archivedTasks = slices.Clone(d.archivedTasks)
+	clone.projects = maps.Clone(d.projects)
+	clone.auditEntries = slices.Clone(d.auditEntries)
+	clone.taskRevisions = slices.Clone(d.taskRevisions)
+	clone.apiKeys = slices.Clone(d.apiKeys)
+	clone.tokens = slices.Clone(d.tokens)
+	clone.organizations = slices.Clone(d.organizations)
+	return clone
+}
+
+// memoryTxKey marks the context of a transaction of the in-memory repositories
+type memoryTxKey struct{}
+
+// Transaction keeps a copy of the data and restores it if fn fails. Transactions run one at a time,
+// the changes made outside of them meanwhile are rolled back together with the transaction.
+func (s *memoryStore) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTxKey{}) != nil {
+		return fn(ctx)
+	}
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.RLock()
+	saved := s.memoryData.clone()
+	s.mu.RUnlock()
+
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, true)); err != nil {
+		s.mu.Lock()
+		s.memoryData = saved
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// liveUser returns the user unless there is no such user or the user is soft deleted
+func (s *memoryStore) liveUser(id uint) (models.User, bool) {
+	user, ok := s.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// visibleUser reports whether the user, soft deleted or not, exists in the organization of the context
+func (s *memoryStore) visibleUser(ctx context.Context, id uint) bool {
+	user, ok := s.users[id]
+	return ok && inOrganization(ctx, user.OrganizationID)
+}
+
+// cloneTask copies the task so that the caller can't modify the stored one
+func cloneTask(task models.Task) models.Task {
+	if task.Tags != nil {
+		task.Tags = append([]string(nil), task.Tags...)
+	}
+	if task.ProjectID != nil {
+		projectID := *task.ProjectID
+		task.ProjectID = &projectID
+	}
+	if task.EndTime != nil {
+		end := *task.EndTime
+		task.EndTime = &end
+	}
+	if task.Breaks != nil {
+		breaks := make([]models.TaskBreak, len(task.Breaks))
+		for i, taskBreak := range task.Breaks {
+			if taskBreak.EndTime != nil {
+				end := *taskBreak.EndTime
+				taskBreak.EndTime = &end
+			}
+			breaks[i] = taskBreak
+		}
+		task.Breaks = breaks
+	}
+	return task
+}
+
+type memoryUserRepository struct {
+	*memoryStore
+}
+
+func (r *memoryUserRepository) List(ctx context.Context, filter UserFilter) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matches := func(value, filter string) bool {
+		return filter == "" || value == filter
+	}
+
+	users := make([]models.User, 0)
+	for _, user := range r.users {
+		switch {
+		case filter.Deleted == DeletedExclude && user.DeletedAt.Valid,
+			filter.Deleted == DeletedOnly && !user.DeletedAt.Valid,
+			!inOrganization(ctx, user.OrganizationID):
+			continue
+		}
+		if (filter.Passport == nil || user.Passport == *filter.Passport) &&
+			matches(user.Surname, filter.Surname) &&
+			matches(user.Name, filter.Name) &&
+			matches(user.Patronymic, filter.Patronymic) &&
+			matches(user.Address, filter.Address) &&
+			matches(user.Role, filter.Role) &&
+			(filter.ManagerID == nil || (user.ManagerID != nil && *user.ManagerID == *filter.ManagerID)) &&
+			(filter.OIDCSubject == "" || (user.OIDCSubject != nil && *user.OIDCSubject == filter.OIDCSubject)) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return paginate(users, filter.Offset, filter.Limit), nil
+}
+
+func (r *memoryUserRepository) GetByID(ctx context.Context, id uint) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.liveUser(id)
+	if !ok || !inOrganization(ctx, user.OrganizationID) {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := assignOrganization(ctx, &user.OrganizationID); err != nil {
+		return err
+	}
+	if r.passportTaken(*user, 0) || r.oidcSubjectTaken(*user, 0) {
+		return ErrDuplicate
+	}
+
+	r.lastUserID++
+	user.ID = r.lastUserID
+	user.Version = 1
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.liveUser(user.ID)
+	if !ok || !inOrganization(ctx, stored.OrganizationID) {
+		return ErrNotFound
+	}
+	if stored.Version != user.Version {
+		return ErrVersionConflict
+	}
+	// Users don't move between organizations
+	user.OrganizationID = stored.OrganizationID
+	if r.passportTaken(*user, user.ID) || r.oidcSubjectTaken(*user, user.ID) {
+		return ErrDuplicate
+	}
+
+	user.Version++
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, id uint, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.liveUser(id)
+	if !ok || !inOrganization(ctx, user.OrganizationID) {
+		return ErrNotFound
+	}
+	if version != 0 && user.Version != version {
+		return ErrVersionConflict
+	}
+	user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	user.Version++
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) Restore(ctx context.Context, id uint) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || !user.DeletedAt.Valid || !inOrganization(ctx, user.OrganizationID) {
+		return models.User{}, ErrNotFound
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+	user.Version++
+	r.users[id] = user
+	return user, nil
+}
+
+func (r *memoryUserRepository) Purge(ctx context.Context, id uint, policy string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.visibleUser(ctx, id) {
+		return ErrNotFound
+	}
+
+	var taskIDs []uint
+	for taskID, task := range r.tasks {
+		if task.UserID == id {
+			taskIDs = append(taskIDs, taskID)
+		}
+	}
+	slices.Sort(taskIDs)
+
+	switch policy {
+	case TasksKeep:
+		if len(taskIDs) > 0 {
+			return ErrUserHasTasks
+		}
+	case TasksArchive:
+		for _, taskID := range taskIDs {
+			archived := archivedTask{Task: cloneTask(r.tasks[taskID]), OrganizationID: r.users[id].OrganizationID}
+			r.archivedTasks = append(r.archivedTasks, archived)
+		}
+		fallthrough
+	case TasksDelete:
+		for _, taskID := range taskIDs {
+			delete(r.tasks, taskID)
+		}
+	default:
+		return fmt.Errorf("unknown tasks policy %q", policy)
+	}
+
+	delete(r.users, id)
+
+	// The team is left without a manager like ON DELETE SET NULL does
+	for userID, user := range r.users {
+		if user.ManagerID != nil && *user.ManagerID == id {
+			user.ManagerID = nil
+			r.users[userID] = user
+		}
+	}
+	return nil
+}
+
+// passportTaken reports whether a user of the same organization other than exceptID has the user's passport
+func (r *memoryUserRepository) passportTaken(user models.User, exceptID uint) bool {
+	for id, other := range r.users {
+		if id != exceptID && other.OrganizationID == user.OrganizationID && other.Passport == user.Passport {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcSubjectTaken reports whether a user of the same organization other than exceptID logs in as the user's subject
+func (r *memoryUserRepository) oidcSubjectTaken(user models.User, exceptID uint) bool {
+	if user.OIDCSubject == nil {
+		return false
+	}
+	for id, other := range r.users {
+		if id != exceptID && other.OrganizationID == user.OrganizationID &&
+			other.OIDCSubject != nil && *other.OIDCSubject == *user.OIDCSubject {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryTaskRepository struct {
+	*memoryStore
+}
+
+func (r *memoryTaskRepository) Create(ctx context.Context, task *models.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.visibleUser(ctx, task.UserID) {
+		return ErrNotFound
+	}
+	return r.create(task)
+}
+
+func (r *memoryTaskRepository) Update(ctx context.Context, task *models.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[task.ID]
+	if !ok || !r.visibleUser(ctx, stored.UserID) || !r.visibleUser(ctx, task.UserID) {
+		return ErrNotFound
+	}
+	if task.EndTime == nil {
+		if active, ok := r.active(task.UserID); ok && active.ID != task.ID {
+			return ErrDuplicate
+		}
+	}
+
+	// Breaks are changed only by pausing and resuming
+	task.Version++
+	updated := cloneTask(*task)
+	updated.Breaks = stored.Breaks
+	r.tasks[task.ID] = updated
+	return nil
+}
+
+func (r *memoryTaskRepository) Get(ctx context.Context, userID, taskID uint) (models.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.tasks[taskID]
+	if !ok || task.UserID != userID || !r.visibleUser(ctx, userID) {
+		return models.Task{}, ErrNotFound
+	}
+	return cloneTask(task), nil
+}
+
+func (r *memoryTaskRepository) CreateEntry(ctx context.Context, task *models.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.liveUser(task.UserID); !ok || !r.visibleUser(ctx, task.UserID) {
+		return ErrNotFound
+	}
+	if r.overlaps(*task) {
+		return ErrOverlap
+	}
+
+	task.Breaks = nil
+	return r.create(task)
+}
+
+func (r *memoryTaskRepository) UpdateEntry(ctx context.Context, task *models.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[task.ID]
+	if !ok || stored.UserID != task.UserID || !r.visibleUser(ctx, task.UserID) {
+		return ErrNotFound
+	}
+	if stored.Version != task.Version {
+		return ErrVersionConflict
+	}
+	if r.overlaps(*task) {
+		return ErrOverlap
+	}
+
+	updated := cloneTask(*task)
+	updated.Version++
+	updated.Breaks = cloneTask(stored).Breaks
+	if updated.EndTime != nil {
+		updated.Finish(*updated.EndTime)
+	}
+	r.tasks[task.ID] = updated
+	*task = cloneTask(updated)
+	return nil
+}
+
+func (r *memoryTaskRepository) Delete(ctx context.Context, userID, taskID uint, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.tasks[taskID]
+	if !ok || task.UserID != userID || !r.visibleUser(ctx, userID) {
+		return ErrNotFound
+	}
+	if version != 0 && task.Version != version {
+		return ErrVersionConflict
+	}
+	delete(r.tasks, taskID)
+	return nil
+}
+
+func (r *memoryTaskRepository) Start(ctx context.Context, task *models.Task, stopActive bool) (*models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.visibleUser(ctx, task.UserID) {
+		return nil, ErrNotFound
+	}
+	return r.start(task, stopActive, false)
+}
+
+func (r *memoryTaskRepository) Switch(ctx context.Context, task *models.Task) (models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.visibleUser(ctx, task.UserID) {
+		return models.Task{}, ErrNotFound
+	}
+	stopped, err := r.start(task, true, true)
+	if err != nil {
+		return models.Task{}, err
+	}
+	return *stopped, nil
+}
+
+func (r *memoryTaskRepository) Finish(ctx context.Context, userID uint, at time.Time) (models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.active(userID)
+	if !ok || !r.visibleUser(ctx, userID) {
+		return models.Task{}, ErrNotFound
+	}
+	task.Finish(at)
+	task.Version++
+	r.tasks[task.ID] = cloneTask(task)
+	return task, nil
+}
+
+func (r *memoryTaskRepository) Pause(ctx context.Context, userID uint, at time.Time) (models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.active(userID)
+	if !ok || !r.visibleUser(ctx, userID) {
+		return models.Task{}, ErrNotFound
+	}
+	if task.Paused() {
+		return models.Task{}, ErrTaskPaused
+	}
+
+	if at.Before(task.StartTime) {
+		at = task.StartTime
+	}
+	r.lastBreakID++
+	task.Breaks = append(task.Breaks, models.TaskBreak{ID: r.lastBreakID, TaskID: task.ID, StartTime: at})
+	task.Version++
+	r.tasks[task.ID] = cloneTask(task)
+	return task, nil
+}
+
+func (r *memoryTaskRepository) Resume(ctx context.Context, userID uint, at time.Time) (models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.active(userID)
+	if !ok || !r.visibleUser(ctx, userID) {
+		return models.Task{}, ErrNotFound
+	}
+	if !task.Paused() {
+		return models.Task{}, ErrTaskNotPaused
+	}
+
+	for i := range task.Breaks {
+		if task.Breaks[i].EndTime == nil {
+			end := at
+			if end.Before(task.Breaks[i].StartTime) {
+				end = task.Breaks[i].StartTime
+			}
+			task.Breaks[i].EndTime = &end
+		}
+	}
+	task.Version++
+	r.tasks[task.ID] = cloneTask(task)
+	return task, nil
+}
+
+func (r *memoryTaskRepository) GetActive(ctx context.Context, userID uint) (models.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.active(userID)
+	if !ok || !r.visibleUser(ctx, userID) {
+		return models.Task{}, ErrNotFound
+	}
+	return task, nil
+}
+
+func (r *memoryTaskRepository) ListByUser(ctx context.Context, userID uint) ([]models.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.filter(func(task models.Task) bool {
+		return task.UserID == userID && r.visibleUser(ctx, userID)
+	}), nil
+}
+
+func (r *memoryTaskRepository) ListFinished(ctx context.Context, userID uint, start, end time.Time) ([]models.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.filter(func(task models.Task) bool {
+		return task.UserID == userID && r.visibleUser(ctx, userID) && !task.StartTime.Before(start) &&
+			task.EndTime != nil && !task.EndTime.After(end)
+	}), nil
+}
+
+func (r *memoryTaskRepository) Workload(ctx context.Context, filter WorkloadFilter) ([]models.TaskWorkload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type group struct {
+		task      string
+		projectID uint
+	}
+	totals := make(map[group]time.Duration)
+	for _, task := range r.tasks {
+		if task.UserID != filter.UserID || !r.visibleUser(ctx, task.UserID) || (task.EndTime == nil && !filter.IncludeActive) {
+			continue
+		}
+		if filter.ProjectID != nil && (task.ProjectID == nil || *task.ProjectID != *filter.ProjectID) {
+			continue
+		}
+		if !overlapsPeriod(task, filter.Start, filter.End, filter.Now) {
+			continue
+		}
+
+		key := group{task: task.TaskName}
+		if filter.GroupBy == WorkloadByProject {
+			key = group{}
+			if task.ProjectID != nil {
+				key.projectID = *task.ProjectID
+			}
+		}
+		totals[key] += task.WorkedWithin(filter.Start, filter.End, filter.Now)
+	}
+
+	workload := make([]models.TaskWorkload, 0, len(totals))
+	for key, total := range totals {
+		entry := models.TaskWorkload{Task: key.task}
+		if key.projectID != 0 {
+			projectID := key.projectID
+			entry.ProjectID = &projectID
+			entry.Project = r.projects[projectID].Name
+		}
+		entry.SetTotal(int64(total.Round(time.Second) / time.Second))
+		workload = append(workload, entry)
+	}
+	sort.Slice(workload, func(i, j int) bool {
+		if workload[i].TotalSeconds != workload[j].TotalSeconds {
+			return workload[i].TotalSeconds > workload[j].TotalSeconds
+		}
+		if workload[i].Project != workload[j].Project {
+			return workload[i].Project < workload[j].Project
+		}
+		return workload[i].Task < workload[j].Task
+	})
+	return workload, nil
+}
+
+// reportGroup is a group of a team report, the dimensions rolled up into subtotals are empty
+type reportGroup struct {
+	level     int
+	userID    uint
+	day       string
+	week      string
+	task      string
+	projectID uint
+}
+
+func (r *memoryTaskRepository) TeamReport(ctx context.Context, filter TeamReportFilter) ([]models.TimeReportRow, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make(map[uint]bool, len(filter.UserIDs))
+	for _, id := range filter.UserIDs {
+		users[id] = true
+	}
+
+	// The grand total is there even without any time like in SQL
+	totals := map[reportGroup]time.Duration{{}: 0}
+	for _, task := range r.tasks {
+		if (len(users) > 0 && !users[task.UserID]) || !r.visibleUser(ctx, task.UserID) || (task.EndTime == nil && !filter.IncludeActive) {
+			continue
+		}
+		if filter.ProjectID != nil && (task.ProjectID == nil || *task.ProjectID != *filter.ProjectID) {
+			continue
+		}
+		if !overlapsPeriod(task, filter.Start, filter.End, filter.Now) {
+			continue
+		}
+
+		// Splitting the task into the parts worked on each day
+		start, end := task.StartTime, filter.Now
+		if task.EndTime != nil {
+			end = *task.EndTime
+		}
+		if filter.Start.After(start) {
+			start = filter.Start
+		}
+		if filter.End.Before(end) {
+			end = filter.End
+		}
+
+		year, month, date := start.In(filter.Location).Date()
+		for day := time.Date(year, month, date, 0, 0, 0, 0, filter.Location); day.Before(end); day = day.AddDate(0, 0, 1) {
+			from, to := day, day.AddDate(0, 0, 1)
+			if start.After(from) {
+				from = start
+			}
+			if end.Before(to) {
+				to = end
+			}
+			if !to.After(from) {
+				continue
+			}
+
+			worked := task.WorkedWithin(from, to, filter.Now)
+			for level := 0; level <= len(filter.GroupBy); level++ {
+				totals[newReportGroup(task, day, filter.GroupBy[:level])] += worked
+			}
+		}
+	}
+
+	report := make([]models.TimeReportRow, 0, len(totals))
+	for group, total := range totals {
+		row := models.TimeReportRow{GroupedBy: filter.GroupBy[:group.level]}
+		for _, dimension := range row.GroupedBy {
+			switch dimension {
+			case ReportByUser:
+				userID := group.userID
+				user := r.users[userID]
+				row.UserID = &userID
+				row.User = strings.TrimSpace(user.Surname + " " + user.Name)
+			case ReportByDay:
+				row.Day = group.day
+			case ReportByWeek:
+				row.Week = group.week
+			case ReportByTask:
+				row.Task = group.task
+			case ReportByProject:
+				if group.projectID != 0 {
+					projectID := group.projectID
+					row.ProjectID = &projectID
+					row.Project = r.projects[projectID].Name
+				}
+			}
+		}
+		row.SetTotal(int64(total.Round(time.Second) / time.Second))
+		report = append(report, row)
+	}
+	slices.SortFunc(report, func(a, b models.TimeReportRow) int {
+		return r.compareReportRows(a, b, filter.GroupBy)
+	})
+	return report, nil
+}
+
+// compareReportRows orders the team report rows like the PostgreSQL repository does:
+// by every dimension in turn, with subtotals after the rows they sum up
+func (r *memoryTaskRepository) compareReportRows(a, b models.TimeReportRow, dimensions []string) int {
+	for i, dimension := range dimensions {
+		aGrouped, bGrouped := i < len(a.GroupedBy), i < len(b.GroupedBy)
+		if !aGrouped || !bGrouped {
+			return cmp.Compare(len(b.GroupedBy), len(a.GroupedBy))
+		}
+
+		var result int
+		switch dimension {
+		case ReportByUser:
+			aUser, bUser := r.users[*a.UserID], r.users[*b.UserID]
+			result = cmp.Or(
+				cmp.Compare(aUser.Surname, bUser.Surname),
+				cmp.Compare(aUser.Name, bUser.Name),
+				cmp.Compare(*a.UserID, *b.UserID))
+		case ReportByDay:
+			result = cmp.Compare(a.Day, b.Day)
+		case ReportByWeek:
+			result = cmp.Compare(a.Week, b.Week)
+		case ReportByTask:
+			result = cmp.Compare(a.Task, b.Task)
+		case ReportByProject:
+			// Rows without a project have an empty name and go first
+			var aID, bID uint
+			if a.ProjectID != nil {
+				aID = *a.ProjectID
+			}
+			if b.ProjectID != nil {
+				bID = *b.ProjectID
+			}
+			result = cmp.Or(cmp.Compare(a.Project, b.Project), cmp.Compare(aID, bID))
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+// newReportGroup returns the group of the task part worked on the day
+func newReportGroup(task models.Task, day time.Time, dimensions []string) reportGroup {
+	group := reportGroup{level: len(dimensions)}
+	for _, dimension := range dimensions {
+		switch dimension {
+		case ReportByUser:
+			group.userID = task.UserID
+		case ReportByDay:
+			group.day = day.Format("2006-01-02")
+		case ReportByWeek:
+			// Weeks start on Monday
+			group.week = day.AddDate(0, 0, -(int(day.Weekday())+6)%7).Format("2006-01-02")
+		case ReportByTask:
+			group.task = task.TaskName
+		case ReportByProject:
+			if task.ProjectID != nil {
+				group.projectID = *task.ProjectID
+			}
+		}
+	}
+	return group
+}
+
+// The caller must hold the lock.
+func (r *memoryTaskRepository) start(task *models.Task, stopActive, requireActive bool) (*models.Task, error) {
+	if _, ok := r.liveUser(task.UserID); !ok {
+		return nil, ErrNotFound
+	}
+
+	active, ok := r.active(task.UserID)
+	if ok && !stopActive {
+		return nil, ErrActiveTask
+	}
+	if !ok && requireActive {
+		return nil, ErrNotFound
+	}
+
+	var stopped *models.Task
+	if ok {
+		active.Finish(task.StartTime)
+		active.Version++
+		r.tasks[active.ID] = cloneTask(active)
+		stopped = &active
+	}
+
+	if err := r.create(task); err != nil {
+		return nil, err
+	}
+	return stopped, nil
+}
+
+// create stores a new task, allowing only one running task per user
+// like the unique index does. The caller must hold the lock.
+func (r *memoryTaskRepository) create(task *models.Task) error {
+	if task.EndTime == nil {
+		if _, ok := r.active(task.UserID); ok {
+			return ErrDuplicate
+		}
+	}
+
+	r.lastTaskID++
+	task.ID = r.lastTaskID
+	task.Version = 1
+	r.tasks[task.ID] = cloneTask(*task)
+	return nil
+}
+
+// overlaps reports whether the task overlaps another task of the user.
+// Running tasks last indefinitely. The caller must hold the lock.
+func (r *memoryTaskRepository) overlaps(task models.Task) bool {
+	for _, other := range r.tasks {
+		if other.UserID != task.UserID || other.ID == task.ID {
+			continue
+		}
+		if other.EndTime != nil && !other.EndTime.After(task.StartTime) {
+			continue
+		}
+		if task.EndTime != nil && !other.StartTime.Before(*task.EndTime) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// active returns a copy of the user's running task.
+// The caller must hold the lock.
+func (r *memoryTaskRepository) active(userID uint) (models.Task, bool) {
+	for _, task := range r.tasks {
+		if task.UserID == userID && task.EndTime == nil {
+			return cloneTask(task), true
+		}
+	}
+	return models.Task{}, false
+}
+
+// filter returns copies of the tasks matching the predicate ordered by start time.
+// The caller must hold the lock.
+func (r *memoryTaskRepository) filter(match func(models.Task) bool) []models.Task {
+	tasks := make([]models.Task, 0)
+	for _, task := range r.tasks {
+		if match(task) {
+			tasks = append(tasks, cloneTask(task))
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].StartTime.Equal(tasks[j].StartTime) {
+			return tasks[i].StartTime.Before(tasks[j].StartTime)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks
+}
+
+type memoryProjectRepository struct {
+	*memoryStore
+}
+
+func (r *memoryProjectRepository) List(ctx context.Context, filter ProjectFilter) ([]models.Project, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	projects := make([]models.Project, 0)
+	for _, project := range r.projects {
+		if !inOrganization(ctx, project.OrganizationID) {
+			continue
+		}
+		if filter.Client != "" && project.Client != filter.Client {
+			continue
+		}
+		if filter.Archived != nil && project.Archived != *filter.Archived {
+			continue
+		}
+		projects = append(projects, project)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	return projects, nil
+}
+
+func (r *memoryProjectRepository) GetByID(ctx context.Context, id uint) (models.Project, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	project, ok := r.projects[id]
+	if !ok || !inOrganization(ctx, project.OrganizationID) {
+		return models.Project{}, ErrNotFound
+	}
+	return project, nil
+}
+
+func (r *memoryProjectRepository) Create(ctx context.Context, project *models.Project) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := assignOrganization(ctx, &project.OrganizationID); err != nil {
+		return err
+	}
+	if r.nameTaken(*project, 0) {
+		return ErrDuplicate
+	}
+
+	r.lastProjectID++
+	project.ID = r.lastProjectID
+	r.projects[project.ID] = *project
+	return nil
+}
+
+func (r *memoryProjectRepository) Update(ctx context.Context, project *models.Project) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.projects[project.ID]
+	if !ok || !inOrganization(ctx, stored.OrganizationID) {
+		return ErrNotFound
+	}
+	project.OrganizationID = stored.OrganizationID
+	if r.nameTaken(*project, project.ID) {
+		return ErrDuplicate
+	}
+
+	r.projects[project.ID] = *project
+	return nil
+}
+
+func (r *memoryProjectRepository) Delete(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if project, ok := r.projects[id]; !ok || !inOrganization(ctx, project.OrganizationID) {
+		return ErrNotFound
+	}
+	delete(r.projects, id)
+
+	// Tasks are kept without a project like ON DELETE SET NULL does
+	for taskID, task := range r.tasks {
+		if task.ProjectID != nil && *task.ProjectID == id {
+			task.ProjectID = nil
+			r.tasks[taskID] = task
+		}
+	}
+	return nil
+}
+
+// nameTaken reports whether a project of the same organization other than exceptID has the project's name, ignoring case
+func (r *memoryProjectRepository) nameTaken(project models.Project, exceptID uint) bool {
+	for id, other := range r.projects {
+		if id != exceptID && other.OrganizationID == project.OrganizationID && strings.EqualFold(other.Name, project.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryAuditRepository struct {
+	*memoryStore
+}
+
+func (r *memoryAuditRepository) Record(ctx context.Context, entry *models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := assignOrganization(ctx, &entry.OrganizationID); err != nil {
+		return err
+	}
+	prevHash := ""
+	for i := len(r.auditEntries) - 1; i >= 0; i-- {
+		if r.auditEntries[i].OrganizationID == entry.OrganizationID {
+			prevHash = r.auditEntries[i].Hash
+			break
+		}
+	}
+	if err := sealAuditEntry(entry, prevHash); err != nil {
+		return err
+	}
+	entry.ID = uint(len(r.auditEntries) + 1)
+	r.auditEntries = append(r.auditEntries, *entry)
+	return nil
+}
+
+func (r *memoryAuditRepository) RecordRevision(ctx context.Context, revision *models.TaskRevision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := assignOrganization(ctx, &revision.OrganizationID); err != nil {
+		return err
+	}
+	prevHash := ""
+	for i := len(r.taskRevisions) - 1; i >= 0; i-- {
+		if r.taskRevisions[i].OrganizationID == revision.OrganizationID {
+			prevHash = r.taskRevisions[i].Hash
+			break
+		}
+	}
+	if err := sealRevision(revision, prevHash); err != nil {
+		return err
+	}
+	revision.ID = uint(len(r.taskRevisions) + 1)
+	r.taskRevisions = append(r.taskRevisions, *revision)
+	return nil
+}
+
+func (r *memoryAuditRepository) ListRevisions(ctx context.Context, userID, taskID uint) ([]models.TaskRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revisions := make([]models.TaskRevision, 0)
+	for _, revision := range r.taskRevisions {
+		if revision.TaskID == taskID && revision.UserID == userID && inOrganization(ctx, revision.OrganizationID) {
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions, nil
+}
+
+func (r *memoryAuditRepository) Verify(ctx context.Context) ([]models.ChainVerification, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	chains := make([]models.ChainVerification, 0, 2*len(r.organizations))
+	for _, organization := range r.organizations {
+		if !inOrganization(ctx, organization.ID) {
+			continue
+		}
+		entries := slices.DeleteFunc(slices.Clone(r.auditEntries), func(entry models.AuditEntry) bool {
+			return entry.OrganizationID != organization.ID
+		})
+		audit, err := VerifyAuditLog(entries)
+		if err != nil {
+			return nil, err
+		}
+		revisions := slices.DeleteFunc(slices.Clone(r.taskRevisions), func(revision models.TaskRevision) bool {
+			return revision.OrganizationID != organization.ID
+		})
+		revision, err := VerifyTaskRevisions(revisions)
+		if err != nil {
+			return nil, err
+		}
+		audit.OrganizationID, revision.OrganizationID = organization.ID, organization.ID
+		chains = append(chains, audit, revision)
+	}
+	return chains, nil
+}
+
+func (r *memoryAuditRepository) List(ctx context.Context, filter AuditFilter) ([]models.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]models.AuditEntry, 0)
+	for i := len(r.auditEntries) - 1; i >= 0; i-- {
+		entry := r.auditEntries[i]
+		switch {
+		case filter.Actor != "" && entry.Actor != filter.Actor,
+			filter.Action != "" && entry.Action != filter.Action,
+			filter.EntityType != "" && entry.EntityType != filter.EntityType,
+			filter.EntityID != 0 && entry.EntityID != filter.EntityID,
+			filter.RequestID != "" && entry.RequestID != filter.RequestID,
+			!filter.From.IsZero() && entry.CreatedAt.Before(filter.From),
+			!filter.To.IsZero() && !entry.CreatedAt.Before(filter.To),
+			!inOrganization(ctx, entry.OrganizationID):
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return paginate(entries, filter.Offset, filter.Limit), nil
+}
+
+// overlapsPeriod reports whether the task overlaps the period,
+// running tasks last until now
+func overlapsPeriod(task models.Task, start, end, now time.Time) bool {
+	taskEnd := now
+	if task.EndTime != nil {
+		taskEnd = *task.EndTime
+	}
+	return task.StartTime.Before(end) && taskEnd.After(start)
+}
+
+// paginate returns the page of items starting at offset.
+// A non-positive limit means no limit.
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	if offset > 0 {
+		items = items[offset:]
+	}
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+type memoryAPIKeyRepository struct {
+	*memoryStore
+}
+
+func (r *memoryAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := assignOrganization(ctx, &key.OrganizationID); err != nil {
+		return err
+	}
+	for _, existing := range r.apiKeys {
+		if existing.Hash == key.Hash {
+			return ErrDuplicate
+		}
+	}
+	key.ID = uint(len(r.apiKeys) + 1)
+	key.CreatedAt = time.Now()
+	r.apiKeys = append(r.apiKeys, *key)
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0)
+	for _, key := range r.apiKeys {
+		if inOrganization(ctx, key.OrganizationID) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *memoryAPIKeyRepository) GetByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.apiKeys {
+		if key.Hash == hash && key.RevokedAt == nil && inOrganization(ctx, key.OrganizationID) {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, ErrNotFound
+}
+
+func (r *memoryAPIKeyRepository) Revoke(ctx context.Context, id uint) (models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id == 0 || id > uint(len(r.apiKeys)) || r.apiKeys[id-1].RevokedAt != nil ||
+		!inOrganization(ctx, r.apiKeys[id-1].OrganizationID) {
+		return models.APIKey{}, ErrNotFound
+	}
+	now := time.Now()
+	r.apiKeys[id-1].RevokedAt = &now
+	return r.apiKeys[id-1], nil
+}
+
+type memoryTokenRepository struct {
+	*memoryStore
+}
+
+// cloneToken copies the token so that the caller can't modify the stored one
+func cloneToken(token models.PersonalAccessToken) models.PersonalAccessToken {
+	token.Scopes = slices.Clone(token.Scopes)
+	return token
+}
+
+func (r *memoryTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.visibleUser(ctx, token.UserID) {
+		return ErrNotFound
+	}
+	for _, existing := range r.tokens {
+		if existing.Hash == token.Hash {
+			return ErrDuplicate
+		}
+	}
+	token.ID = uint(len(r.tokens) + 1)
+	token.CreatedAt = time.Now()
+	r.tokens = append(r.tokens, cloneToken(*token))
+	return nil
+}
+
+func (r *memoryTokenRepository) List(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tokens := make([]models.PersonalAccessToken, 0)
+	for _, token := range r.tokens {
+		if token.UserID == userID && r.visibleUser(ctx, userID) {
+			tokens = append(tokens, cloneToken(token))
+		}
+	}
+	return tokens, nil
+}
+
+func (r *memoryTokenRepository) GetByHash(ctx context.Context, hash string) (models.PersonalAccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, token := range r.tokens {
+		if token.Hash == hash && token.RevokedAt == nil && r.visibleUser(ctx, token.UserID) {
+			return cloneToken(token), nil
+		}
+	}
+	return models.PersonalAccessToken{}, ErrNotFound
+}
+
+func (r *memoryTokenRepository) Touch(ctx context.Context, id uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id == 0 || id > uint(len(r.tokens)) || !r.visibleUser(ctx, r.tokens[id-1].UserID) {
+		return ErrNotFound
+	}
+	r.tokens[id-1].LastUsedAt = &at
+	return nil
+}
+
+func (r *memoryTokenRepository) Revoke(ctx context.Context, userID, id uint) (models.PersonalAccessToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id == 0 || id > uint(len(r.tokens)) || r.tokens[id-1].UserID != userID || r.tokens[id-1].RevokedAt != nil ||
+		!r.visibleUser(ctx, userID) {
+		return models.PersonalAccessToken{}, ErrNotFound
+	}
+	now := time.Now()
+	r.tokens[id-1].RevokedAt = &now
+	return cloneToken(r.tokens[id-1]), nil
+}
+
+type memoryOrganizationRepository struct {
+	*memoryStore
+}
+
+func (r *memoryOrganizationRepository) Create(_ context.Context, organization *models.Organization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.organizations {
+		if existing.Name == organization.Name {
+			return ErrDuplicate
+		}
+	}
+	organization.ID = uint(len(r.organizations) + 1)
+	organization.CreatedAt = time.Now()
+	r.organizations = append(r.organizations, *organization)
+	return nil
+}
+
+func (r *memoryOrganizationRepository) List(_ context.Context) ([]models.Organization, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.organizations), nil
+}
+
+func (r *memoryOrganizationRepository) GetByID(_ context.Context, id uint) (models.Organization, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if id == 0 || id > uint(len(r.organizations)) {
+		return models.Organization{}, ErrNotFound
+	}
+	return r.organizations[id-1], nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ananikitina/time-tracker/encryption"
+	"github.com/ananikitina/time-tracker/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// passportBatchSize is the number of users re-encrypted in one transaction
+const passportBatchSize = 500
+
+// passportAD binds the encrypted passport to its column and its user,
+// so that ciphertexts can't be swapped between users
+func passportAD(userID uint) []byte {
+	return []byte(fmt.Sprintf("users.passport:%d", userID))
+}
+
+// sealPassport encrypts the user's passport bound to the user's ID and computes its blind index
+func sealPassport(keys *encryption.Keyring, user *models.User) error {
+	if user.ID == 0 {
+		return fmt.Errorf("encrypting passport: user has no ID")
+	}
+	keyID, ciphertext, err := keys.Encrypt([]byte(user.Passport.String()), passportAD(user.ID))
+	if err != nil {
+		return fmt.Errorf("encrypting passport: %w", err)
+	}
+	user.PassportKeyID = keyID
+	user.PassportCiphertext = ciphertext
+	user.PassportIndex = passportIndex(keys, user.Passport)
+	return nil
+}
+
+// openPassport decrypts the user's passport
+func openPassport(keys *encryption.Keyring, user *models.User) error {
+	plaintext, err := keys.Decrypt(user.PassportKeyID, user.PassportCiphertext, passportAD(user.ID))
+	if err != nil {
+		return fmt.Errorf("decrypting passport of user %d: %w", user.ID, err)
+	}
+	if user.Passport, err = models.ParsePassport(string(plaintext)); err != nil {
+		return fmt.Errorf("decrypting passport of user %d: %w", user.ID, err)
+	}
+	return nil
+}
+
+// passportIndex returns the blind index of the passport
+func passportIndex(keys *encryption.Keyring, passport models.Passport) string {
+	return keys.BlindIndex([]byte(passport.String()))
+}
+
+// storedPassport is the passport of a user as stored: in plain text before it has been encrypted
+type storedPassport struct {
+	ID                 uint
+	PassportSeries     *string
+	PassportNumber     *string
+	PassportCiphertext []byte
+	PassportKeyID      *string
+}
+
+// passport returns the stored passport in plain text
+func (s storedPassport) passport(keys *encryption.Keyring) (models.Passport, error) {
+	if s.PassportCiphertext == nil {
+		if s.PassportSeries == nil || s.PassportNumber == nil {
+			return models.Passport{}, fmt.Errorf("user %d has no passport", s.ID)
+		}
+		return models.Passport{Series: *s.PassportSeries, Number: *s.PassportNumber}, nil
+	}
+
+	user := models.User{ID: s.ID, PassportCiphertext: s.PassportCiphertext}
+	if s.PassportKeyID != nil {
+		user.PassportKeyID = *s.PassportKeyID
+	}
+	if err := openPassport(keys, &user); err != nil {
+		return models.Passport{}, err
+	}
+	return user.Passport, nil
+}
+
+// EncryptPassports encrypts under the current key the passports stored in plain text
+// or under another key, or every passport if all is true, e.g. after changing the index key.
+// It returns the number of users updated.
+func EncryptPassports(ctx context.Context, db *gorm.DB, keys *encryption.Keyring, all bool) (int, error) {
+	return updatePassports(ctx, db, keys, all, func(user *models.User) map[string]interface{} {
+		return map[string]interface{}{
+			"passport_ciphertext": user.PassportCiphertext,
+			"passport_key_id":     user.PassportKeyID,
+			"passport_index":      user.PassportIndex,
+			"passport_series":     nil,
+			"passport_number":     nil,
+		}
+	})
+}
+
+// DecryptPassports stores all passports in plain text again,
+// so that the encryption migration can be reverted. It returns the number of users updated.
+func DecryptPassports(ctx context.Context, db *gorm.DB, keys *encryption.Keyring) (int, error) {
+	return updatePassports(ctx, db, keys, true, func(user *models.User) map[string]interface{} {
+		return map[string]interface{}{
+			"passport_ciphertext": nil,
+			"passport_key_id":     nil,
+			"passport_index":      nil,
+			"passport_series":     user.Passport.Series,
+			"passport_number":     user.Passport.Number,
+		}
+	})
+}
+
+// updatePassports rewrites the stored passports in batches with the columns returned by columns.
+// Unless all is true, only the passports not encrypted under the current key are rewritten.
+func updatePassports(ctx context.Context, db *gorm.DB, keys *encryption.Keyring, all bool,
+	columns func(user *models.User) map[string]interface{}) (int, error) {
+	updated := 0
+	lastID := uint(0)
+	for {
+		var batch []storedPassport
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			query := tx.Table("users").
+				Select("id, passport_series, passport_number, passport_ciphertext, passport_key_id").
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id > ?", lastID)
+			if !all {
+				query = query.Where("passport_ciphertext IS NULL OR passport_key_id <> ?", keys.CurrentKeyID())
+			}
+			if err := query.Order("id").Limit(passportBatchSize).Find(&batch).Error; err != nil {
+				return err
+			}
+
+			for _, stored := range batch {
+				passport, err := stored.passport(keys)
+				if err != nil {
+					return err
+				}
+				user := models.User{ID: stored.ID, Passport: passport}
+				if err := sealPassport(keys, &user); err != nil {
+					return err
+				}
+				if err := tx.Table("users").Where("id = ?", stored.ID).Updates(columns(&user)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return updated, translateError(err)
+		}
+
+		updated += len(batch)
+		if len(batch) < passportBatchSize {
+			return updated, nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
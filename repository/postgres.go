@@ -0,0 +1,1082 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/ananikitina/time-tracker/encryption"
+	"github.com/ananikitina/time-tracker/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewPostgres returns repositories backed by a PostgreSQL database.
+// Passports are encrypted with the keyring.
+func NewPostgres(db *gorm.DB, passportKeys *encryption.Keyring) Repositories {
+	return Repositories{
+		Users:    &postgresUserRepository{db: db, keys: passportKeys},
+		Tasks:    &postgresTaskRepository{db: db},
+		Projects: &postgresProjectRepository{db: db},
+		Audit:    &postgresAuditRepository{db: db},
+		APIKeys:  &postgresAPIKeyRepository{db: db},
+		Tokens:   &postgresTokenRepository{db: db},
+
+		Organizations: &postgresOrganizationRepository{db: db},
+		Tx:            &postgresTransactor{db: db},
+	}
+}
+
+// postgresTxKey is the key of the transaction in the context
+type postgresTxKey struct{}
+
+// conn returns the transaction of the context, otherwise the database
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(postgresTxKey{}).(*gorm.DB); ok {
+		return tx
+	}
+	return db
+}
+
+type postgresTransactor struct {
+	db *gorm.DB
+}
+
+// Transaction runs fn in a database transaction, nested calls use savepoints of the outer one
+func (t *postgresTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return conn(ctx, t.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, postgresTxKey{}, tx))
+	})
+}
+
+// translateError maps GORM errors to the errors of this package
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
+
+type postgresUserRepository struct {
+	db   *gorm.DB
+	keys *encryption.Keyring
+}
+
+func (r *postgresUserRepository) List(ctx context.Context, filter UserFilter) ([]models.User, error) {
+	query := scoped(ctx, conn(ctx, r.db), "users")
+
+	switch filter.Deleted {
+	case DeletedInclude:
+		query = query.Unscoped()
+	case DeletedOnly:
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+
+	if filter.Passport != nil {
+		query = query.Where("passport_index = ?", passportIndex(r.keys, *filter.Passport))
+	}
+	if filter.Surname != "" {
+		query = query.Where("surname = ?", filter.Surname)
+	}
+	if filter.Name != "" {
+		query = query.Where("name = ?", filter.Name)
+	}
+	if filter.Patronymic != "" {
+		query = query.Where("patronymic = ?", filter.Patronymic)
+	}
+	if filter.Address != "" {
+		query = query.Where("address = ?", filter.Address)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.ManagerID != nil {
+		query = query.Where("manager_id = ?", *filter.ManagerID)
+	}
+	if filter.OIDCSubject != "" {
+		query = query.Where("oidc_subject = ?", filter.OIDCSubject)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var users []models.User
+	err := query.Order("id").Offset(filter.Offset).Find(&users).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	for i := range users {
+		if err := openPassport(r.keys, &users[i]); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+func (r *postgresUserRepository) GetByID(ctx context.Context, id uint) (models.User, error) {
+	var user models.User
+	if err := scoped(ctx, conn(ctx, r.db), "users").First(&user, id).Error; err != nil {
+		return user, translateError(err)
+	}
+	return user, openPassport(r.keys, &user)
+}
+
+func (r *postgresUserRepository) Create(ctx context.Context, user *models.User) error {
+	// The ID is taken before the insert, the passport is encrypted bound to it
+	allocated := user.ID == 0
+	if allocated {
+		err := conn(ctx, r.db).WithContext(ctx).Raw("SELECT nextval(pg_get_serial_sequence('users', 'id'))").Scan(&user.ID).Error
+		if err != nil {
+			return translateError(err)
+		}
+	}
+	err := sealPassport(r.keys, user)
+	if err == nil {
+		if err := assignOrganization(ctx, &user.OrganizationID); err != nil {
+			return err
+		}
+		err = translateError(conn(ctx, r.db).WithContext(ctx).Create(user).Error)
+	}
+	if err != nil && allocated {
+		user.ID = 0
+	}
+	return err
+}
+
+func (r *postgresUserRepository) Update(ctx context.Context, user *models.User) error {
+	if err := sealPassport(r.keys, user); err != nil {
+		return err
+	}
+
+	expected := user.Version
+	user.Version++
+	result := scoped(ctx, conn(ctx, r.db), "users").Model(user).
+		Where("version = ?", expected).
+		Select("passport_ciphertext", "passport_key_id", "passport_index", "surname", "name", "patronymic", "address",
+			"role", "manager_id", "oidc_subject", "version").
+		Updates(user)
+	if result.Error != nil || result.RowsAffected == 0 {
+		user.Version = expected
+	}
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return versionError(scoped(ctx, conn(ctx, r.db), "users").Model(&models.User{}).Where("id = ?", user.ID))
+	}
+	return nil
+}
+
+func (r *postgresUserRepository) Delete(ctx context.Context, id uint, version int64) error {
+	query := scoped(ctx, conn(ctx, r.db), "users").Model(&models.User{}).Where("id = ?", id)
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+	result := query.Updates(map[string]interface{}{"deleted_at": time.Now(), "version": gorm.Expr("version + 1")})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return versionError(scoped(ctx, conn(ctx, r.db), "users").Model(&models.User{}).Where("id = ?", id))
+	}
+	return nil
+}
+
+// versionError tells why a conditional change affected no rows:
+// ErrVersionConflict if the record matched by the query still exists, ErrNotFound otherwise
+func versionError(query *gorm.DB) error {
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return translateError(err)
+	}
+	if count > 0 {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
+
+func (r *postgresUserRepository) Restore(ctx context.Context, id uint) (models.User, error) {
+	result := scoped(ctx, conn(ctx, r.db), "users").Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+	if result.Error != nil {
+		return models.User{}, translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.User{}, ErrNotFound
+	}
+	return r.GetByID(ctx, id)
+}
+
+// archiveTasksSQL copies the tasks of the user with their breaks to the archive
+// of the user's organization
+const archiveTasksSQL = `
+INSERT INTO archived_tasks (id, organization_id, user_id, task_name, description, project_id, tags, start_time, end_time, breaks)
+SELECT tasks.id, users.organization_id, tasks.user_id, tasks.task_name, tasks.description, tasks.project_id, tasks.tags,
+       tasks.start_time, tasks.end_time,
+       COALESCE((SELECT jsonb_agg(jsonb_build_object('start_time', task_breaks.start_time, 'end_time', task_breaks.end_time)
+                                  ORDER BY task_breaks.start_time)
+                 FROM task_breaks
+                 WHERE task_breaks.task_id = tasks.id), '[]')
+FROM tasks
+JOIN users ON users.id = tasks.user_id
+WHERE tasks.user_id = ?`
+
+func (r *postgresUserRepository) Purge(ctx context.Context, id uint, policy string) error {
+	err := conn(ctx, r.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the user keeps new tasks from being started meanwhile
+		var user models.User
+		err := scoped(ctx, tx, "users").Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, id).Error
+		if err != nil {
+			return err
+		}
+
+		switch policy {
+		case TasksKeep:
+			var count int64
+			if err := tx.Model(&models.Task{}).Where("user_id = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrUserHasTasks
+			}
+		case TasksArchive:
+			if err := tx.Exec(archiveTasksSQL, id).Error; err != nil {
+				return err
+			}
+			fallthrough
+		case TasksDelete:
+			// Breaks are deleted by the foreign key cascade
+			if err := tx.Where("user_id = ?", id).Delete(&models.Task{}).Error; err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown tasks policy %q", policy)
+		}
+
+		return tx.Unscoped().Delete(&models.User{}, id).Error
+	})
+
+	// The foreign key keeps users with tasks from being purged
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		return ErrUserHasTasks
+	}
+	return translateError(err)
+}
+
+type postgresTaskRepository struct {
+	db *gorm.DB
+}
+
+// withBreaks loads the breaks of the tasks in chronological order
+func withBreaks(db *gorm.DB) *gorm.DB {
+	return db.Preload("Breaks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("start_time")
+	})
+}
+
+// lockActive fetches the user's running task and locks it until the end of the transaction
+func lockActive(ctx context.Context, tx *gorm.DB, userID uint, task *models.Task) error {
+	return scopedByUser(ctx, tx, "tasks.user_id").Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND end_time IS NULL", userID).
+		First(task).Error
+}
+
+// finishTask sets the end time of the running task and of its unfinished break,
+// then reloads the task with its breaks
+func finishTask(tx *gorm.DB, task *models.Task, at time.Time) error {
+	task.Finish(at)
+	err := tx.Model(task).
+		Updates(map[string]interface{}{"end_time": task.EndTime, "version": gorm.Expr("version + 1")}).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&models.TaskBreak{}).
+		Where("task_id = ? AND end_time IS NULL", task.ID).
+		Update("end_time", gorm.Expr("GREATEST(start_time, ?)", *task.EndTime)).Error
+	if err != nil {
+		return err
+	}
+
+	return withBreaks(tx).First(task, task.ID).Error
+}
+
+// bumpVersion increments the version of the task after its breaks changed
+func bumpVersion(tx *gorm.DB, taskID uint) error {
+	return tx.Model(&models.Task{}).Where("id = ?", taskID).Update("version", gorm.Expr("version + 1")).Error
+}
+
+func (r *postgresTaskRepository) Create(ctx context.Context, task *models.Task) error {
+	if err := checkUser(ctx, conn(ctx, r.db), task.UserID); err != nil {
+		return translateError(err)
+	}
+	return translateError(conn(ctx, r.db).WithContext(ctx).Create(task).Error)
+}
+
+func (r *postgresTaskRepository) Update(ctx context.Context, task *models.Task) error {
+	var stored models.Task
+	if err := scopedByUser(ctx, conn(ctx, r.db), "tasks.user_id").Select("id").First(&stored, task.ID).Error; err != nil {
+		return translateError(err)
+	}
+	if err := checkUser(ctx, conn(ctx, r.db), task.UserID); err != nil {
+		return translateError(err)
+	}
+	task.Version++
+	return translateError(conn(ctx, r.db).WithContext(ctx).Omit(clause.Associations).Save(task).Error)
+}
+
+func (r *postgresTaskRepository) Get(ctx context.Context, userID, taskID uint) (models.Task, error) {
+	var task models.Task
+	err := withBreaks(scopedByUser(ctx, conn(ctx, r.db), "tasks.user_id")).Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error
+	return task, translateError(err)
+}
+
+func (r *postgresTaskRepository) CreateEntry(ctx context.Context, task *models.Task) error {
+	err := conn(ctx, r.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(ctx, tx, task.UserID); err != nil {
+			return err
+		}
+		if err := checkOverlap(tx, task); err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Create(task).Error
+	})
+	return translateError(err)
+}
+
+func (r *postgresTaskRepository) UpdateEntry(ctx context.Context, task *models.Task) error {
+	err := conn(ctx, r.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(ctx, tx, task.UserID); err != nil {
+			return err
+		}
+		if err := checkOverlap(tx, task); err != nil {
+			return err
+		}
+
+		expected := task.Version
+		task.Version++
+		result := tx.Model(task).
+			Where("user_id = ? AND version = ?", task.UserID, expected).
+			Select("task_name", "description", "project_id", "tags", "start_time", "end_time", "version").
+			Updates(task)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			task.Version = expected
+			return versionError(tx.Model(&models.Task{}).Where("id = ? AND user_id = ?", task.ID, task.UserID))
+		}
+
+		if task.EndTime != nil {
+			err := tx.Model(&models.TaskBreak{}).
+				Where("task_id = ? AND end_time IS NULL", task.ID).
+				Update("end_time", gorm.Expr("GREATEST(start_time, ?)", *task.EndTime)).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return withBreaks(tx).First(task, task.ID).Error
+	})
+	return translateError(err)
+}
+
+func (r *postgresTaskRepository) Delete(ctx context.Context, userID, taskID uint, version int64) error {
+	query := scopedByUser(ctx, conn(ctx, r.db), "tasks.user_id").Where("user_id = ?", userID)
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+	result := query.Delete(&models.Task{}, taskID)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return versionError(scopedByUser(ctx, conn(ctx, r.db), "tasks.user_id").Model(&models.Task{}).Where("id = ? AND user_id = ?", taskID, userID))
+	}
+	return nil
+}
+
+// lockUser locks the user until the end of the transaction,
+// so that the user's time entries don't change concurrently
+func lockUser(ctx context.Context, tx *gorm.DB, userID uint) error {
+	var user models.User
+	return scoped(ctx, tx, "users").Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error
+}
+
+// checkUser fails with gorm.ErrRecordNotFound unless the user, soft deleted or not,
+// is in the organization of the context
+func checkUser(ctx context.Context, db *gorm.DB, userID uint) error {
+	var user models.User
+	return scoped(ctx, db, "users").Unscoped().Select("id").First(&user, userID).Error
+}
+
+// checkOverlap returns ErrOverlap if the task overlaps another task of the user.
+// Running tasks last indefinitely.
+func checkOverlap(tx *gorm.DB, task *models.Task) error {
+	query := tx.Model(&models.Task{}).
+		Where("user_id = ? AND id <> ?", task.UserID, task.ID).
+		Where("COALESCE(end_time, 'infinity') > ?", task.StartTime)
+	if task.EndTime != nil {
+		query = query.Where("start_time < ?", *task.EndTime)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrOverlap
+	}
+	return nil
+}
+
+func (r *postgresTaskRepository) Start(ctx context.Context, task *models.Task, stopActive bool) (*models.Task, error) {
+	return r.start(ctx, task, stopActive, false)
+}
+
+func (r *postgresTaskRepository) Switch(ctx context.Context, task *models.Task) (models.Task, error) {
+	stopped, err := r.start(ctx, task, true, true)
+	if err != nil {
+		return models.Task{}, err
+	}
+	return *stopped, nil
+}
+
+// start creates a running task in a transaction, finishing the current one
+// if stopActive is true. With requireActive it fails with ErrNotFound
+// if the user has no running task.
+func (r *postgresTaskRepository) start(ctx context.Context, task *models.Task, stopActive, requireActive bool) (*models.Task, error) {
+	var stopped *models.Task
+	err := conn(ctx, r.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the user serializes concurrent starts for the same user
+		if err := lockUser(ctx, tx, task.UserID); err != nil {
+			return err
+		}
+
+		var active models.Task
+		err := lockActive(ctx, tx, task.UserID, &active)
+		switch {
+		case err == nil:
+			if !stopActive {
+				return ErrActiveTask
+			}
+			if err := finishTask(tx, &active, task.StartTime); err != nil {
+				return err
+			}
+			stopped = &active
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		case requireActive:
+			return ErrNotFound
+		}
+
+		return tx.Create(task).Error
+	})
+
+	// The unique index on running tasks is the last line of defense
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrActiveTask
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return stopped, nil
+}
+
+func (r *postgresTaskRepository) Finish(ctx context.Context, userID uint, at time.Time) (models.Task, error) {
+	var task models.Task
+	err := conn(ctx, r.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockActive(ctx, tx, userID, &task); err != nil {
+			return err
+		}
+		return finishTask(tx, &task, at)
+	})
+	return task, translateError(err)
+}
+
+func (r *postgresTaskRepository) Pause(ctx context.Context, userID uint, at time.Time) (models.Task, error) {
+	var task models.Task
+	err := conn(ctx, r.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockActive(ctx, tx, userID, &task); err != nil {
+			return err
+		}
+
+		var paused int64
+		if err := tx.Model(&models.TaskBreak{}).Where("task_id = ? AND end_time IS NULL", task.ID).Count(&paused).Error; err != nil {
+			return err
+		}
+		if paused > 0 {
+			return ErrTaskPaused
+		}
+
+		if at.Before(task.StartTime) {
+			at = task.StartTime
+		}
+		if err := tx.Create(&models.TaskBreak{TaskID: task.ID, StartTime: at}).Error; err != nil {
+			return err
+		}
+		if err := bumpVersion(tx, task.ID); err != nil {
+			return err
+		}
+
+		return withBreaks(tx).First(&task, task.ID).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return models.Task{}, ErrTaskPaused
+	}
+	return task, translateError(err)
+}
+
+func (r *postgresTaskRepository) Resume(ctx context.Context, userID uint, at time.Time) (models.Task, error) {
+	var task models.Task
+	err := conn(ctx, r.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockActive(ctx, tx, userID, &task); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.TaskBreak{}).
+			Where("task_id = ? AND end_time IS NULL", task.ID).
+			Update("end_time", gorm.Expr("GREATEST(start_time, ?)", at))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTaskNotPaused
+		}
+		if err := bumpVersion(tx, task.ID); err != nil {
+			return err
+		}
+
+		return withBreaks(tx).First(&task, task.ID).Error
+	})
+	return task, translateError(err)
+}
+
+func (r *postgresTaskRepository) GetActive(ctx context.Context, userID uint) (models.Task, error) {
+	var task models.Task
+	err := withBreaks(scopedByUser(ctx, conn(ctx, r.db), "tasks.user_id")).Where("user_id = ? AND end_time IS NULL", userID).First(&task).Error
+	return task, translateError(err)
+}
+
+func (r *postgresTaskRepository) ListByUser(ctx context.Context, userID uint) ([]models.Task, error) {
+	var tasks []models.Task
+	err := withBreaks(scopedByUser(ctx, conn(ctx, r.db), "tasks.user_id")).Where("user_id = ?", userID).Order("start_time").Find(&tasks).Error
+	return tasks, translateError(err)
+}
+
+func (r *postgresTaskRepository) ListFinished(ctx context.Context, userID uint, start, end time.Time) ([]models.Task, error) {
+	var tasks []models.Task
+	err := withBreaks(scopedByUser(ctx, conn(ctx, r.db), "tasks.user_id")).
+		Where("user_id = ? AND start_time >= ? AND end_time <= ?", userID, start, end).
+		Order("start_time").
+		Find(&tasks).Error
+	return tasks, translateError(err)
+}
+
+// workedSecondsSQL is the time worked on a task within the period @start - @end:
+// the task clipped to the period minus its breaks clipped the same way.
+// Running tasks last until @now. It needs the breaks join.
+const workedSecondsSQL = "EXTRACT(EPOCH FROM LEAST(COALESCE(tasks.end_time, @now), @end) - GREATEST(tasks.start_time, @start)) " +
+	"- COALESCE(breaks.paused_seconds, 0)"
+
+// breaksJoinSQL sums up the breaks of every task clipped to the period.
+// Unfinished breaks last until the end of the task.
+const breaksJoinSQL = `LEFT JOIN LATERAL (
+	SELECT SUM(EXTRACT(EPOCH FROM
+		LEAST(COALESCE(task_breaks.end_time, tasks.end_time, @now), @end) - GREATEST(task_breaks.start_time, @start)
+	)) AS paused_seconds
+	FROM task_breaks
+	WHERE task_breaks.task_id = tasks.id
+	  AND task_breaks.start_time < @end
+	  AND COALESCE(task_breaks.end_time, tasks.end_time, @now) > @start
+) AS breaks ON TRUE`
+
+// periodSQL keeps the tasks overlapping the period
+const periodSQL = "tasks.start_time < @end AND COALESCE(tasks.end_time, @now) > @start"
+
+func (r *postgresTaskRepository) Workload(ctx context.Context, filter WorkloadFilter) ([]models.TaskWorkload, error) {
+	period := map[string]interface{}{"start": filter.Start, "end": filter.End, "now": filter.Now}
+	total := "CAST(SUM(" + workedSecondsSQL + ") AS BIGINT) AS total_seconds"
+
+	query := scopedByUser(ctx, conn(ctx, r.db), "tasks.user_id").Model(&models.Task{}).
+		Joins(breaksJoinSQL, period).
+		Where("tasks.user_id = ?", filter.UserID).
+		Where(periodSQL, period)
+	if !filter.IncludeActive {
+		query = query.Where("tasks.end_time IS NOT NULL")
+	}
+	if filter.ProjectID != nil {
+		query = query.Where("tasks.project_id = ?", *filter.ProjectID)
+	}
+
+	if filter.GroupBy == WorkloadByProject {
+		query = query.
+			Select("tasks.project_id AS project_id, COALESCE(projects.name, '') AS project, "+total, period).
+			Joins("LEFT JOIN projects ON projects.id = tasks.project_id").
+			Group("tasks.project_id, projects.name").
+			Order("total_seconds DESC, project")
+	} else {
+		query = query.
+			Select("tasks.task_name AS task, "+total, period).
+			Group("tasks.task_name").
+			Order("total_seconds DESC, task")
+	}
+
+	var workload []models.TaskWorkload
+	if err := query.Scan(&workload).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	for i := range workload {
+		workload[i].SetTotal(workload[i].TotalSeconds)
+	}
+	return workload, nil
+}
+
+// reportPiecesJoinSQL splits every task into the parts worked on each day of the @tz time zone
+// within the period @start - @end. Running tasks last until @now.
+const reportPiecesJoinSQL = `CROSS JOIN LATERAL (
+	SELECT days.day,
+		GREATEST(tasks.start_time, @start, days.day AT TIME ZONE CAST(@tz AS TEXT)) AS start_time,
+		LEAST(COALESCE(tasks.end_time, @now), @end, (days.day + INTERVAL '1 day') AT TIME ZONE CAST(@tz AS TEXT)) AS end_time
+	FROM generate_series(
+		date_trunc('day', GREATEST(tasks.start_time, @start) AT TIME ZONE CAST(@tz AS TEXT)),
+		LEAST(COALESCE(tasks.end_time, @now), @end) AT TIME ZONE CAST(@tz AS TEXT),
+		INTERVAL '1 day'
+	) AS days(day)
+) AS pieces`
+
+// reportBreaksJoinSQL sums up the breaks of every task piece clipped to the piece.
+// Unfinished breaks last until the end of the task.
+const reportBreaksJoinSQL = `LEFT JOIN LATERAL (
+	SELECT SUM(EXTRACT(EPOCH FROM
+		LEAST(COALESCE(task_breaks.end_time, tasks.end_time, @now), pieces.end_time) - GREATEST(task_breaks.start_time, pieces.start_time)
+	)) AS paused_seconds
+	FROM task_breaks
+	WHERE task_breaks.task_id = tasks.id
+	  AND task_breaks.start_time < pieces.end_time
+	  AND COALESCE(task_breaks.end_time, tasks.end_time, @now) > pieces.start_time
+) AS breaks ON TRUE`
+
+// reportDimensionSQL tells how to select, group and order the team report by each dimension.
+// The grouping expression is the one GROUPING() checks for the dimension.
+var reportDimensionSQL = map[string]struct {
+	selects  string
+	group    string
+	grouping string
+	order    string
+}{
+	ReportByUser: {
+		selects:  `tasks.user_id AS user_id, TRIM(users.surname || ' ' || users.name) AS "user"`,
+		group:    "(tasks.user_id, users.surname, users.name)",
+		grouping: "tasks.user_id",
+		order:    "users.surname, users.name, tasks.user_id",
+	},
+	ReportByDay: {
+		selects:  "to_char(pieces.day, 'YYYY-MM-DD') AS day",
+		group:    "pieces.day",
+		grouping: "pieces.day",
+		order:    "pieces.day",
+	},
+	ReportByWeek: {
+		selects:  "to_char(date_trunc('week', pieces.day), 'YYYY-MM-DD') AS week",
+		group:    "date_trunc('week', pieces.day)",
+		grouping: "date_trunc('week', pieces.day)",
+		order:    "date_trunc('week', pieces.day)",
+	},
+	ReportByTask: {
+		selects:  "tasks.task_name AS task",
+		group:    "tasks.task_name",
+		grouping: "tasks.task_name",
+		order:    "tasks.task_name",
+	},
+	ReportByProject: {
+		selects:  "tasks.project_id AS project_id, COALESCE(projects.name, '') AS project",
+		group:    "(tasks.project_id, projects.name)",
+		grouping: "tasks.project_id",
+		order:    "projects.name NULLS FIRST, tasks.project_id",
+	},
+}
+
+// teamReportRow is a team report row with the GROUPING() bit mask of its rolled up dimensions
+type teamReportRow struct {
+	models.TimeReportRow
+	RolledUp int64
+}
+
+func (r *postgresTaskRepository) TeamReport(ctx context.Context, filter TeamReportFilter) ([]models.TimeReportRow, error) {
+	params := map[string]interface{}{
+		"start": filter.Start,
+		"end":   filter.End,
+		"now":   filter.Now,
+		"tz":    filter.Location.String(),
+	}
+
+	var selects, groups, groupings, orders []string
+	for _, dimension := range filter.GroupBy {
+		sql := reportDimensionSQL[dimension]
+		selects = append(selects, sql.selects)
+		groups = append(groups, sql.group)
+		groupings = append(groupings, sql.grouping)
+		// Subtotals go after the rows they sum up
+		orders = append(orders, "GROUPING("+sql.grouping+")", sql.order)
+	}
+	selects = append(selects,
+		"CAST(COALESCE(SUM(EXTRACT(EPOCH FROM pieces.end_time - pieces.start_time) - COALESCE(breaks.paused_seconds, 0)), 0) AS BIGINT) AS total_seconds",
+		"GROUPING("+strings.Join(groupings, ", ")+") AS rolled_up")
+
+	query := scoped(ctx, conn(ctx, r.db), "users").Model(&models.Task{}).
+		Select(strings.Join(selects, ", ")).
+		Joins("JOIN users ON users.id = tasks.user_id").
+		Joins("LEFT JOIN projects ON projects.id = tasks.project_id").
+		Joins(reportPiecesJoinSQL, params).
+		Joins(reportBreaksJoinSQL, params).
+		Where(periodSQL, params).
+		Where("pieces.end_time > pieces.start_time")
+	if len(filter.UserIDs) > 0 {
+		query = query.Where("tasks.user_id IN ?", filter.UserIDs)
+	}
+	if !filter.IncludeActive {
+		query = query.Where("tasks.end_time IS NOT NULL")
+	}
+	if filter.ProjectID != nil {
+		query = query.Where("tasks.project_id = ?", *filter.ProjectID)
+	}
+
+	var rows []teamReportRow
+	err := query.
+		Group("ROLLUP (" + strings.Join(groups, ", ") + ")").
+		Order(strings.Join(orders, ", ")).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	report := make([]models.TimeReportRow, 0, len(rows))
+	for _, row := range rows {
+		level := len(filter.GroupBy) - bits.OnesCount64(uint64(row.RolledUp))
+		row.GroupedBy = filter.GroupBy[:level]
+		row.SetTotal(row.TotalSeconds)
+		report = append(report, row.TimeReportRow)
+	}
+	return report, nil
+}
+
+type postgresProjectRepository struct {
+	db *gorm.DB
+}
+
+func (r *postgresProjectRepository) List(ctx context.Context, filter ProjectFilter) ([]models.Project, error) {
+	query := scoped(ctx, conn(ctx, r.db), "projects")
+
+	if filter.Client != "" {
+		query = query.Where("client = ?", filter.Client)
+	}
+	if filter.Archived != nil {
+		query = query.Where("archived = ?", *filter.Archived)
+	}
+
+	var projects []models.Project
+	err := query.Order("name").Find(&projects).Error
+	return projects, translateError(err)
+}
+
+func (r *postgresProjectRepository) GetByID(ctx context.Context, id uint) (models.Project, error) {
+	var project models.Project
+	err := scoped(ctx, conn(ctx, r.db), "projects").First(&project, id).Error
+	return project, translateError(err)
+}
+
+func (r *postgresProjectRepository) Create(ctx context.Context, project *models.Project) error {
+	if err := assignOrganization(ctx, &project.OrganizationID); err != nil {
+		return err
+	}
+	return translateError(conn(ctx, r.db).WithContext(ctx).Create(project).Error)
+}
+
+func (r *postgresProjectRepository) Update(ctx context.Context, project *models.Project) error {
+	result := scoped(ctx, conn(ctx, r.db), "projects").Model(project).
+		Select("name", "client", "color", "archived").
+		Updates(project)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresProjectRepository) Delete(ctx context.Context, id uint) error {
+	result := scoped(ctx, conn(ctx, r.db), "projects").Delete(&models.Project{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type postgresAuditRepository struct {
+	db *gorm.DB
+}
+
+// Classes of the advisory locks serializing the appends to the hash chains,
+// the second key of a lock is the organization whose chain is appended to
+const (
+	auditChainLockClass    = 72645198
+	revisionChainLockClass = 72645199
+)
+
+// lockChain waits for the appends to the chain of the organization to finish, until the end of the transaction
+func lockChain(tx *gorm.DB, class int32, organizationID uint) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", class, int32(organizationID)).Error
+}
+
+func (r *postgresAuditRepository) Record(ctx context.Context, entry *models.AuditEntry) error {
+	if err := assignOrganization(ctx, &entry.OrganizationID); err != nil {
+		return err
+	}
+	err := conn(ctx, r.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockChain(tx, auditChainLockClass, entry.OrganizationID); err != nil {
+			return err
+		}
+		var last models.AuditEntry
+		err := tx.Select("hash").Where("organization_id = ?", entry.OrganizationID).Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		if err := sealAuditEntry(entry, last.Hash); err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+	return translateError(err)
+}
+
+func (r *postgresAuditRepository) List(ctx context.Context, filter AuditFilter) ([]models.AuditEntry, error) {
+	query := scoped(ctx, conn(ctx, r.db), "audit_entries")
+
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	entries := make([]models.AuditEntry, 0)
+	err := query.Order("created_at DESC, id DESC").Offset(filter.Offset).Limit(filter.Limit).Find(&entries).Error
+	return entries, translateError(err)
+}
+
+func (r *postgresAuditRepository) RecordRevision(ctx context.Context, revision *models.TaskRevision) error {
+	if err := assignOrganization(ctx, &revision.OrganizationID); err != nil {
+		return err
+	}
+	err := conn(ctx, r.db).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockChain(tx, revisionChainLockClass, revision.OrganizationID); err != nil {
+			return err
+		}
+		var last models.TaskRevision
+		err := tx.Select("hash").Where("organization_id = ?", revision.OrganizationID).Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		if err := sealRevision(revision, last.Hash); err != nil {
+			return err
+		}
+		return tx.Create(revision).Error
+	})
+	return translateError(err)
+}
+
+func (r *postgresAuditRepository) ListRevisions(ctx context.Context, userID, taskID uint) ([]models.TaskRevision, error) {
+	revisions := make([]models.TaskRevision, 0)
+	err := scoped(ctx, conn(ctx, r.db), "task_revisions").Where("task_id = ? AND user_id = ?", taskID, userID).Order("id").Find(&revisions).Error
+	return revisions, translateError(err)
+}
+
+func (r *postgresAuditRepository) Verify(ctx context.Context) ([]models.ChainVerification, error) {
+	query := conn(ctx, r.db).WithContext(ctx).Model(&models.Organization{})
+	if organizationID := OrganizationFrom(ctx); organizationID != 0 {
+		query = query.Where("id = ?", organizationID)
+	} else if !isSystem(ctx) {
+		query = query.Where("FALSE")
+	}
+	var organizationIDs []uint
+	if err := query.Order("id").Pluck("id", &organizationIDs).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	chains := make([]models.ChainVerification, 0, 2*len(organizationIDs))
+	for _, organizationID := range organizationIDs {
+		audit := newChainVerifier(models.ChainAudit, organizationID)
+		if err := walkChain(conn(ctx, r.db).WithContext(ctx), organizationID, audit, auditLink); err != nil {
+			return nil, translateError(err)
+		}
+		revisions := newChainVerifier(models.ChainTaskRevisions, organizationID)
+		if err := walkChain(conn(ctx, r.db).WithContext(ctx), organizationID, revisions, revisionLink); err != nil {
+			return nil, translateError(err)
+		}
+		chains = append(chains, audit.result, revisions.result)
+	}
+	return chains, nil
+}
+
+// walkChain reads the records of the chain of the organization in batches in the order of their IDs
+// and checks them until the first broken link
+func walkChain[T any](db *gorm.DB, organizationID uint, verifier *chainVerifier, link func(record T) chainLink) error {
+	lastID := uint(0)
+	for verifier.result.Valid {
+		var batch []T
+		err := db.Where("organization_id = ? AND id > ?", organizationID, lastID).Order("id").Limit(chainBatchSize).Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		for _, record := range batch {
+			next := link(record)
+			if err := verifier.check(next); err != nil {
+				return err
+			}
+			lastID = next.ID
+		}
+		if len(batch) < chainBatchSize {
+			break
+		}
+	}
+	return nil
+}
+
+type postgresAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *postgresAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	if err := assignOrganization(ctx, &key.OrganizationID); err != nil {
+		return err
+	}
+	key.CreatedAt = time.Now()
+	return translateError(conn(ctx, r.db).WithContext(ctx).Create(key).Error)
+}
+
+func (r *postgresAPIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	keys := make([]models.APIKey, 0)
+	err := scoped(ctx, conn(ctx, r.db), "api_keys").Order("id").Find(&keys).Error
+	return keys, translateError(err)
+}
+
+func (r *postgresAPIKeyRepository) GetByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	var key models.APIKey
+	err := scoped(ctx, conn(ctx, r.db), "api_keys").Where("hash = ? AND revoked_at IS NULL", hash).First(&key).Error
+	return key, translateError(err)
+}
+
+func (r *postgresAPIKeyRepository) Revoke(ctx context.Context, id uint) (models.APIKey, error) {
+	var key models.APIKey
+	result := scoped(ctx, conn(ctx, r.db), "api_keys").Model(&key).Clauses(clause.Returning{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return models.APIKey{}, translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.APIKey{}, ErrNotFound
+	}
+	return key, nil
+}
+
+type postgresTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *postgresTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	if err := checkUser(ctx, conn(ctx, r.db), token.UserID); err != nil {
+		return translateError(err)
+	}
+	token.CreatedAt = time.Now()
+	return translateError(conn(ctx, r.db).WithContext(ctx).Create(token).Error)
+}
+
+func (r *postgresTokenRepository) List(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	tokens := make([]models.PersonalAccessToken, 0)
+	err := scopedByUser(ctx, conn(ctx, r.db), "personal_access_tokens.user_id").Where("user_id = ?", userID).Order("id").Find(&tokens).Error
+	return tokens, translateError(err)
+}
+
+func (r *postgresTokenRepository) GetByHash(ctx context.Context, hash string) (models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	err := scopedByUser(ctx, conn(ctx, r.db), "personal_access_tokens.user_id").Where("hash = ? AND revoked_at IS NULL", hash).First(&token).Error
+	return token, translateError(err)
+}
+
+func (r *postgresTokenRepository) Touch(ctx context.Context, id uint, at time.Time) error {
+	result := scopedByUser(ctx, conn(ctx, r.db), "personal_access_tokens.user_id").Model(&models.PersonalAccessToken{}).
+		Where("id = ?", id).Update("last_used_at", at)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresTokenRepository) Revoke(ctx context.Context, userID, id uint) (models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	result := scopedByUser(ctx, conn(ctx, r.db), "personal_access_tokens.user_id").Model(&token).Clauses(clause.Returning{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return models.PersonalAccessToken{}, translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.PersonalAccessToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+type postgresOrganizationRepository struct {
+	db *gorm.DB
+}
+
+func (r *postgresOrganizationRepository) Create(ctx context.Context, organization *models.Organization) error {
+	return translateError(conn(ctx, r.db).WithContext(ctx).Create(organization).Error)
+}
+
+func (r *postgresOrganizationRepository) List(ctx context.Context) ([]models.Organization, error) {
+	organizations := make([]models.Organization, 0)
+	err := conn(ctx, r.db).WithContext(ctx).Order("id").Find(&organizations).Error
+	return organizations, translateError(err)
+}
+
+func (r *postgresOrganizationRepository) GetByID(ctx context.Context, id uint) (models.Organization, error) {
+	var organization models.Organization
+	err := conn(ctx, r.db).WithContext(ctx).First(&organization, id).Error
+	return organization, translateError(err)
+}
@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a record violates a uniqueness constraint
+	ErrDuplicate = errors.New("duplicate record")
+	// ErrActiveTask is returned when the user already has a running task
+	ErrActiveTask = errors.New("user already has an active task")
+	// ErrTaskPaused is returned when pausing a task that is already paused
+	ErrTaskPaused = errors.New("task is already paused")
+	// ErrTaskNotPaused is returned when resuming a task that is not paused
+	ErrTaskNotPaused = errors.New("task is not paused")
+	// ErrOverlap is returned when a time entry overlaps another entry of the user
+	ErrOverlap = errors.New("time entry overlaps another entry")
+	// ErrUserHasTasks is returned when purging a user who has tasks under the keep policy
+	ErrUserHasTasks = errors.New("user has tasks")
+	// ErrVersionConflict is returned when a record was changed since the version the change is based on
+	ErrVersionConflict = errors.New("record has been changed")
+	// ErrNoOrganization is returned when creating a record with a context that has no organization and is not a system one
+	ErrNoOrganization = errors.New("no organization in the context")
+)
+
+// Which users to list by their soft delete
+const (
+	// DeletedExclude lists only the users not deleted, it is the default
+	DeletedExclude = ""
+	// DeletedInclude lists all users
+	DeletedInclude = "include"
+	// DeletedOnly lists only the soft deleted users
+	DeletedOnly = "only"
+)
+
+// UserFilter describes which users to list and which page to return.
+// Nil and empty string fields are not used for filtering.
+type UserFilter struct {
+	Passport   *models.Passport
+	Surname    string
+	Name       string
+	Patronymic string
+	Address    string
+	Deleted    string
+	Role       string
+	// ManagerID lists the team of the manager
+	ManagerID *uint
+	// OIDCSubject finds the user logging in with the identity provider
+	OIDCSubject string
+
+	Offset int
+	// Limit is the page size, 0 lists all users
+	Limit int
+}
+
+// ProjectFilter describes which projects to list.
+// Nil and empty fields are not used for filtering.
+type ProjectFilter struct {
+	Client   string
+	Archived *bool
+}
+
+// AuditFilter describes which audit entries to list and which page to return.
+// Empty and zero fields are not used for filtering. Entries are listed from the newest.
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	EntityType string
+	EntityID   uint
+	RequestID  string
+	// From and To limit the entries to the period [From, To)
+	From time.Time
+	To   time.Time
+
+	Offset int
+	Limit  int
+}
+
+// Workload grouping
+const (
+	WorkloadByTask    = "task"
+	WorkloadByProject = "project"
+)
+
+// WorkloadFilter describes the period of a workload report.
+// Running tasks are counted up to Now, or skipped if IncludeActive is false.
+// Breaks are not counted. The time is summed up per task name or per project
+// depending on GroupBy, ProjectID limits the report to one project.
+type WorkloadFilter struct {
+	UserID        uint
+	Start         time.Time
+	End           time.Time
+	Now           time.Time
+	IncludeActive bool
+	ProjectID     *uint
+	GroupBy       string
+}
+
+// Team report dimensions. Weeks start on Monday.
+const (
+	ReportByUser    = "user"
+	ReportByDay     = "day"
+	ReportByWeek    = "week"
+	ReportByTask    = "task"
+	ReportByProject = "project"
+)
+
+// TeamReportFilter describes a report over the time of several users.
+// The time is summed up per combination of the GroupBy dimensions, with subtotals
+// for every prefix of them and the grand total, like SQL ROLLUP does.
+// Days and weeks are taken in Location. Empty UserIDs means all users.
+type TeamReportFilter struct {
+	UserIDs       []uint
+	ProjectID     *uint
+	Start         time.Time
+	End           time.Time
+	Now           time.Time
+	Location      *time.Location
+	IncludeActive bool
+	GroupBy       []string
+}
+
+// What happens to the tasks of a purged user
+const (
+	// TasksKeep keeps the tasks: a user who has tasks is not purged, ErrUserHasTasks is returned
+	TasksKeep = "keep"
+	// TasksArchive moves the tasks with their breaks to the archive
+	TasksArchive = "archive"
+	// TasksDelete deletes the tasks with their breaks
+	TasksDelete = "delete"
+)
+
+// UserRepository stores users. Soft deleted users are not found by GetByID
+// and are listed only if the filter asks for them.
+// Every change increments the version of the user.
+type UserRepository interface {
+	List(ctx context.Context, filter UserFilter) ([]models.User, error)
+	GetByID(ctx context.Context, id uint) (models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	// Update saves the user if the stored version is still user.Version,
+	// otherwise it returns ErrVersionConflict. The new version is set in user.
+	Update(ctx context.Context, user *models.User) error
+	// Delete soft deletes the user if the stored version is the given one, any version if it is 0.
+	// The user's tasks are kept.
+	Delete(ctx context.Context, id uint, version int64) error
+	// Restore undoes the soft delete of the user.
+	// It returns ErrNotFound if there is no soft deleted user with the ID.
+	Restore(ctx context.Context, id uint) (models.User, error)
+	// Purge removes the user permanently, soft deleted or not,
+	// the user's tasks are kept, archived or deleted according to the policy
+	Purge(ctx context.Context, id uint, policy string) error
+}
+
+// TaskRepository stores tasks. Every change of a task or its breaks increments the version of the task.
+type TaskRepository interface {
+	Create(ctx context.Context, task *models.Task) error
+	Update(ctx context.Context, task *models.Task) error
+	// Get returns the user's task with its breaks
+	Get(ctx context.Context, userID, taskID uint) (models.Task, error)
+	// CreateEntry creates a time entry unless it overlaps the user's other entries.
+	// Running entries last indefinitely.
+	CreateEntry(ctx context.Context, task *models.Task) error
+	// UpdateEntry saves a time entry unless it overlaps the user's other entries.
+	// An unfinished break ends together with the entry. Like UserRepository.Update,
+	// it returns ErrVersionConflict if the entry is no longer at task.Version.
+	UpdateEntry(ctx context.Context, task *models.Task) error
+	// Delete removes the user's task with its breaks if the task is at the version, at any version if it is 0
+	Delete(ctx context.Context, userID, taskID uint, version int64) error
+	// Start creates a running task. If the user already has one, it is
+	// finished at the start of the new task when stopActive is true,
+	// otherwise ErrActiveTask is returned. The finished task is returned.
+	Start(ctx context.Context, task *models.Task, stopActive bool) (*models.Task, error)
+	// Switch finishes the user's running task and starts the new one at the same moment.
+	// It returns ErrNotFound if the user has no running task.
+	Switch(ctx context.Context, task *models.Task) (models.Task, error)
+	// Finish sets the end time of the user's running task and of its unfinished break
+	Finish(ctx context.Context, userID uint, at time.Time) (models.Task, error)
+	// Pause starts a break in the user's running task
+	Pause(ctx context.Context, userID uint, at time.Time) (models.Task, error)
+	// Resume finishes the break in the user's running task
+	Resume(ctx context.Context, userID uint, at time.Time) (models.Task, error)
+	// GetActive returns the user's running task
+	GetActive(ctx context.Context, userID uint) (models.Task, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.Task, error)
+	// ListFinished returns the user's tasks that started and finished within the period
+	ListFinished(ctx context.Context, userID uint, start, end time.Time) ([]models.Task, error)
+	// Workload sums up the user's time per task or project, from the largest to the smallest
+	Workload(ctx context.Context, filter WorkloadFilter) ([]models.TaskWorkload, error)
+	// TeamReport sums up the time of the users per group, ordered by the dimensions
+	// with subtotals after their groups and the grand total last
+	TeamReport(ctx context.Context, filter TeamReportFilter) ([]models.TimeReportRow, error)
+}
+
+type ProjectRepository interface {
+	List(ctx context.Context, filter ProjectFilter) ([]models.Project, error)
+	GetByID(ctx context.Context, id uint) (models.Project, error)
+	Create(ctx context.Context, project *models.Project) error
+	Update(ctx context.Context, project *models.Project) error
+	// Delete removes the project, its tasks are kept without a project
+	Delete(ctx context.Context, id uint) error
+}
+
+// AuditRepository stores the audit log and the revisions of the finished tasks.
+// Both are append-only hash chains: every record holds the SHA-256 hash of its content and of the previous record.
+type AuditRepository interface {
+	// Record adds the entry to the log, the creation time is set if it is empty
+	Record(ctx context.Context, entry *models.AuditEntry) error
+	List(ctx context.Context, filter AuditFilter) ([]models.AuditEntry, error)
+	// RecordRevision adds the revision to the history of its task
+	RecordRevision(ctx context.Context, revision *models.TaskRevision) error
+	// ListRevisions returns the revisions of the user's task from the oldest
+	ListRevisions(ctx context.Context, userID, taskID uint) ([]models.TaskRevision, error)
+	// Verify walks the chains of the organization in the context, or of every organization without one,
+	// and reports the first broken link of each
+	Verify(ctx context.Context) ([]models.ChainVerification, error)
+}
+
+type APIKeyRepository interface {
+	// Create stores the key, the creation time is set
+	Create(ctx context.Context, key *models.APIKey) error
+	// List returns all keys including the revoked ones from the oldest
+	List(ctx context.Context) ([]models.APIKey, error)
+	// GetByHash returns the key with the hash unless it is revoked
+	GetByHash(ctx context.Context, hash string) (models.APIKey, error)
+	// Revoke revokes the key, it returns ErrNotFound if there is no such key or it is already revoked
+	Revoke(ctx context.Context, id uint) (models.APIKey, error)
+}
+
+type TokenRepository interface {
+	// Create stores the token, the creation time is set
+	Create(ctx context.Context, token *models.PersonalAccessToken) error
+	// List returns the user's tokens including the revoked and expired ones from the oldest
+	List(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error)
+	// GetByHash returns the token with the hash unless it is revoked, expired tokens are returned
+	GetByHash(ctx context.Context, hash string) (models.PersonalAccessToken, error)
+	// Touch records that the token was used at the time
+	Touch(ctx context.Context, id uint, at time.Time) error
+	// Revoke revokes the user's token, it returns ErrNotFound if the user has no such token or it is already revoked
+	Revoke(ctx context.Context, userID, id uint) (models.PersonalAccessToken, error)
+}
+
+type OrganizationRepository interface {
+	// Create stores the organization, the creation time is set. It returns ErrDuplicate if the name is taken.
+	Create(ctx context.Context, organization *models.Organization) error
+	List(ctx context.Context) ([]models.Organization, error)
+	GetByID(ctx context.Context, id uint) (models.Organization, error)
+}
+
+// Transactor makes several changes of the repositories atomic
+type Transactor interface {
+	// Transaction calls fn with a context carrying a transaction: the changes the repositories make with it
+	// are committed together if fn returns nil and rolled back otherwise. Nested calls join the outer transaction.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Repositories groups the repositories of every entity.
+// All but the organizations are limited to the organization in the context, see WithOrganization.
+type Repositories struct {
+	Users         UserRepository
+	Tasks         TaskRepository
+	Projects      ProjectRepository
+	Audit         AuditRepository
+	APIKeys       APIKeyRepository
+	Tokens        TokenRepository
+	Organizations OrganizationRepository
+	Tx            Transactor
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ananikitina/time-tracker/models"
+
+	"gorm.io/gorm"
+)
+
+// organizationKey is the key of the organization in the context
+type organizationKey struct{}
+
+// systemKey marks the contexts of the service itself in the context
+type systemKey struct{}
+
+// WithOrganization returns the context limiting the repositories to the organization:
+// they only see and change its data, and the records created get its ID.
+// Without an organization in the context the repositories see no data and create nothing,
+// unless the context is a system one.
+func WithOrganization(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, organizationKey{}, organizationID)
+}
+
+// WithSystem returns the context of the service itself, in which the repositories see all organizations
+// unless it also has an organization. Only the commands, the migrations and the authentication,
+// which finds the organization of the request, use it.
+func WithSystem(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemKey{}, true)
+}
+
+// isSystem reports whether the context is a system one
+func isSystem(ctx context.Context) bool {
+	system, _ := ctx.Value(systemKey{}).(bool)
+	return system
+}
+
+// OrganizationFrom returns the organization the context limits the repositories to, 0 if none
+func OrganizationFrom(ctx context.Context) uint {
+	organizationID, _ := ctx.Value(organizationKey{}).(uint)
+	return organizationID
+}
+
+// assignOrganization sets the organization a new record created with the context belongs to:
+// the one of the context, otherwise, in a system context, the one already set or the default organization.
+// It returns ErrNoOrganization for the other contexts.
+func assignOrganization(ctx context.Context, organizationID *uint) error {
+	switch {
+	case OrganizationFrom(ctx) != 0:
+		*organizationID = OrganizationFrom(ctx)
+	case !isSystem(ctx):
+		return ErrNoOrganization
+	case *organizationID == 0:
+		*organizationID = models.DefaultOrganizationID
+	}
+	return nil
+}
+
+// inOrganization reports whether the record of the organization is visible with the context
+func inOrganization(ctx context.Context, organizationID uint) bool {
+	current := OrganizationFrom(ctx)
+	if current == 0 {
+		return isSystem(ctx)
+	}
+	return current == organizationID
+}
+
+// scoped limits the query to the rows of the table belonging to the organization in the context,
+// it matches no rows without an organization unless the context is a system one
+func scoped(ctx context.Context, db *gorm.DB, table string) *gorm.DB {
+	db = db.WithContext(ctx)
+	if organizationID := OrganizationFrom(ctx); organizationID != 0 {
+		db = db.Where(table+".organization_id = ?", organizationID)
+	} else if !isSystem(ctx) {
+		db = db.Where("FALSE")
+	}
+	return db
+}
+
+// scopedByUser limits the query to the rows whose user, in the column, belongs to the organization in the context
+// like scoped does. Tasks, their revisions and the personal access tokens belong to the organization of their user.
+func scopedByUser(ctx context.Context, db *gorm.DB, column string) *gorm.DB {
+	db = db.WithContext(ctx)
+	if organizationID := OrganizationFrom(ctx); organizationID != 0 {
+		db = db.Where(column+" IN (SELECT id FROM users WHERE organization_id = ?)", organizationID)
+	} else if !isSystem(ctx) {
+		db = db.Where("FALSE")
+	}
+	return db
+}
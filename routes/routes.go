@@ -1,25 +1,105 @@
 package routes
 
 import (
+	"github.com/ananikitina/time-tracker/auth"
 	"github.com/ananikitina/time-tracker/handlers"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/oidc"
+	"github.com/ananikitina/time-tracker/peopleinfo"
+	"github.com/ananikitina/time-tracker/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(r *gin.Engine) {
+// SetupRouter registers the API routes, all of them except logging in require authentication and a permission by the role.
+// people may be nil if the people info service is not used, sso may be nil if users don't log in with an identity provider.
+func SetupRouter(r *gin.Engine, repos repository.Repositories, people peopleinfo.Service, authenticator *auth.Authenticator, sso *oidc.Provider) {
+	userHandler := handlers.NewUserHandler(repos.Users, repos.Audit, repos.Tx, people)
+	taskHandler := handlers.NewTaskHandler(repos.Users, repos.Tasks, repos.Projects, repos.Audit, repos.Tx)
+	auditHandler := handlers.NewAuditHandler(repos.Audit)
+	projectHandler := handlers.NewProjectHandler(repos.Projects)
+	reportHandler := handlers.NewReportHandler(repos.Users, repos.Tasks)
+	apiKeyHandler := handlers.NewAPIKeyHandler(repos.APIKeys)
+	tokenHandler := handlers.NewTokenHandler(repos.Users, repos.Tokens, repos.Audit, repos.Tx)
+	organizationHandler := handlers.NewOrganizationHandler(repos.Organizations)
 
-	userRoutes := r.Group("/users")
+	// Policies: admins may do everything, managers read the data of their team,
+	// everyone tracks their own time. Personal access tokens may only use the routes of their scopes.
+	// Only the users themselves may create tokens acting for them, not even admins.
+	admin := auth.Require(auth.Roles(models.RoleAdmin))
+	onlySelf := auth.Require(auth.SelfOr("id"))
+	anyone := auth.RequireScope(models.ScopeTasksRead, auth.Roles(models.RoleAdmin, models.RoleManager, models.RoleEmployee))
+	managers := auth.RequireScope(models.ScopeReportsRead, auth.Roles(models.RoleAdmin, models.RoleManager))
+	self := func(param, scope string) gin.HandlerFunc {
+		return auth.RequireScope(scope, auth.SelfOr(param, models.RoleAdmin))
+	}
+	team := func(param, scope string) gin.HandlerFunc {
+		return auth.RequireScope(scope, auth.TeamOr(repos.Users, param, models.RoleAdmin))
+	}
+
+	if sso != nil {
+		loginHandler := handlers.NewLoginHandler(repos.Users, repos.Audit, repos.Tx, sso, authenticator)
+		r.GET("/auth/login", loginHandler.Login)
+		r.GET("/auth/callback", loginHandler.Callback)
+	}
+
+	// Every authenticated request only sees the data of the caller's organization
+	api := r.Group("", authenticator.Middleware())
+
+	api.GET("/organization", anyone, organizationHandler.GetOrganization)
+
+	userRoutes := api.Group("/users")
+	{
+		userRoutes.GET("", admin, userHandler.GetUsers)
+		userRoutes.GET("/:id", team("id", models.ScopeTasksRead), userHandler.GetUser)
+		userRoutes.DELETE("/:id", admin, userHandler.DeleteUser)
+		userRoutes.POST("/:id/restore", admin, userHandler.RestoreUser)
+		userRoutes.DELETE("/:id/purge", admin, userHandler.PurgeUser)
+		userRoutes.PUT("/:id", admin, userHandler.UpdateUser)
+		userRoutes.PATCH("/:id", admin, userHandler.PatchUser)
+		userRoutes.POST("", admin, userHandler.AddUser)
+		userRoutes.GET("/:id/tasks", team("id", models.ScopeTasksRead), taskHandler.GetUserTasks)
+		userRoutes.GET("/:id/tokens", self("id", ""), tokenHandler.GetTokens)
+		userRoutes.POST("/:id/tokens", onlySelf, tokenHandler.CreateToken)
+		userRoutes.DELETE("/:id/tokens/:tokenID", self("id", ""), tokenHandler.RevokeToken)
+	}
+	taskRoutes := api.Group("/tasks")
+	{
+		taskRoutes.GET("/:userID/sort", team("userID", models.ScopeTasksRead), taskHandler.SortTasks)
+		taskRoutes.GET("/:userID/report", team("userID", models.ScopeReportsRead), reportHandler.GetWorkload)
+		taskRoutes.POST("/:userID/start", self("userID", models.ScopeTasksWrite), taskHandler.StartTask)
+		taskRoutes.PUT("/:userID/finish", self("userID", models.ScopeTasksWrite), taskHandler.FinishTask)
+		taskRoutes.PUT("/:userID/pause", self("userID", models.ScopeTasksWrite), taskHandler.PauseTask)
+		taskRoutes.PUT("/:userID/resume", self("userID", models.ScopeTasksWrite), taskHandler.ResumeTask)
+		taskRoutes.POST("/:userID/switch", self("userID", models.ScopeTasksWrite), taskHandler.SwitchTask)
+		taskRoutes.POST("/:userID/entries", self("userID", models.ScopeTasksWrite), taskHandler.CreateEntry)
+		taskRoutes.GET("/:userID/entries/:taskID", team("userID", models.ScopeTasksRead), taskHandler.GetEntry)
+		taskRoutes.PATCH("/:userID/entries/:taskID", self("userID", models.ScopeTasksWrite), taskHandler.UpdateEntry)
+		taskRoutes.DELETE("/:userID/entries/:taskID", self("userID", models.ScopeTasksWrite), taskHandler.DeleteEntry)
+		taskRoutes.GET("/:userID/entries/:taskID/revisions", team("userID", models.ScopeTasksRead), taskHandler.GetEntryRevisions)
+	}
+	reportRoutes := api.Group("/reports")
+	{
+		// Managers get the report of their team only
+		reportRoutes.GET("/time", managers, reportHandler.GetTeamReport)
+	}
+	auditRoutes := api.Group("/audit", admin)
+	{
+		auditRoutes.GET("", auditHandler.GetAuditLog)
+		auditRoutes.GET("/verify", auditHandler.VerifyAuditLog)
+	}
+	projectRoutes := api.Group("/projects")
 	{
-		userRoutes.GET("", handlers.GetUsers)
-		userRoutes.DELETE("/:id", handlers.DeleteUser)
-		userRoutes.PUT("/:id", handlers.UpdateUser)
-		userRoutes.POST("", handlers.AddUser)
-		userRoutes.GET("/:id/tasks", handlers.GetUserTasks)
+		projectRoutes.GET("", anyone, projectHandler.GetProjects)
+		projectRoutes.GET("/:id", anyone, projectHandler.GetProject)
+		projectRoutes.POST("", admin, projectHandler.AddProject)
+		projectRoutes.PUT("/:id", admin, projectHandler.UpdateProject)
+		projectRoutes.DELETE("/:id", admin, projectHandler.DeleteProject)
 	}
-	taskRoutes := r.Group("/tasks")
+	apiKeyRoutes := api.Group("/api-keys", admin)
 	{
-		taskRoutes.GET("/:userID/sort", handlers.SortTasks)
-		taskRoutes.POST("/:userID/start", handlers.StartTask)
-		taskRoutes.PUT("/:userID/finish", handlers.FinishTask)
+		apiKeyRoutes.GET("", apiKeyHandler.GetAPIKeys)
+		apiKeyRoutes.POST("", apiKeyHandler.CreateAPIKey)
+		apiKeyRoutes.DELETE("/:id", apiKeyHandler.RevokeAPIKey)
 	}
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/handlers"
+	"github.com/ananikitina/time-tracker/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuthentication проверяет доступ к API по ключам и токенам
+func TestAuthentication(t *testing.T) {
+	router, _ := setupRouter()
+	expired, err := auth.SignJWT(testSigningKey, auth.Claims{Subject: "test", ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+	require.NoError(t, err)
+	forged, err := auth.SignJWT([]byte("another-signing-key-of-32-bytes!!"), auth.Claims{Subject: "test", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	// Токен без подписи
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"test","exp":%d}`, time.Now().Add(time.Hour).Unix()))) + "."
+
+	// Без учетных данных и с недействительными учетными данными доступа нет
+	for _, headers := range []map[string]string{
+		{"Authorization": ""},
+		{"Authorization": "Basic dGVzdDp0ZXN0"},
+		{"Authorization": "Bearer " + expired},
+		{"Authorization": "Bearer " + forged},
+		{"Authorization": "Bearer " + unsigned},
+		{"Authorization": "", auth.APIKeyHeader: "tt_unknown"},
+	} {
+		w := doRequestWithHeaders(router, "GET", "/users", nil, headers)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, headers)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+	}
+	w := doRequestWithHeaders(router, "GET", "/users", nil, map[string]string{"Authorization": "Bearer " + expired})
+	assert.JSONEq(t, `{"error": "Unauthorized", "details": "token expired"}`, w.Body.String())
+
+	// Ключ API показывается только при создании
+	w = doRequest(router, "POST", "/api-keys", map[string]string{"name": "отчеты"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created handlers.CreatedAPIKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, auth.APIKeyPrefix(created.Key), created.Prefix)
+	assert.NotContains(t, w.Body.String(), auth.HashAPIKey(created.Key))
+
+	w = doRequest(router, "GET", "/api-keys", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	var keys []models.APIKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	require.Len(t, keys, 2)
+	assert.Equal(t, "отчеты", keys[1].Name)
+	assert.Empty(t, keys[1].Hash)
+
+	// С ключом запросы выполняются от его имени
+	withKey := map[string]string{"Authorization": "", auth.APIKeyHeader: created.Key}
+	w = doRequestWithHeaders(router, "POST", "/users", map[string]string{
+		"passportNumber": "4510 890231", "surname": "Вавилов", "name": "Анатолий", "address": "г.Москва, ул. Кирова д.19",
+	}, withKey)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, "GET", "/audit?action=create", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var entries []models.AuditEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "api-key:отчеты", entries[0].Actor)
+
+	// Отозванный ключ не действует
+	w = doRequest(router, "DELETE", fmt.Sprintf("/api-keys/%d", created.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, "DELETE", fmt.Sprintf("/api-keys/%d", created.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequestWithHeaders(router, "GET", "/users", nil, withKey)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// TestJWTClaims проверяет проверку издателя, аудитории и сроков токена
+func TestJWTClaims(t *testing.T) {
+	config := auth.JWTConfig{SigningKey: testSigningKey, Issuer: "https://id.example.com", Audience: "time-tracker", Leeway: time.Minute}
+	now := time.Now()
+	valid := auth.Claims{Subject: "admin", Issuer: config.Issuer, ExpiresAt: now.Add(time.Hour).Unix()}
+	require.NoError(t, json.Unmarshal([]byte(`["other", "time-tracker"]`), &valid.Audience))
+
+	token, err := auth.SignJWT(testSigningKey, valid)
+	require.NoError(t, err)
+	claims, err := config.Verify(token, now)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", claims.Subject)
+
+	// Истекший в пределах допуска токен еще действует
+	_, err = config.Verify(token, now.Add(time.Hour+30*time.Second))
+	assert.NoError(t, err)
+	_, err = config.Verify(token, now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, auth.ErrTokenExpired)
+
+	for name, change := range map[string]func(*auth.Claims){
+		"issuer":     func(c *auth.Claims) { c.Issuer = "https://evil.example.com" },
+		"audience":   func(c *auth.Claims) { c.Audience = nil },
+		"subject":    func(c *auth.Claims) { c.Subject = "" },
+		"expiry":     func(c *auth.Claims) { c.ExpiresAt = 0 },
+		"not before": func(c *auth.Claims) { c.NotBefore = now.Add(time.Hour).Unix() },
+	} {
+		claims := valid
+		change(&claims)
+		token, err := auth.SignJWT(testSigningKey, claims)
+		require.NoError(t, err)
+		_, err = config.Verify(token, now)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken, name)
+	}
+}
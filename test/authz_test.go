@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/handlers"
+	"github.com/ananikitina/time-tracker/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoles проверяет права администратора, руководителя и сотрудника
+func TestRoles(t *testing.T) {
+	router, repos := setupRouter()
+	manager := models.User{Passport: models.Passport{Series: "1111", Number: "111111"}, Surname: "Орлова", Name: "Ольга", Role: models.RoleManager}
+	require.NoError(t, repos.Users.Create(testContext(), &manager))
+	employee := models.User{Passport: models.Passport{Series: "2222", Number: "222222"}, Surname: "Зайцев", Name: "Иван", Role: models.RoleEmployee, ManagerID: &manager.ID}
+	require.NoError(t, repos.Users.Create(testContext(), &employee))
+	outsider := models.User{Passport: models.Passport{Series: "3333", Number: "333333"}, Surname: "Волков", Name: "Петр", Role: models.RoleEmployee}
+	require.NoError(t, repos.Users.Create(testContext(), &outsider))
+
+	as := func(user models.User) map[string]string {
+		return map[string]string{"Authorization": testToken(user.ID)}
+	}
+	forbidden := func(w interface{ Result() *http.Response }, details string) {
+		t.Helper()
+		response := w.Result()
+		require.Equal(t, http.StatusForbidden, response.StatusCode)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+		assert.Equal(t, map[string]string{"error": "Forbidden", "details": details}, body)
+	}
+
+	// Сотрудник ведет и видит только свои задачи
+	w := doRequestWithHeaders(router, "POST", fmt.Sprintf("/tasks/%d/start", employee.ID), map[string]string{"name": "Код"}, as(employee))
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = doRequestWithHeaders(router, "PUT", fmt.Sprintf("/tasks/%d/finish", employee.ID), nil, as(employee))
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/users/%d/tasks", employee.ID), nil, as(employee))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequestWithHeaders(router, "POST", fmt.Sprintf("/tasks/%d/start", outsider.ID), map[string]string{"name": "Код"}, as(employee))
+	forbidden(w, "you may only access your own data, other users' data requires the admin role")
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/users/%d/tasks", outsider.ID), nil, as(employee))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Пользователями управляет только администратор
+	w = doRequestWithHeaders(router, "POST", "/users", map[string]string{"passportNumber": "4444 444444", "surname": "Новиков", "name": "Олег"}, as(manager))
+	forbidden(w, "requires the admin role")
+	for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+		w = doRequestWithHeaders(router, method, fmt.Sprintf("/users/%d", employee.ID), map[string]string{"name": "Иван"}, as(manager))
+		assert.Equal(t, http.StatusForbidden, w.Code, method)
+	}
+	w = doRequestWithHeaders(router, "GET", "/reports/time", nil, as(employee))
+	forbidden(w, "requires one of the roles admin, manager")
+
+	// Руководитель видит задачи и отчеты своей команды, но не ведет за нее время
+	query := url.Values{}
+	query.Set("start_time", time.Now().Add(-time.Hour).Format(time.RFC3339))
+	query.Set("end_time", time.Now().Add(time.Hour).Format(time.RFC3339))
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/tasks/%d/report?%s", employee.ID, query.Encode()), nil, as(manager))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/tasks/%d/report?%s", outsider.ID, query.Encode()), nil, as(manager))
+	forbidden(w, "managers may only access the data of their team")
+	w = doRequestWithHeaders(router, "POST", fmt.Sprintf("/tasks/%d/start", employee.ID), map[string]string{"name": "Код"}, as(manager))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doRequestWithHeaders(router, "GET", "/reports/time?"+query.Encode(), nil, as(manager))
+	require.Equal(t, http.StatusOK, w.Code)
+	var rows []models.TimeReportRow
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rows))
+	for _, row := range rows {
+		if row.UserID != nil {
+			assert.Contains(t, []uint{manager.ID, employee.ID}, *row.UserID)
+		}
+	}
+	query.Add("user_id", fmt.Sprint(outsider.ID))
+	w = doRequestWithHeaders(router, "GET", "/reports/time?"+query.Encode(), nil, as(manager))
+	forbidden(w, fmt.Sprintf("user %d is not in your team", outsider.ID))
+
+	// Роль берется из пользователя при каждом запросе
+	w = doRequest(router, "PATCH", fmt.Sprintf("/users/%d", outsider.ID), map[string]interface{}{"role": "manager", "manager_id": manager.ID})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequestWithHeaders(router, "GET", "/reports/time?"+query.Encode(), nil, as(manager))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/users/%d", employee.ID), nil, as(outsider))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Руководителем может быть только руководитель или администратор
+	w = doRequest(router, "PATCH", fmt.Sprintf("/users/%d", manager.ID), map[string]interface{}{"manager_id": employee.ID, "role": "boss"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var validation handlers.ValidationErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &validation))
+	assert.Equal(t, []handlers.FieldError{{Field: "role", Code: "invalid", Message: "role must be one of admin, manager, employee"}}, validation.Fields)
+	w = doRequest(router, "PATCH", fmt.Sprintf("/users/%d", manager.ID), map[string]interface{}{"manager_id": employee.ID})
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &validation))
+	assert.Equal(t, "not_manager", validation.Fields[0].Code)
+
+	// Токен удаленного пользователя не действует
+	w = doRequest(router, "DELETE", fmt.Sprintf("/users/%d", employee.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/users/%d/tasks", employee.ID), nil, as(employee))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
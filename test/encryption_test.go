@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/ananikitina/time-tracker/encryption"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKeyring проверяет шифрование, смену ключа и слепой индекс
+func TestKeyring(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	indexKey := bytes.Repeat([]byte{3}, 32)
+	ad := []byte("users.passport")
+
+	old, err := encryption.NewKeyring(map[string][]byte{"old": oldKey}, "old", indexKey)
+	require.NoError(t, err)
+
+	keyID, ciphertext, err := old.Encrypt([]byte("1234 567890"), ad)
+	require.NoError(t, err)
+	assert.Equal(t, "old", keyID)
+	assert.NotContains(t, string(ciphertext), "567890")
+
+	// Одно и то же значение шифруется по-разному
+	_, again, err := old.Encrypt([]byte("1234 567890"), ad)
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, again)
+
+	// После смены ключа старые значения читаются
+	rotated, err := encryption.NewKeyring(map[string][]byte{"old": oldKey, "new": newKey}, "new", indexKey)
+	require.NoError(t, err)
+	plaintext, err := rotated.Decrypt(keyID, ciphertext, ad)
+	require.NoError(t, err)
+	assert.Equal(t, "1234 567890", string(plaintext))
+
+	newID, _, err := rotated.Encrypt([]byte("1234 567890"), ad)
+	require.NoError(t, err)
+	assert.Equal(t, "new", newID)
+
+	// Измененное значение или другие данные не расшифровываются
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = rotated.Decrypt(keyID, ciphertext, ad)
+	assert.ErrorIs(t, err, encryption.ErrDecrypt)
+	_, err = rotated.Decrypt("missing", ciphertext, ad)
+	assert.ErrorIs(t, err, encryption.ErrUnknownKey)
+
+	// Слепой индекс зависит только от значения и ключа индекса
+	assert.Equal(t, old.BlindIndex([]byte("1234 567890")), rotated.BlindIndex([]byte("1234 567890")))
+	assert.NotEqual(t, old.BlindIndex([]byte("1234 567890")), old.BlindIndex([]byte("1234 567891")))
+
+	// Неверные ключи
+	_, err = encryption.NewKeyring(map[string][]byte{"short": oldKey[:16]}, "short", indexKey)
+	assert.Error(t, err)
+	_, err = encryption.NewKeyring(map[string][]byte{"old": oldKey}, "new", indexKey)
+	assert.ErrorIs(t, err, encryption.ErrUnknownKey)
+}
+
+// TestKeyringFromEnv проверяет чтение ключей из переменных окружения
+func TestKeyringFromEnv(t *testing.T) {
+	t.Setenv("TEST_KEYS", "a:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=, b:AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=")
+	t.Setenv("TEST_KEY_ID", "")
+	t.Setenv("TEST_INDEX_KEY", "AwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwM=")
+
+	keyring, err := encryption.KeyringFromEnv("TEST")
+	require.NoError(t, err)
+	assert.Equal(t, "b", keyring.CurrentKeyID())
+
+	t.Setenv("TEST_KEY_ID", "a")
+	keyring, err = encryption.KeyringFromEnv("TEST")
+	require.NoError(t, err)
+	assert.Equal(t, "a", keyring.CurrentKeyID())
+
+	// Без ключа индекса или ключей шифрования сервис не запускается
+	t.Setenv("TEST_INDEX_KEY", "")
+	_, err = encryption.KeyringFromEnv("TEST")
+	assert.ErrorContains(t, err, "TEST_INDEX_KEY is not set")
+
+	t.Setenv("TEST_KEYS", "")
+	_, err = encryption.KeyringFromEnv("TEST")
+	assert.Error(t, err)
+}
+
+// TestPassportsBoundToUsers проверяет, что зашифрованный паспорт нельзя перенести другому пользователю
+func TestPassportsBoundToUsers(t *testing.T) {
+	url := os.Getenv(testDatabaseEnv)
+	if url == "" {
+		t.Skip(testDatabaseEnv + " is not set")
+	}
+	db := postgresDatabase(t, url)
+	keys := testPassportKeys(t)
+	repos := repository.NewPostgres(db, keys)
+	ctx := testContext()
+
+	first := models.User{Passport: models.Passport{Series: "4510", Number: "890231"}, Surname: "Вавилов", Name: "Анатолий"}
+	require.NoError(t, repos.Users.Create(ctx, &first))
+	second := models.User{Passport: models.Passport{Series: "4511", Number: "123456"}, Surname: "Григорьев", Name: "Денис"}
+	require.NoError(t, repos.Users.Create(ctx, &second))
+	stored, err := repos.Users.GetByID(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, first.Passport, stored.Passport)
+
+	// Шифротекст, перенесенный другому пользователю, не расшифровывается
+	require.NoError(t, db.Exec("UPDATE users SET passport_ciphertext = (SELECT passport_ciphertext FROM users WHERE id = ?) WHERE id = ?",
+		first.ID, second.ID).Error)
+	_, err = repos.Users.GetByID(ctx, second.ID)
+	assert.ErrorIs(t, err, encryption.ErrDecrypt)
+
+	// Паспорт, хранящийся открыто, шифруется при старте с привязкой к своему пользователю
+	require.NoError(t, db.Exec("UPDATE users SET passport_ciphertext = NULL, passport_key_id = NULL, passport_series = ?, passport_number = ? WHERE id = ?",
+		second.Passport.Series, second.Passport.Number, second.ID).Error)
+	encrypted, err := repository.EncryptPassports(ctx, db, keys, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, encrypted)
+	stored, err = repos.Users.GetByID(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, second.Passport, stored.Passport)
+}
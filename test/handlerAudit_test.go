@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/handlers"
+	"github.com/ananikitina/time-tracker/logging"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+	"github.com/ananikitina/time-tracker/routes"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuditLog проверяет запись изменений пользователей и задач в журнал аудита
+func TestAuditLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemory()
+	router := gin.New()
+	router.Use(logging.Middleware())
+	routes.SetupRouter(router, repos, nil, testAuthenticator(repos), nil)
+	adminUser := models.User{Passport: models.Passport{Series: "4512", Number: "890233"}, Surname: "Петров", Name: "Петр", Role: models.RoleAdmin}
+	require.NoError(t, repos.Users.Create(testContext(), &adminUser))
+	admin := map[string]string{"Authorization": testToken(adminUser.ID), logging.RequestIDHeader: "audit-request"}
+
+	// Создание, изменение и удаление пользователя
+	w := doRequestWithHeaders(router, "POST", "/users", map[string]string{
+		"passportNumber": "4510 890231", "surname": "Вавилов", "name": "Анатолий", "address": "г.Москва, ул. Кирова д.19",
+	}, admin)
+	require.Equal(t, http.StatusOK, w.Code)
+	var user models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	target := fmt.Sprintf("/users/%d", user.ID)
+
+	w = doRequest(router, "PATCH", target, map[string]string{"address": "г.Тверь"})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequestWithHeaders(router, "DELETE", target, nil, map[string]string{"Authorization": testToken(adminUser.ID)})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(router, "GET", fmt.Sprintf("/audit?entity_type=user&entity_id=%d", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var entries []models.AuditEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 3)
+
+	// Записи идут от новых к старым
+	assert.Equal(t, models.AuditDelete, entries[0].Action)
+	assert.Equal(t, fmt.Sprintf("user:%d", adminUser.ID), entries[0].Actor)
+	assert.Equal(t, models.AuditUpdate, entries[1].Action)
+	assert.Equal(t, "api-key:test", entries[1].Actor)
+	assert.Equal(t, map[string]models.AuditChange{
+		"address": {Before: "г.Москва, ул. Кирова д.19", After: "г.Тверь"},
+	}, entries[1].Changes)
+	assert.Equal(t, models.AuditCreate, entries[2].Action)
+	assert.Equal(t, "audit-request", entries[2].RequestID)
+
+	// Паспорт в журнал не попадает, только факт изменения
+	assert.Equal(t, models.AuditChange{After: logging.Mask}, entries[2].Changes["passport_number"])
+	assert.NotContains(t, w.Body.String(), "890231")
+
+	// Задачи
+	other := getTestUser()
+	other.Passport = models.Passport{Series: "4511", Number: "890232"}
+	require.NoError(t, repos.Users.Create(testContext(), &other))
+	w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", other.ID), map[string]string{"name": "Отчет"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/finish", other.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(router, "GET", "/audit?entity_type=task&action=finish", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	require.Contains(t, entries[0].Changes, "EndTime")
+	assert.Nil(t, entries[0].Changes["EndTime"].Before)
+	assert.NotNil(t, entries[0].Changes["EndTime"].After)
+
+	// Фильтры и пагинация
+	w = doRequest(router, "GET", "/audit?request_id=audit-request", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	w = doRequest(router, "GET", fmt.Sprintf("/audit?actor=user:%d&pageSize=1&page=2", adminUser.ID), nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, models.AuditCreate, entries[0].Action)
+	w = doRequest(router, "GET", "/audit?from=yesterday", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(router, "GET", "/audit?entity_id=x", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestAuditChain проверяет цепочку хешей журнала аудита и истории записей времени
+func TestAuditChain(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	entries := fmt.Sprintf("/tasks/%d/entries", user.ID)
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+
+	// Законченная запись попадает в историю при создании, изменении и удалении
+	w := doRequest(router, "POST", entries, map[string]interface{}{
+		"name": "Код", "start_time": day.Add(9 * time.Hour), "end_time": day.Add(11 * time.Hour),
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Task models.Task `json:"task"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	entry := fmt.Sprintf("%s/%d", entries, created.Task.ID)
+	w = doRequest(router, "PATCH", entry, map[string]interface{}{"end_time": day.Add(12 * time.Hour)})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, "DELETE", entry, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(router, "GET", entry+"/revisions", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var revisions []models.TaskRevision
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revisions))
+	require.Len(t, revisions, 3)
+	assert.Equal(t, revisions[0].Hash, revisions[1].PrevHash)
+	assert.Equal(t, "Код", revisions[1].Task["TaskName"])
+	assert.True(t, revisions[2].Deleted)
+
+	// Запущенная задача в историю не попадает до завершения
+	w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]string{"name": "Отчет"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/finish", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(router, "GET", "/audit/verify", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var verification handlers.ChainVerificationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &verification))
+	assert.True(t, verification.Valid)
+	require.Len(t, verification.Chains, 2)
+	log, err := repos.Audit.List(testContext(), repository.AuditFilter{})
+	require.NoError(t, err)
+	slices.Reverse(log)
+	// Проверка возвращает голову цепочки — хеш последней записи
+	assert.Equal(t, models.ChainVerification{Chain: models.ChainAudit, OrganizationID: models.DefaultOrganizationID, Checked: 5, Valid: true,
+		Head: log[len(log)-1].Hash}, verification.Chains[0])
+	assert.Equal(t, models.ChainTaskRevisions, verification.Chains[1].Chain)
+	assert.Equal(t, 4, verification.Chains[1].Checked)
+	assert.True(t, verification.Chains[1].Valid)
+	assert.NotEmpty(t, verification.Chains[1].Head)
+
+	// Измененная или удаленная запись журнала разрывает цепочку
+	result, err := repository.VerifyAuditLog(log)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, log[len(log)-1].Hash, result.Head)
+
+	changed := slices.Clone(log)
+	changed[2].Actor = "someone else"
+	result, err = repository.VerifyAuditLog(changed)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, log[2].ID, result.BrokenID)
+	assert.Equal(t, 2, result.Checked)
+
+	// Организация входит в хеш записи
+	moved := slices.Clone(log)
+	moved[3].OrganizationID = 2
+	result, err = repository.VerifyAuditLog(moved)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, log[3].ID, result.BrokenID)
+
+	// Записи прежней версии проверяются без организации
+	legacy := slices.Clone(log[:1])
+	legacy[0].HashVersion = 1
+	legacy[0].OrganizationID = 2
+	legacy[0].Hash = chainHashForTest(t, legacy[0])
+	result, err = repository.VerifyAuditLog(legacy)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+
+	removed := slices.Delete(slices.Clone(log), 1, 2)
+	result, err = repository.VerifyAuditLog(removed)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, log[2].ID, result.BrokenID)
+
+	// Пропускаются только записи, сделанные до появления цепочки (hash_version 0) и стоящие перед ней
+	unchained := models.AuditEntry{ID: 0, Actor: "api-key:test", Action: models.AuditCreate, EntityType: models.AuditEntityUser}
+	result, err = repository.VerifyAuditLog(append([]models.AuditEntry{unchained}, log...))
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, len(log), result.Checked)
+
+	for _, version := range []int{0, 1} {
+		inserted := unchained
+		inserted.ID = log[len(log)-1].ID + 1
+		inserted.HashVersion = version
+		result, err = repository.VerifyAuditLog(append(slices.Clone(log), inserted))
+		require.NoError(t, err)
+		assert.False(t, result.Valid)
+		assert.Equal(t, inserted.ID, result.BrokenID)
+		assert.Equal(t, "record inside the chain has no hash", result.Reason)
+	}
+
+	// Запись без хеша прежней версии в начале цепочки тоже ее разрывает
+	withoutHash := unchained
+	withoutHash.HashVersion = 1
+	result, err = repository.VerifyAuditLog(append([]models.AuditEntry{withoutHash}, log...))
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+}
+
+// failingAudit — журнал аудита, в который не удается записать
+type failingAudit struct {
+	repository.AuditRepository
+}
+
+func (failingAudit) Record(ctx context.Context, entry *models.AuditEntry) error {
+	return errors.New("audit is unavailable")
+}
+
+// TestAuditFailureRollsBack проверяет, что изменение отменяется, если его не удалось записать в журнал
+func TestAuditFailureRollsBack(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemory()
+	repos.Audit = failingAudit{repos.Audit}
+	router := gin.New()
+	routes.SetupRouter(router, repos, nil, testAuthenticator(repos), nil)
+	user := createTestUser(t, repos)
+
+	w := doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]string{"name": "Отчет"})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	_, err := repos.Tasks.GetActive(testContext(), user.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	w = doRequest(router, "PATCH", fmt.Sprintf("/users/%d", user.ID), map[string]string{"address": "г.Тверь"})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	stored, err := repos.Users.GetByID(testContext(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.Address, stored.Address)
+
+	w = doRequest(router, "DELETE", fmt.Sprintf("/users/%d", user.ID), nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	_, err = repos.Users.GetByID(testContext(), user.ID)
+	assert.NoError(t, err)
+}
+
+// noActiveRead — репозиторий задач, который не дает прочитать запущенную задачу отдельно
+type noActiveRead struct {
+	repository.TaskRepository
+}
+
+func (noActiveRead) GetActive(ctx context.Context, userID uint) (models.Task, error) {
+	return models.Task{}, errors.New("the running task must not be read separately")
+}
+
+// TestTaskAuditBefore проверяет, что состояние задачи до изменения в журнале
+// восстанавливается по результату изменения, без отдельного чтения задачи
+func TestTaskAuditBefore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemory()
+	repos.Tasks = noActiveRead{repos.Tasks}
+	router := gin.New()
+	routes.SetupRouter(router, repos, nil, testAuthenticator(repos), nil)
+	user := createTestUser(t, repos)
+
+	for _, request := range []struct{ method, action string }{
+		{"POST", "start"}, {"PUT", "pause"}, {"PUT", "resume"}, {"PUT", "pause"}, {"PUT", "finish"},
+	} {
+		var body interface{}
+		if request.action == "start" {
+			body = map[string]string{"name": "Отчет"}
+		}
+		w := doRequest(router, request.method, fmt.Sprintf("/tasks/%d/%s", user.ID, request.action), body)
+		require.Less(t, w.Code, 300, request.action)
+	}
+
+	entries, err := repos.Audit.List(testContext(), repository.AuditFilter{EntityType: models.AuditEntityTask})
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	slices.SortFunc(entries, func(a, b models.AuditEntry) int { return int(a.ID) - int(b.ID) })
+	breaks := func(value interface{}) []interface{} {
+		list, _ := value.([]interface{})
+		return list
+	}
+
+	changed := func(entry models.AuditEntry) []string {
+		var fields []string
+		for name := range entry.Changes {
+			fields = append(fields, name)
+		}
+		slices.Sort(fields)
+		return fields
+	}
+	for _, entry := range entries[1:4] {
+		assert.Equal(t, []string{"Breaks"}, changed(entry), entry.Action)
+	}
+	assert.Equal(t, []string{"Breaks", "EndTime"}, changed(entries[4]))
+
+	// Перерыв начался: до него перерывов не было
+	pause := entries[1].Changes["Breaks"]
+	assert.Empty(t, breaks(pause.Before))
+	assert.Len(t, breaks(pause.After), 1)
+
+	// Перерыв закончился: до этого он был открыт
+	resume := entries[2].Changes["Breaks"]
+	require.Len(t, breaks(resume.Before), 1)
+	assert.Nil(t, breaks(resume.Before)[0].(map[string]interface{})["EndTime"])
+	assert.NotNil(t, breaks(resume.After)[0].(map[string]interface{})["EndTime"])
+
+	// Задача завершилась на перерыве: до этого перерыв был открыт, а задача запущена
+	finish := entries[4]
+	assert.Equal(t, models.AuditFinish, finish.Action)
+	assert.Nil(t, finish.Changes["EndTime"].Before)
+	require.Len(t, breaks(finish.Changes["Breaks"].Before), 2)
+	assert.NotNil(t, breaks(finish.Changes["Breaks"].Before)[0].(map[string]interface{})["EndTime"])
+	assert.Nil(t, breaks(finish.Changes["Breaks"].Before)[1].(map[string]interface{})["EndTime"])
+	assert.NotNil(t, breaks(finish.Changes["Breaks"].After)[1].(map[string]interface{})["EndTime"])
+}
+
+// chainHashForTest считает хеш записи аудита в формате версии 1, без организации
+func chainHashForTest(t *testing.T, entry models.AuditEntry) string {
+	data, err := json.Marshal(struct {
+		CreatedAt  string                        `json:"created_at"`
+		Actor      string                        `json:"actor"`
+		Action     string                        `json:"action"`
+		EntityType string                        `json:"entity_type"`
+		EntityID   uint                          `json:"entity_id"`
+		Changes    map[string]models.AuditChange `json:"changes"`
+		RequestID  string                        `json:"request_id"`
+	}{entry.CreatedAt.UTC().Format(time.RFC3339Nano), entry.Actor, entry.Action, entry.EntityType, entry.EntityID, entry.Changes, entry.RequestID})
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(entry.PrevHash + "\n" + string(data)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTimeEntries проверяет ручное создание, изменение и удаление записей времени
+func TestTimeEntries(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	entries := fmt.Sprintf("/tasks/%d/entries", user.ID)
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	at := func(hours float64) string {
+		return day.Add(time.Duration(hours * float64(time.Hour))).Format(time.RFC3339)
+	}
+
+	// Создание записи
+	w := doRequest(router, "POST", entries, map[string]interface{}{
+		"name": "Код", "start_time": at(9), "end_time": at(11),
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created struct {
+		Task models.Task `json:"task"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	// Конец раньше начала
+	w = doRequest(router, "POST", entries, map[string]interface{}{
+		"name": "Код", "start_time": at(13), "end_time": at(12),
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Запись в будущем
+	w = doRequest(router, "POST", entries, map[string]interface{}{
+		"name": "Код", "start_time": at(48), "end_time": at(49),
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Пересечение с существующей записью
+	w = doRequest(router, "POST", entries, map[string]interface{}{
+		"name": "Созвон", "start_time": at(10.5), "end_time": at(12),
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Запись встык не пересекается
+	w = doRequest(router, "POST", entries, map[string]interface{}{
+		"name": "Созвон", "start_time": at(11), "end_time": at(12),
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// Изменение записи
+	entry := fmt.Sprintf("%s/%d", entries, created.Task.ID)
+	w = doRequest(router, "PATCH", entry, map[string]interface{}{"name": "Ревью", "start_time": at(8)})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	task, err := repos.Tasks.Get(testContext(), user.ID, created.Task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Ревью", task.TaskName)
+	assert.True(t, task.StartTime.Equal(day.Add(8*time.Hour)))
+	assert.True(t, task.EndTime.Equal(day.Add(11*time.Hour)))
+
+	// Изменение, приводящее к пересечению
+	w = doRequest(router, "PATCH", entry, map[string]interface{}{"end_time": at(11.5)})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Активную запись нельзя перенести в будущее
+	w = doRequest(router, "POST", entries, map[string]interface{}{"name": "Почта", "start_time": at(20)})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var running struct {
+		Task models.Task `json:"task"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &running))
+
+	w = doRequest(router, "PATCH", fmt.Sprintf("%s/%d", entries, running.Task.ID), map[string]interface{}{"start_time": at(72)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Записи после начала активной пересекаются с ней
+	w = doRequest(router, "POST", entries, map[string]interface{}{
+		"name": "Код", "start_time": at(21), "end_time": at(22),
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Удаление записи
+	w = doRequest(router, "DELETE", entry, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	_, err = repos.Tasks.Get(testContext(), user.ID, created.Task.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	w = doRequest(router, "DELETE", entry, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
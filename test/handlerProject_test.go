@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProjects проверяет работу с проектами и отчет по проектам
+func TestProjects(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+
+	// Создание проекта
+	w := doRequest(router, "POST", "/projects", map[string]interface{}{
+		"name": "Сайт", "client": "ООО Ромашка", "color": "#FF8800",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var site models.Project
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &site))
+	assert.Equal(t, "#ff8800", site.Color)
+
+	// Имена проектов уникальны без учета регистра
+	w = doRequest(router, "POST", "/projects", map[string]interface{}{"name": "сайт"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Неверный цвет
+	w = doRequest(router, "POST", "/projects", map[string]interface{}{"name": "Реклама", "color": "red"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(router, "POST", "/projects", map[string]interface{}{"name": "Реклама"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var ads models.Project
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ads))
+
+	// Фильтр по клиенту
+	w = doRequest(router, "GET", "/projects?client="+url.QueryEscape("ООО Ромашка"), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var projects []models.Project
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &projects))
+	require.Len(t, projects, 1)
+	assert.Equal(t, site.ID, projects[0].ID)
+
+	// Учет времени по проектам
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	addTask := func(name string, projectID *uint, start, end time.Duration) {
+		endTime := day.Add(end)
+		task := models.Task{UserID: user.ID, TaskName: name, ProjectID: projectID, StartTime: day.Add(start), EndTime: &endTime}
+		require.NoError(t, repos.Tasks.Create(testContext(), &task))
+	}
+	addTask("Верстка", &site.ID, 9*time.Hour, 11*time.Hour)
+	addTask("Код", &site.ID, 11*time.Hour, 12*time.Hour)
+	addTask("Баннеры", &ads.ID, 12*time.Hour, 12*time.Hour+30*time.Minute)
+	addTask("Почта", nil, 13*time.Hour, 13*time.Hour+15*time.Minute)
+
+	query := url.Values{}
+	query.Set("start_time", day.Format(time.RFC3339))
+	query.Set("end_time", day.Add(24*time.Hour).Format(time.RFC3339))
+	report := func(params url.Values) []models.TaskWorkload {
+		w := doRequest(router, "GET", fmt.Sprintf("/tasks/%d/report?%s", user.ID, params.Encode()), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var workload []models.TaskWorkload
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &workload))
+		return workload
+	}
+
+	// Группировка по проектам
+	query.Set("group_by", "project")
+	assert.Equal(t, []models.TaskWorkload{
+		{ProjectID: &site.ID, Project: "Сайт", Hours: 3, TotalSeconds: 10800},
+		{ProjectID: &ads.ID, Project: "Реклама", Minutes: 30, TotalSeconds: 1800},
+		{Minutes: 15, TotalSeconds: 900},
+	}, report(query))
+
+	// Фильтр по проекту
+	query.Del("group_by")
+	query.Set("project_id", fmt.Sprint(site.ID))
+	assert.Equal(t, []models.TaskWorkload{
+		{Task: "Верстка", Hours: 2, TotalSeconds: 7200},
+		{Task: "Код", Hours: 1, TotalSeconds: 3600},
+	}, report(query))
+
+	query.Set("group_by", "day")
+	w = doRequest(router, "GET", fmt.Sprintf("/tasks/%d/report?%s", user.ID, query.Encode()), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// В архивном проекте нельзя запустить задачу
+	w = doRequest(router, "PUT", fmt.Sprintf("/projects/%d", ads.ID), map[string]interface{}{"name": "Реклама", "archived": true})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]interface{}{"name": "Баннеры", "project_id": ads.ID})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Удаление проекта оставляет задачи без проекта
+	w = doRequest(router, "DELETE", fmt.Sprintf("/projects/%d", site.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, "GET", fmt.Sprintf("/projects/%d", site.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	tasks, err := repos.Tasks.ListByUser(testContext(), user.ID)
+	require.NoError(t, err)
+	for _, task := range tasks {
+		if task.TaskName == "Верстка" {
+			assert.Nil(t, task.ProjectID)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTeamReport проверяет отчет по нескольким пользователям с промежуточными итогами
+func TestTeamReport(t *testing.T) {
+	router, repos := setupRouter()
+	first := createTestUser(t, repos)
+	second := models.User{Passport: models.Passport{Series: "1122", Number: "334455"}, Surname: "Иванова", Name: "Мария"}
+	require.NoError(t, repos.Users.Create(testContext(), &second))
+
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	addTask := func(userID uint, name string, start, end time.Duration, breaks ...models.TaskBreak) {
+		endTime := day.Add(end)
+		task := models.Task{UserID: userID, TaskName: name, StartTime: day.Add(start), EndTime: &endTime, Breaks: breaks}
+		require.NoError(t, repos.Tasks.Create(testContext(), &task))
+	}
+	breakEnd := day.Add(34 * time.Hour)
+
+	// Задача после полуночи делится между днями
+	addTask(first.ID, "Код", 22*time.Hour, 25*time.Hour)
+	addTask(first.ID, "Созвон", 10*time.Hour, 10*time.Hour+30*time.Minute)
+	addTask(second.ID, "Код", 33*time.Hour, 35*time.Hour,
+		models.TaskBreak{StartTime: day.Add(33*time.Hour + 30*time.Minute), EndTime: &breakEnd})
+
+	query := url.Values{}
+	query.Set("start_time", day.Format(time.RFC3339))
+	query.Set("end_time", day.Add(48*time.Hour).Format(time.RFC3339))
+	report := func(query url.Values) []models.TimeReportRow {
+		w := doRequest(router, "GET", "/reports/time?"+query.Encode(), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var rows []models.TimeReportRow
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rows))
+		return rows
+	}
+
+	// Группировка по пользователям и дням
+	query.Set("group_by", "user,day")
+	byUser := []string{"user"}
+	byUserDay := []string{"user", "day"}
+	assert.Equal(t, []models.TimeReportRow{
+		{GroupedBy: byUserDay, UserID: &first.ID, User: "Вавилов Анатолий", Day: "2024-07-01", Hours: 2, Minutes: 30, TotalSeconds: 9000},
+		{GroupedBy: byUserDay, UserID: &first.ID, User: "Вавилов Анатолий", Day: "2024-07-02", Hours: 1, TotalSeconds: 3600},
+		{GroupedBy: byUser, UserID: &first.ID, User: "Вавилов Анатолий", Hours: 3, Minutes: 30, TotalSeconds: 12600},
+		{GroupedBy: byUserDay, UserID: &second.ID, User: "Иванова Мария", Day: "2024-07-02", Hours: 1, Minutes: 30, TotalSeconds: 5400},
+		{GroupedBy: byUser, UserID: &second.ID, User: "Иванова Мария", Hours: 1, Minutes: 30, TotalSeconds: 5400},
+		{GroupedBy: []string{}, Hours: 5, TotalSeconds: 18000},
+	}, report(query))
+
+	// Дни считаются в часовом поясе отчета
+	query.Set("group_by", "day")
+	query.Set("timezone", "Europe/Moscow")
+	assert.Equal(t, []models.TimeReportRow{
+		{GroupedBy: []string{"day"}, Day: "2024-07-01", Minutes: 30, TotalSeconds: 1800},
+		{GroupedBy: []string{"day"}, Day: "2024-07-02", Hours: 4, Minutes: 30, TotalSeconds: 16200},
+		{GroupedBy: []string{}, Hours: 5, TotalSeconds: 18000},
+	}, report(query))
+
+	// Отбор по пользователю
+	query.Set("group_by", "week,task")
+	query.Set("user_id", fmt.Sprint(second.ID))
+	assert.Equal(t, []models.TimeReportRow{
+		{GroupedBy: []string{"week", "task"}, Week: "2024-07-01", Task: "Код", Hours: 1, Minutes: 30, TotalSeconds: 5400},
+		{GroupedBy: []string{"week"}, Week: "2024-07-01", Hours: 1, Minutes: 30, TotalSeconds: 5400},
+		{GroupedBy: []string{}, Hours: 1, Minutes: 30, TotalSeconds: 5400},
+	}, report(query))
+
+	// Неизвестное и повторное измерение
+	for _, groupBy := range []string{"user,month", "user,user"} {
+		query.Set("group_by", groupBy)
+		w := doRequest(router, "GET", "/reports/time?"+query.Encode(), nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// doRequest выполняет HTTP-запрос к роутеру, body сериализуется в JSON
+func doRequest(router *gin.Engine, method, target string, body interface{}) *httptest.ResponseRecorder {
+	return doRequestWithHeaders(router, method, target, body, nil)
+}
+
+// doRequestWithHeaders выполняет HTTP-запрос к роутеру с дополнительными заголовками
+func doRequestWithHeaders(router *gin.Engine, method, target string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		jsonValue, _ := json.Marshal(body)
+		reader = bytes.NewReader(jsonValue)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, _ := http.NewRequest(method, target, reader)
+	req.Header.Set("Content-Type", "application/json")
+	// Запросы без своих учетных данных выполняются с ключом администратора
+	_, withToken := headers["Authorization"]
+	if _, withKey := headers[auth.APIKeyHeader]; !withKey && !withToken {
+		req.Header.Set(auth.APIKeyHeader, testAPIKey)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// createTestUser сохраняет тестового пользователя в репозиторий
+func createTestUser(t *testing.T, repos repository.Repositories) models.User {
+	user := getTestUser()
+	require.NoError(t, repos.Users.Create(testContext(), &user))
+	return user
+}
+
+// TestStartFinishTask проверяет запуск и остановку задачи
+func TestStartFinishTask(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	project := models.Project{Name: "Бухгалтерия"}
+	require.NoError(t, repos.Projects.Create(testContext(), &project))
+
+	// Запуск задачи без названия
+	w := doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]interface{}{"name": "  "})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Неверные описание, проект и метки
+	archived := models.Project{Name: "Архив", Archived: true}
+	require.NoError(t, repos.Projects.Create(testContext(), &archived))
+	for _, body := range []map[string]interface{}{
+		{"name": "Отчет", "description": strings.Repeat("о", 2001)},
+		{"name": "Отчет", "project_id": 999},
+		{"name": "Отчет", "project_id": archived.ID},
+		{"name": "Отчет", "tags": []string{""}},
+		{"name": "Отчет", "tags": []string{strings.Repeat("м", 51)}},
+		{"name": "Отчет", "tags": make([]string, 21)},
+	} {
+		w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	_, err := repos.Tasks.GetActive(testContext(), user.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	// Запуск задачи
+	w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]interface{}{
+		"name":        "Отчет",
+		"description": "Квартальный отчет",
+		"project_id":  project.ID,
+		"tags":        []string{"отчеты", " отчеты ", "срочно"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var started struct {
+		Task models.Task `json:"task"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	assert.Equal(t, "Отчет", started.Task.TaskName)
+	require.NotNil(t, started.Task.ProjectID)
+	assert.Equal(t, project.ID, *started.Task.ProjectID)
+	assert.Equal(t, []string{"отчеты", "срочно"}, started.Task.Tags)
+	assert.Nil(t, started.Task.EndTime)
+
+	// Описание, проект и метки сохранены
+	active, err := repos.Tasks.GetActive(testContext(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Квартальный отчет", active.Description)
+	require.NotNil(t, active.ProjectID)
+	assert.Equal(t, project.ID, *active.ProjectID)
+	assert.Equal(t, []string{"отчеты", "срочно"}, active.Tags)
+
+	// Остановка задачи
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/finish", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	tasks, err := repos.Tasks.ListByUser(testContext(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.NotNil(t, tasks[0].EndTime)
+	assert.Equal(t, "Квартальный отчет", tasks[0].Description)
+
+	// Активных задач больше нет
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/finish", user.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Несуществующий пользователь
+	w = doRequest(router, "POST", "/tasks/999/start", map[string]interface{}{"name": "Отчет"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestSingleActiveTask проверяет, что у пользователя не больше одной активной задачи
+func TestSingleActiveTask(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	target := fmt.Sprintf("/tasks/%d/start", user.ID)
+
+	// Параллельные запуски без остановки активной задачи
+	const requests = 20
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- doRequest(router, "POST", target, map[string]interface{}{"name": "Код"}).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created, conflicts := 0, 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		}
+	}
+	assert.Equal(t, 1, created)
+	assert.Equal(t, requests-1, conflicts)
+
+	// Запуск с остановкой активной задачи
+	w := doRequest(router, "POST", target, map[string]interface{}{"name": "Созвон", "stop_active": true})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var started struct {
+		Task        models.Task  `json:"task"`
+		StoppedTask *models.Task `json:"stopped_task"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	require.NotNil(t, started.StoppedTask)
+	assert.Equal(t, "Код", started.StoppedTask.TaskName)
+	assert.True(t, started.StoppedTask.EndTime.Equal(started.Task.StartTime))
+
+	active, err := repos.Tasks.GetActive(testContext(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, started.Task.ID, active.ID)
+}
+
+// TestSwitchTask проверяет переключение между задачами
+func TestSwitchTask(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	target := fmt.Sprintf("/tasks/%d/switch", user.ID)
+
+	// Переключаться не с чего
+	w := doRequest(router, "POST", target, map[string]interface{}{"name": "Код"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]interface{}{"name": "Код"})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = doRequest(router, "POST", target, map[string]interface{}{"name": "Ревью", "tags": []string{"ревью"}})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var switched struct {
+		Task        models.Task `json:"task"`
+		StoppedTask models.Task `json:"stopped_task"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &switched))
+	assert.Equal(t, "Ревью", switched.Task.TaskName)
+	assert.Equal(t, "Код", switched.StoppedTask.TaskName)
+	require.NotNil(t, switched.StoppedTask.EndTime)
+	assert.True(t, switched.StoppedTask.EndTime.Equal(switched.Task.StartTime))
+
+	tasks, err := repos.Tasks.ListByUser(testContext(), user.ID)
+	require.NoError(t, err)
+	assert.Len(t, tasks, 2)
+}
+
+// TestPauseResumeTask проверяет перерывы в задаче
+func TestPauseResumeTask(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+
+	// Нет активной задачи
+	w := doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/pause", user.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]interface{}{"name": "Код"})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// Задача еще не на паузе
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/resume", user.ID), nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/pause", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/pause", user.ID), nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/resume", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Остановка задачи на паузе завершает и перерыв
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/pause", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/finish", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var finished struct {
+		Task models.Task `json:"task"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &finished))
+	require.Len(t, finished.Task.Breaks, 2)
+	assert.False(t, finished.Task.Paused())
+	assert.True(t, finished.Task.Breaks[1].EndTime.Equal(*finished.Task.EndTime))
+}
+
+// TestTaskDuration проверяет расчет длительности задачи без перерывов
+func TestTaskDuration(t *testing.T) {
+	start := time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC)
+	breakEnd := start.Add(30 * time.Minute)
+	task := models.Task{
+		StartTime: start,
+		Breaks: []models.TaskBreak{
+			{StartTime: start.Add(10 * time.Minute), EndTime: &breakEnd},
+			{StartTime: start.Add(50 * time.Minute)},
+		},
+	}
+
+	// Задача идет, второй перерыв еще не закончен
+	now := start.Add(time.Hour)
+	assert.Equal(t, 30*time.Minute, task.Duration(now))
+	assert.True(t, task.Paused())
+
+	// Период отсекает начало задачи
+	assert.Equal(t, 20*time.Minute, task.WorkedWithin(start.Add(20*time.Minute), now, now))
+
+	task.Finish(start.Add(2 * time.Hour))
+	assert.False(t, task.Paused())
+	assert.Equal(t, 30*time.Minute, task.Duration(now))
+}
+
+// TestWorkloadReport проверяет отчет о трудозатратах за период
+func TestWorkloadReport(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	addTask := func(name string, start, end time.Duration, breaks ...models.TaskBreak) {
+		task := models.Task{UserID: user.ID, TaskName: name, StartTime: day.Add(start), Breaks: breaks}
+		if end != 0 {
+			endTime := day.Add(end)
+			task.EndTime = &endTime
+		}
+		require.NoError(t, repos.Tasks.Create(testContext(), &task))
+	}
+	breakEnd := day.Add(11*time.Hour + 45*time.Minute)
+
+	addTask("Код", 9*time.Hour, 10*time.Hour+30*time.Minute)
+	// Перерыв не учитывается
+	addTask("Код", 11*time.Hour, 12*time.Hour+30*time.Minute,
+		models.TaskBreak{StartTime: day.Add(11*time.Hour + 15*time.Minute), EndTime: &breakEnd})
+	addTask("Созвон", 12*time.Hour, 12*time.Hour+15*time.Minute)
+	// Задача обрезается началом периода
+	addTask("Почта", 7*time.Hour, 8*time.Hour+10*time.Minute)
+	// Задача вне периода
+	addTask("Код", -5*time.Hour, -4*time.Hour)
+
+	query := url.Values{}
+	query.Set("start_time", day.Add(8*time.Hour).Format(time.RFC3339))
+	query.Set("end_time", day.Add(24*time.Hour).Format(time.RFC3339))
+
+	w := doRequest(router, "GET", fmt.Sprintf("/tasks/%d/report?%s", user.ID, query.Encode()), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var workload []models.TaskWorkload
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &workload))
+	assert.Equal(t, []models.TaskWorkload{
+		{Task: "Код", Hours: 2, Minutes: 30, TotalSeconds: 9000},
+		{Task: "Созвон", Hours: 0, Minutes: 15, TotalSeconds: 900},
+		{Task: "Почта", Hours: 0, Minutes: 10, TotalSeconds: 600},
+	}, workload)
+
+	// Неверный период
+	w = doRequest(router, "GET", fmt.Sprintf("/tasks/%d/report?start_time=yesterday", user.ID), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -2,19 +2,22 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/ananikitina/time-tracker/database"
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/handlers"
 	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
 	"github.com/ananikitina/time-tracker/routes"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -23,36 +26,75 @@ import (
 // getTestUser возвращает тестового пользователя
 func getTestUser() models.User {
 	return models.User{
-		PassportNumber: "890231",
-		Surname:        "Вавилов",
-		Name:           "Анатолий",
-		Patronymic:     "Анатольевич",
-		Address:        "г.Москва, ул. Кирова д.19",
+		Passport:   models.Passport{Series: "4510", Number: "890231"},
+		Surname:    "Вавилов",
+		Name:       "Анатолий",
+		Patronymic: "Анатольевич",
+		Address:    "г.Москва, ул. Кирова д.19",
 	}
 }
-func setupRouter() *gin.Engine {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 
-	// Подключение к базе данных
-	database.Connect()
-	database.Migrate()
+// setupRouter создает роутер поверх репозиториев в памяти
+func setupRouter() (*gin.Engine, repository.Repositories) {
+	gin.SetMode(gin.TestMode)
+
+	// Репозитории в памяти вместо базы данных
+	repos := repository.NewMemory()
 
 	// Инициализация Gin
-	r := gin.Default()
+	r := gin.New()
 
 	// Регистрация маршрутов
-	routes.SetupRouter(r)
+	routes.SetupRouter(r, repos, nil, testAuthenticator(repos), nil)
+
+	return r, repos
+}
+
+// testSigningKey подписывает токены в тестах
+var testSigningKey = []byte("test-signing-key-of-at-least-32-bytes")
+
+// testAPIKey — ключ API администратора, который testAuthenticator добавляет в репозиторий
+const testAPIKey = "tt_test-admin-key"
+
+// testAuthenticator принимает testAPIKey и токены, подписанные testSigningKey
+func testAuthenticator(repos repository.Repositories) *auth.Authenticator {
+	key := models.APIKey{Name: "test", Prefix: auth.APIKeyPrefix(testAPIKey), Hash: auth.HashAPIKey(testAPIKey)}
+	if err := repos.APIKeys.Create(testContext(), &key); err != nil {
+		panic(err)
+	}
+	return auth.NewAuthenticator(repos.APIKeys, repos.Tokens, repos.Users, auth.JWTConfig{SigningKey: testSigningKey})
+}
 
-	return r
+// testContext возвращает системный контекст, в котором тесты видят данные всех организаций
+func testContext() context.Context {
+	return repository.WithSystem(context.Background())
+}
+
+// testToken возвращает заголовок Authorization с токеном пользователя, действующим час
+func testToken(userID uint) string {
+	token, err := auth.SignJWT(testSigningKey, auth.Claims{Subject: fmt.Sprint(userID), ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		panic(err)
+	}
+	return "Bearer " + token
+}
+
+// findUserByPassport ищет пользователя в репозитории по номеру паспорта
+func findUserByPassport(repos repository.Repositories, passport models.Passport) (models.User, error) {
+	users, err := repos.Users.List(testContext(), repository.UserFilter{Passport: &passport})
+	if err != nil {
+		return models.User{}, err
+	}
+	if len(users) == 0 {
+		return models.User{}, repository.ErrNotFound
+	}
+	return users[0], nil
 }
 
 // TestAddGetDelete проверяет добавление и удаление пользователя
 func TestAddGetDelete(t *testing.T) {
 	// prepare
-	router := setupRouter()
+	router, repos := setupRouter()
 
 	// Создание тестового пользователя
 	user := getTestUser()
@@ -60,6 +102,7 @@ func TestAddGetDelete(t *testing.T) {
 	// Создание тестового HTTP-запроса
 	jsonValue, _ := json.Marshal(user)
 	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonValue))
+	req.Header.Set(auth.APIKeyHeader, testAPIKey)
 	req.Header.Set("Content-Type", "application/json")
 
 	// Запись HTTP-ответа
@@ -74,17 +117,16 @@ func TestAddGetDelete(t *testing.T) {
 	require.NoError(t, err, "failed to unmarshal JSON response")
 
 	// Проверка совпадения созданного пользователя с ожидаемыми данными
-	assert.Equal(t, user.PassportNumber, createdUser.PassportNumber)
+	assert.Equal(t, user.Passport, createdUser.Passport)
 	assert.Equal(t, user.Surname, createdUser.Surname)
 	assert.Equal(t, user.Name, createdUser.Name)
 	assert.Equal(t, user.Patronymic, createdUser.Patronymic)
 	assert.Equal(t, user.Address, createdUser.Address)
 
 	// Проверка, что пользователь был добавлен в базу данных
-	var dbUser models.User
-	err = database.DB.Where("passport_number = ?", user.PassportNumber).First(&dbUser).Error
+	dbUser, err := findUserByPassport(repos, user.Passport)
 	require.NoError(t, err, "failed to fetch user from database")
-	assert.Equal(t, user.PassportNumber, dbUser.PassportNumber)
+	assert.Equal(t, user.Passport, dbUser.Passport)
 	assert.Equal(t, user.Surname, dbUser.Surname)
 	assert.Equal(t, user.Name, dbUser.Name)
 	assert.Equal(t, user.Patronymic, dbUser.Patronymic)
@@ -93,6 +135,7 @@ func TestAddGetDelete(t *testing.T) {
 	// Создание тестового HTTP-запроса для удаления пользователя
 	urlDelete := fmt.Sprintf("/users/%d", dbUser.ID) // преобразуем dbUser.ID в строку
 	reqDelete, _ := http.NewRequest("DELETE", urlDelete, nil)
+	reqDelete.Header.Set(auth.APIKeyHeader, testAPIKey)
 
 	// Выполнение HTTP-запроса на удаление пользователя
 	wDelete := httptest.NewRecorder()
@@ -102,7 +145,313 @@ func TestAddGetDelete(t *testing.T) {
 	assert.Equal(t, http.StatusOK, wDelete.Code)
 
 	// Проверка, что пользователь был удален из базы данных
-	var deletedUser models.User
-	err = database.DB.Where("id = ?", dbUser.ID).First(&deletedUser).Error
-	assert.Error(t, err, "expected error while fetching deleted user from database")
+	_, err = repos.Users.GetByID(testContext(), dbUser.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "expected error while fetching deleted user from database")
+}
+
+// TestParsePassport проверяет разбор паспорта в разных форматах
+func TestParsePassport(t *testing.T) {
+	for _, value := range []string{"1234 567890", "1234567890", "1234-567890", "12 34 567890", " 1234  567890 "} {
+		passport, err := models.ParsePassport(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, models.Passport{Series: "1234", Number: "567890"}, passport, value)
+		assert.Equal(t, "1234 567890", passport.String())
+	}
+
+	for value, code := range map[string]string{
+		"":             models.PassportRequired,
+		"12345 67890a": models.PassportInvalidCharacter,
+		"1234 56789":   models.PassportInvalidLength,
+		"1234 5678901": models.PassportInvalidLength,
+	} {
+		_, err := models.ParsePassport(value)
+		var passportErr *models.PassportError
+		require.ErrorAs(t, err, &passportErr, value)
+		assert.Equal(t, code, passportErr.Code, value)
+	}
+}
+
+// TestPassportNormalization проверяет уникальность и поиск по нормализованному паспорту
+func TestPassportNormalization(t *testing.T) {
+	router, _ := setupRouter()
+
+	user := map[string]string{"passportNumber": "1234-567890", "surname": "Вавилов", "name": "Анатолий"}
+	w := doRequest(router, "POST", "/users", user)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"passport_number":"1234 567890"`)
+
+	// Тот же паспорт в другой записи
+	user["passportNumber"] = "1234567890"
+	w = doRequest(router, "POST", "/users", user)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Поиск по паспорту в любой записи
+	w = doRequest(router, "GET", "/users?passportNumber=12+34+567890", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var users []models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	require.Len(t, users, 1)
+	assert.Equal(t, models.Passport{Series: "1234", Number: "567890"}, users[0].Passport)
+
+	// Ошибки формата описывают поле
+	user["passportNumber"] = "1234 5678"
+	w = doRequest(router, "POST", "/users", user)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var response struct {
+		Fields []struct {
+			Field string `json:"field"`
+			Code  string `json:"code"`
+		} `json:"fields"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Fields, 1)
+	assert.Equal(t, "passportNumber", response.Fields[0].Field)
+	assert.Equal(t, models.PassportInvalidLength, response.Fields[0].Code)
+
+	w = doRequest(router, "GET", "/users?passportNumber=abc", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(router, "PUT", "/users/1", map[string]string{"passport_number": "1"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestSoftDeleteRestorePurge проверяет мягкое удаление, восстановление и окончательное удаление пользователя
+func TestSoftDeleteRestorePurge(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	w := doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]string{"name": "Отчет"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/finish", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Удаленный пользователь скрыт из списка, но доступен по запросу
+	w = doRequest(router, "DELETE", fmt.Sprintf("/users/%d", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, "GET", "/users", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, "GET", "/users?deleted=only", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var users []models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	require.Len(t, users, 1)
+	assert.True(t, users[0].DeletedAt.Valid)
+	w = doRequest(router, "GET", "/users?deleted=all", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Удаленному пользователю нельзя начать задачу, повторное удаление не находит его
+	w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]string{"name": "Отчет"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, "DELETE", fmt.Sprintf("/users/%d", user.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Восстановление
+	w = doRequest(router, "POST", fmt.Sprintf("/users/%d/restore", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var restored models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &restored))
+	assert.False(t, restored.DeletedAt.Valid)
+	assert.Equal(t, user.Surname, restored.Surname)
+	w = doRequest(router, "POST", fmt.Sprintf("/users/%d/restore", user.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Пользователь с задачами не удаляется окончательно без архивации или удаления задач
+	w = doRequest(router, "DELETE", fmt.Sprintf("/users/%d/purge", user.ID), nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doRequest(router, "DELETE", fmt.Sprintf("/users/%d/purge?tasks=drop", user.ID), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(router, "DELETE", fmt.Sprintf("/users/%d/purge?tasks=archive", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	tasks, err := repos.Tasks.ListByUser(testContext(), user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+	w = doRequest(router, "GET", "/users?deleted=include", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, "DELETE", fmt.Sprintf("/users/%d/purge", user.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestPatchReplaceUser проверяет частичное обновление (JSON Merge Patch) и полную замену пользователя
+func TestPatchReplaceUser(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	target := fmt.Sprintf("/users/%d", user.ID)
+
+	// fieldCodes возвращает коды ошибок ответа по полям
+	fieldCodes := func(w *httptest.ResponseRecorder) map[string]string {
+		var response handlers.ValidationErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		codes := make(map[string]string)
+		for _, field := range response.Fields {
+			codes[field.Field] = field.Code
+		}
+		return codes
+	}
+
+	// Изменяются только переданные поля, null очищает поле, ответ содержит пользователя
+	req, _ := http.NewRequest("PATCH", target, strings.NewReader(`{"address": "г. Казань", "patronymic": null}`))
+	req.Header.Set(auth.APIKeyHeader, testAPIKey)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var patched models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &patched))
+	assert.Equal(t, "г. Казань", patched.Address)
+	assert.Empty(t, patched.Patronymic)
+	assert.Equal(t, user.Surname, patched.Surname)
+	assert.Equal(t, user.Passport, patched.Passport)
+	stored, err := repos.Users.GetByID(testContext(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, patched.Address, stored.Address)
+
+	// Неизвестные и служебные поля, неверные типы и обязательные поля
+	w = doRequest(router, "PATCH", target, map[string]interface{}{
+		"ID":              99,
+		"surname":         nil,
+		"name":            5,
+		"passport_number": "1234",
+		"address":         strings.Repeat("д", 1001),
+	})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, map[string]string{
+		"ID":              "unknown_field",
+		"surname":         "required",
+		"name":            "invalid_type",
+		"passport_number": models.PassportInvalidLength,
+		"address":         "too_long",
+	}, fieldCodes(w))
+
+	w = doRequest(router, "PATCH", target, []string{"surname"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req, _ = http.NewRequest("PATCH", target, strings.NewReader(`{"name": "Олег"}`))
+	req.Header.Set(auth.APIKeyHeader, testAPIKey)
+	req.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	// Полная замена очищает непереданные необязательные поля
+	w = doRequest(router, "PUT", target, map[string]string{"passport_number": "1111 222333", "surname": "Петров", "name": "Петр"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var replaced models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &replaced))
+	assert.Equal(t, user.ID, replaced.ID)
+	assert.Equal(t, models.Passport{Series: "1111", Number: "222333"}, replaced.Passport)
+	assert.Equal(t, "Петров", replaced.Surname)
+	assert.Empty(t, replaced.Address)
+
+	w = doRequest(router, "PUT", target, map[string]string{"surname": "Петров"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, map[string]string{"passport_number": "required", "name": "required"}, fieldCodes(w))
+}
+
+// TestReplaceUserKeepsRole проверяет, что полная замена без роли и руководителя их не меняет
+func TestReplaceUserKeepsRole(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	manager := models.User{Passport: models.Passport{Series: "5555", Number: "555555"}, Surname: "Орлова", Name: "Анна", Role: models.RoleManager}
+	require.NoError(t, repos.Users.Create(testContext(), &manager))
+	target := fmt.Sprintf("/users/%d", user.ID)
+
+	w := doRequest(router, "PATCH", target, map[string]interface{}{"role": models.RoleManager, "manager_id": manager.ID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Замена в прежнем формате, без role и manager_id
+	w = doRequest(router, "PUT", target, map[string]string{"passport_number": "1111 222333", "surname": "Петров", "name": "Петр"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var replaced models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &replaced))
+	assert.Equal(t, "Петров", replaced.Surname)
+	assert.Equal(t, models.RoleManager, replaced.Role)
+	require.NotNil(t, replaced.ManagerID)
+	assert.Equal(t, manager.ID, *replaced.ManagerID)
+
+	// Переданные null очищают их
+	w = doRequest(router, "PUT", target, map[string]interface{}{
+		"passport_number": "1111 222333", "surname": "Петров", "name": "Петр", "role": nil, "manager_id": nil,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &replaced))
+	assert.Equal(t, models.RoleEmployee, replaced.Role)
+	assert.Nil(t, replaced.ManagerID)
+}
+
+// TestETags проверяет версии пользователей и записей времени в ETag и условные запросы
+func TestETags(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	target := fmt.Sprintf("/users/%d", user.ID)
+
+	w := doRequest(router, "GET", target, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	// Неизменившийся пользователь не отправляется повторно
+	w = doRequestWithHeaders(router, "GET", target, nil, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	w = doRequestWithHeaders(router, "GET", target, nil, map[string]string{"If-None-Match": `W/"1"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// Изменение увеличивает версию
+	w = doRequestWithHeaders(router, "PATCH", target, map[string]string{"name": "Петр"}, map[string]string{"If-Match": etag})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	w = doRequestWithHeaders(router, "GET", target, nil, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Изменение устаревшей версии отклоняется
+	w = doRequestWithHeaders(router, "PUT", target, map[string]string{
+		"passport_number": "4510 890231", "surname": "Иванов", "name": "Иван",
+	}, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doRequestWithHeaders(router, "DELETE", target, nil, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Репозиторий не перезаписывает изменения, сделанные после чтения
+	stale, err := repos.Users.GetByID(testContext(), user.ID)
+	require.NoError(t, err)
+	w = doRequest(router, "PATCH", target, map[string]string{"surname": "Петров"})
+	require.Equal(t, http.StatusOK, w.Code)
+	stale.Name = "Сидор"
+	assert.ErrorIs(t, repos.Users.Update(testContext(), &stale), repository.ErrVersionConflict)
+	assert.ErrorIs(t, repos.Users.Delete(testContext(), user.ID, stale.Version), repository.ErrVersionConflict)
+
+	w = doRequestWithHeaders(router, "DELETE", target, nil, map[string]string{"If-Match": `"0", "3"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Записи времени версионируются так же, перерывы меняют версию задачи
+	other := getTestUser()
+	other.Passport = models.Passport{Series: "4511", Number: "890232"}
+	require.NoError(t, repos.Users.Create(testContext(), &other))
+	w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", other.ID), map[string]string{"name": "Отчет"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+	var started struct {
+		Task models.Task `json:"task"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	entry := fmt.Sprintf("/tasks/%d/entries/%d", other.ID, started.Task.ID)
+
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/pause", other.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	w = doRequest(router, "PUT", fmt.Sprintf("/tasks/%d/finish", other.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	w = doRequestWithHeaders(router, "GET", entry, nil, map[string]string{"If-None-Match": `"3"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	w = doRequestWithHeaders(router, "PATCH", entry, map[string]string{"name": "Код"}, map[string]string{"If-Match": `"2"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doRequestWithHeaders(router, "PATCH", entry, map[string]string{"name": "Код"}, map[string]string{"If-Match": `"3"`})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+	w = doRequestWithHeaders(router, "DELETE", entry, nil, map[string]string{"If-Match": `"3"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doRequestWithHeaders(router, "DELETE", entry, nil, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusOK, w.Code)
 }
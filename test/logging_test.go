@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/logging"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/peopleinfo"
+	"github.com/ananikitina/time-tracker/repository"
+	"github.com/ananikitina/time-tracker/routes"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestLogsHidePassports проверяет, что паспорта и адреса не попадают в логи
+func TestLogsHidePassports(t *testing.T) {
+	var logs bytes.Buffer
+	logging.Setup(&logs, slog.LevelDebug)
+	defer logging.Setup(os.Stderr, slog.LevelInfo)
+	gin.SetMode(gin.TestMode)
+
+	// Сервис данных о людях недоступен, ошибки запросов попадают в логи
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	people := peopleinfo.NewClient(peopleinfo.Config{
+		URL:        server.URL,
+		Timeout:    100 * time.Millisecond,
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+		NotFound:   peopleinfo.NotFoundReject,
+	})
+
+	repos := repository.NewMemory()
+	router := gin.New()
+	router.Use(logging.Middleware())
+	routes.SetupRouter(router, repos, people, testAuthenticator(repos), nil)
+
+	user := getTestUser()
+	w := doRequest(router, "POST", "/users", map[string]string{"passportNumber": "4510890231"})
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	w = doRequest(router, "POST", "/users", map[string]string{
+		"passportNumber": user.Passport.String(),
+		"surname":        user.Surname,
+		"name":           user.Name,
+		"address":        user.Address,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	saved, err := findUserByPassport(repos, user.Passport)
+	require.NoError(t, err)
+
+	doRequest(router, "GET", "/users?passportNumber=4510+890231&address=Kirova", nil)
+
+	w = doRequest(router, "PATCH", fmt.Sprintf("/users/%d", saved.ID), map[string]string{
+		"passport_number": "45 10 890231",
+		"address":         user.Address,
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// SQL-запросы пишутся без значений, с идентификатором запроса
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               logging.NewGormLogger(logger.Info),
+	})
+	require.NoError(t, err)
+	var users []models.User
+	ctx := logging.WithAttrs(context.Background(), slog.String("request_id", "query-request"))
+	db.WithContext(ctx).Where("passport_series = ? AND passport_number = ?", user.Passport.Series, user.Passport.Number).
+		Where("address = ?", user.Address).Find(&users)
+
+	output := logs.String()
+	assert.Contains(t, output, logging.Mask)
+	assert.Contains(t, output, `"request_id":"query-request"`)
+	assert.Contains(t, output, `SELECT * FROM \"users\"`)
+	for _, secret := range []string{"890231", user.Address, "Kirova"} {
+		assert.NotContains(t, output, secret)
+	}
+}
+
+// TestRedact проверяет маскирование чувствительных полей
+func TestRedact(t *testing.T) {
+	user := getTestUser()
+	redacted := logging.Redact(&user).(map[string]interface{})
+	assert.Equal(t, logging.Mask, redacted["passport_number"])
+	assert.Equal(t, logging.Mask, redacted["address"])
+	assert.Equal(t, user.Surname, redacted["surname"])
+
+	filter := logging.Redact(repository.UserFilter{Passport: &user.Passport, Name: user.Name}).(map[string]interface{})
+	assert.Equal(t, logging.Mask, filter["Passport"])
+	assert.Equal(t, user.Name, filter["Name"])
+
+	data := logging.Redact(map[string]interface{}{"passportNumber": "4510 890231", "tags": []string{"a"}}).(map[string]interface{})
+	assert.Equal(t, logging.Mask, data["passportNumber"])
+	assert.Equal(t, []interface{}{"a"}, data["tags"])
+
+	assert.Equal(t, "/users?page=2&address="+logging.Mask, logging.RedactURL("/users?page=2&address=Kirova"))
+}
+
+// TestWriterMasksPassports проверяет, что вывод логов маскирует поля с паспортом
+// и паспорта с разделителями, но не любые 10-значные числа
+func TestWriterMasksPassports(t *testing.T) {
+	var out bytes.Buffer
+	w := logging.NewWriter(&out)
+
+	for line, expected := range map[string]string{
+		`{"passport_number":"4510890231","latency":1234567890}`:    `{"passport_number":"` + logging.Mask + `","latency":1234567890}`,
+		`{"msg":"failed: {\"passportNumber\": \"45 10 890231\"}"}`: `{"msg":"failed: {\"passportNumber\": \"` + logging.Mask + `\"}"}`,
+		"GET /people?passportSerie=4510&passportNumber=890231":     "GET /people?passportSerie=" + logging.Mask + "&passportNumber=" + logging.Mask,
+		"passport: 4510890231": "passport: " + logging.Mask,
+		"found 4510 890231 and 45 10 890231, 4510-890231, 4510%20890231": "found " + logging.Mask + " and " + logging.Mask + ", " + logging.Mask + ", " + logging.Mask,
+		"order 4510890231 took 1234567890ns":                             "order 4510890231 took 1234567890ns",
+	} {
+		out.Reset()
+		n, err := w.Write([]byte(line))
+		require.NoError(t, err)
+		assert.Equal(t, len(line), n)
+		assert.Equal(t, expected, out.String())
+	}
+}
+
+// TestRequestLogging проверяет идентификатор запроса и атрибуты запроса в логах
+func TestRequestLogging(t *testing.T) {
+	var logs bytes.Buffer
+	logging.Setup(&logs, slog.LevelDebug)
+	defer logging.Setup(os.Stderr, slog.LevelInfo)
+	gin.SetMode(gin.TestMode)
+
+	repos := repository.NewMemory()
+	router := gin.New()
+	router.Use(logging.Middleware())
+	routes.SetupRouter(router, repos, nil, testAuthenticator(repos), nil)
+	user := createTestUser(t, repos)
+
+	// Идентификатор клиента передается дальше
+	req := httptest.NewRequest("POST", fmt.Sprintf("/tasks/%d/start", user.ID), strings.NewReader(`{"name": "Логи"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.APIKeyHeader, testAPIKey)
+	req.Header.Set(logging.RequestIDHeader, "test-request-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "test-request-1", w.Header().Get(logging.RequestIDHeader))
+
+	// Каждая запись запроса содержит его идентификатор, маршрут и пользователя
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		records = append(records, record)
+	}
+	require.GreaterOrEqual(t, len(records), 2)
+	for _, record := range records[1:] {
+		assert.Equal(t, "test-request-1", record["request_id"])
+		assert.Equal(t, "/tasks/:userID/start", record["route"])
+	}
+	last := records[len(records)-1]
+	assert.Equal(t, "Request handled", last["msg"])
+	assert.Equal(t, "INFO", last["level"])
+	assert.Equal(t, float64(user.ID), last["user_id"])
+	assert.Equal(t, "api-key:test", last["principal"])
+	assert.Equal(t, float64(http.StatusCreated), last["status"])
+	assert.Contains(t, last, "latency_ms")
+
+	// Без идентификатора или с недопустимым идентификатором он создается
+	for _, requestID := range []string{"", "bad id\n{}"} {
+		req = httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set(auth.APIKeyHeader, testAPIKey)
+		req.Header.Set(logging.RequestIDHeader, requestID)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Len(t, w.Header().Get(logging.RequestIDHeader), 32)
+	}
+}
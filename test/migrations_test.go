@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/ananikitina/time-tracker/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEmbeddedMigrations проверяет, что миграции сервиса корректно читаются
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := database.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.NotEmpty(t, migration.Up, "migration %d has no up script", migration.Version)
+		assert.NotEmpty(t, migration.Down, "migration %d has no down script", migration.Version)
+		if i > 0 {
+			assert.Greater(t, migration.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+// TestLoadMigrations проверяет разбор файлов миграций
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := database.LoadMigrations(fstest.MapFS{
+		"0002_add_index.up.sql":   {Data: []byte("CREATE INDEX i ON t (c);")},
+		"0002_add_index.down.sql": {Data: []byte("DROP INDEX i;")},
+		"0001_init.up.sql":        {Data: []byte("CREATE TABLE t (c INT);")},
+		"0001_init.down.sql":      {Data: []byte("DROP TABLE t;")},
+		"README.md":               {Data: []byte("not a migration")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, database.Migration{Version: 1, Name: "init", Up: "CREATE TABLE t (c INT);", Down: "DROP TABLE t;"}, migrations[0])
+	assert.Equal(t, int64(2), migrations[1].Version)
+
+	// Нет файла отката
+	_, err = database.LoadMigrations(fstest.MapFS{
+		"0001_init.up.sql": {Data: []byte("CREATE TABLE t (c INT);")},
+	})
+	assert.Error(t, err)
+
+	// Неверное имя файла
+	_, err = database.LoadMigrations(fstest.MapFS{
+		"init.up.sql": {Data: []byte("CREATE TABLE t (c INT);")},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/handlers"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/oidc"
+	"github.com/ananikitina/time-tracker/repository"
+	"github.com/ananikitina/time-tracker/routes"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOIDCLogin проверяет вход через провайдера OpenID Connect на моке провайдера
+func TestOIDCLogin(t *testing.T) {
+	identities := append(slices.Clone(oidc.MockIdentities),
+		oidc.MockIdentity{Subject: "sidorov", GivenName: "Петр", FamilyName: "Сидоров", Passport: "5555 111111"},
+		oidc.MockIdentity{Subject: "ivanov-twin", GivenName: "Иван", FamilyName: "Иванов", Passport: "1234 567890"},
+		oidc.MockIdentity{Subject: "kozlov", GivenName: "Олег", FamilyName: "Козлов", Passport: "6666 222222"},
+	)
+	mock, err := oidc.NewMock(oidc.MockClient{ID: "time-tracker", Secret: "secret"}, identities)
+	require.NoError(t, err)
+	idp := httptest.NewServer(mock)
+	defer idp.Close()
+
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemory()
+	config := oidc.Config{
+		IssuerURL:     idp.URL,
+		ClientID:      "time-tracker",
+		ClientSecret:  "secret",
+		RedirectURL:   "http://tracker.test/auth/callback",
+		PassportClaim: "passport_number",
+		SessionTTL:    time.Hour,
+		Timeout:       5 * time.Second,
+	}
+	authenticator := testAuthenticator(repos)
+	newRouter := func(config oidc.Config) *gin.Engine {
+		r := gin.New()
+		routes.SetupRouter(r, repos, nil, authenticator, oidc.NewProvider(config, testSigningKey))
+		return r
+	}
+	router := newRouter(config)
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	// login проходит вход пользователя провайдера и возвращает ответ обратного вызова
+	login := func(router *gin.Engine, hint string, tamper func(callback *url.URL)) *httptest.ResponseRecorder {
+		t.Helper()
+		w := doRequest(router, "GET", "/auth/login", nil)
+		require.Equal(t, http.StatusFound, w.Code)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.True(t, cookies[0].HttpOnly)
+
+		resp, err := noRedirects.Get(w.Header().Get("Location") + "&login_hint=" + hint)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		if tamper != nil {
+			tamper(callback)
+		}
+
+		req := httptest.NewRequest("GET", callback.RequestURI(), nil)
+		req.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Без OIDC_LINK_BY_PASSPORT пользователь по паспорту не привязывается
+	existing := models.User{Passport: models.Passport{Series: "1234", Number: "567890"}, Surname: "Иванов", Name: "Иван", Role: models.RoleEmployee}
+	require.NoError(t, repos.Users.Create(testContext(), &existing))
+	w := login(router, "ivanov", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// С ним существующий пользователь находится по паспорту и привязывается к subject
+	config.LinkByPassport = true
+	router = newRouter(config)
+	w = login(router, "ivanov", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var session handlers.LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.Equal(t, "Bearer", session.TokenType)
+	assert.Equal(t, existing.ID, session.User.ID)
+	require.NotNil(t, session.User.OIDCSubject)
+	assert.Equal(t, "ivanov", *session.User.OIDCSubject)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), session.ExpiresAt, time.Minute)
+
+	// Выданный токен действует в API с ролью пользователя
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/users/%d", existing.ID), nil, map[string]string{"Authorization": "Bearer " + session.Token})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequestWithHeaders(router, "GET", "/users", nil, map[string]string{"Authorization": "Bearer " + session.Token})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Повторный вход находит пользователя по subject, даже если паспорт изменился
+	existing, err = repos.Users.GetByID(testContext(), existing.ID)
+	require.NoError(t, err)
+	existing.Passport = models.Passport{Series: "1234", Number: "000000"}
+	require.NoError(t, repos.Users.Update(testContext(), &existing))
+	w = login(router, "ivanov", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.Equal(t, existing.ID, session.User.ID)
+
+	// Уже привязанный пользователь, администратор и руководитель по паспорту не привязываются
+	existing.Passport = models.Passport{Series: "1234", Number: "567890"}
+	require.NoError(t, repos.Users.Update(testContext(), &existing))
+	w = login(router, "ivanov-twin", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	admin := models.User{Passport: models.Passport{Series: "5555", Number: "111111"}, Surname: "Сидоров", Name: "Петр", Role: models.RoleAdmin}
+	require.NoError(t, repos.Users.Create(testContext(), &admin))
+	w = login(router, "sidorov", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	admin, err = repos.Users.GetByID(testContext(), admin.ID)
+	require.NoError(t, err)
+	assert.Nil(t, admin.OIDCSubject)
+	manager := models.User{Passport: models.Passport{Series: "6666", Number: "222222"}, Surname: "Козлов", Name: "Олег", Role: models.RoleManager}
+	require.NoError(t, repos.Users.Create(testContext(), &manager))
+	w = login(router, "kozlov", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	manager, err = repos.Users.GetByID(testContext(), manager.ID)
+	require.NoError(t, err)
+	assert.Nil(t, manager.OIDCSubject)
+
+	// Неизвестный пользователь без создания пользователей не входит,
+	// даже если в другой организации есть пользователь с тем же subject
+	organization := models.Organization{Name: "Другая"}
+	require.NoError(t, repos.Organizations.Create(testContext(), &organization))
+	subject := "petrova"
+	stranger := models.User{Passport: models.Passport{Series: "4321", Number: "098765"}, Surname: "Петрова", Name: "Анна", OIDCSubject: &subject}
+	require.NoError(t, repos.Users.Create(repository.WithOrganization(testContext(), organization.ID), &stranger))
+	w = login(router, "petrova", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// С OIDC_CREATE_USERS пользователь создается при первом входе
+	config.CreateUsers = true
+	creating := newRouter(config)
+	w = login(creating, "petrova", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.Equal(t, "Петрова", session.User.Surname)
+	assert.Equal(t, "Анна", session.User.Name)
+	assert.Equal(t, models.RoleEmployee, session.User.Role)
+	assert.Equal(t, models.Passport{Series: "4321", Number: "098765"}, session.User.Passport)
+
+	entries, err := repos.Audit.List(testContext(), repository.AuditFilter{EntityType: models.AuditEntityUser, Action: models.AuditCreate})
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	assert.Equal(t, fmt.Sprintf("user:%d", session.User.ID), entries[0].Actor)
+
+	// Подмененный state, отказ провайдера и повторно использованный код отклоняются
+	w = login(router, "ivanov", func(callback *url.URL) {
+		query := callback.Query()
+		query.Set("state", "forged")
+		callback.RawQuery = query.Encode()
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = login(router, "nobody", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "access_denied")
+
+	var code url.Values
+	w = login(router, "ivanov", func(callback *url.URL) { code = callback.Query() })
+	require.Equal(t, http.StatusOK, w.Code)
+	w = login(router, "ivanov", func(callback *url.URL) {
+		query := callback.Query()
+		query.Set("code", code.Get("code"))
+		callback.RawQuery = query.Encode()
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Обратный вызов без начатого входа
+	w = doRequest(router, "GET", "/auth/callback?code=x&state=y", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/handlers"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOrganizations проверяет, что организации не видят данных друг друга
+func TestOrganizations(t *testing.T) {
+	router, repos := setupRouter()
+	ctx := testContext()
+
+	// Вторая организация со своим ключом администратора
+	organization := models.Organization{Name: "Рога и копыта"}
+	require.NoError(t, repos.Organizations.Create(ctx, &organization))
+	_, key, err := auth.CreateAPIKey(repository.WithOrganization(ctx, organization.ID), repos.APIKeys, "other")
+	require.NoError(t, err)
+	other := map[string]string{auth.APIKeyHeader: key}
+
+	w := doRequestWithHeaders(router, "GET", "/organization", nil, other)
+	require.Equal(t, http.StatusOK, w.Code)
+	var current models.Organization
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &current))
+	assert.Equal(t, organization.ID, current.ID)
+	assert.Equal(t, "Рога и копыта", current.Name)
+
+	// Паспорт уникален в пределах организации
+	user := createTestUser(t, repos)
+	assert.Equal(t, uint(models.DefaultOrganizationID), user.OrganizationID)
+	w = doRequestWithHeaders(router, "POST", "/users", getTestUser(), other)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var twin models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &twin))
+	assert.Equal(t, organization.ID, twin.OrganizationID)
+	w = doRequestWithHeaders(router, "POST", "/users", getTestUser(), other)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Subject провайдера тоже уникален в пределах организации
+	subject := "shared-subject"
+	user.OIDCSubject = &subject
+	require.NoError(t, repos.Users.Update(ctx, &user))
+	twin.OIDCSubject = &subject
+	require.NoError(t, repos.Users.Update(ctx, &twin))
+	duplicate := models.User{Passport: models.Passport{Series: "1111", Number: "222222"}, Surname: "Двойник", Name: "Иван", OIDCSubject: &subject}
+	assert.ErrorIs(t, repos.Users.Create(repository.WithOrganization(ctx, organization.ID), &duplicate), repository.ErrDuplicate)
+
+	// Чужие пользователи, их задачи и проекты не видны
+	w = doRequest(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]string{"name": "Отчет"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = doRequestWithHeaders(router, "GET", "/users", nil, other)
+	require.Equal(t, http.StatusOK, w.Code)
+	var users []models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	require.Len(t, users, 1)
+	assert.Equal(t, twin.ID, users[0].ID)
+
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/users/%d", user.ID), nil, other)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/users/%d/tasks", user.ID), nil, other)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequestWithHeaders(router, "PUT", fmt.Sprintf("/tasks/%d/finish", user.ID), nil, other)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequestWithHeaders(router, "DELETE", fmt.Sprintf("/users/%d", user.ID), nil, other)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	tasks, err := repos.Tasks.ListByUser(repository.WithOrganization(ctx, organization.ID), user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+
+	w = doRequest(router, "POST", "/projects", map[string]interface{}{"name": "Сайт"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var project models.Project
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &project))
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/projects/%d", project.ID), nil, other)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequestWithHeaders(router, "POST", "/projects", map[string]interface{}{"name": "Сайт"}, other)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Журнал аудита и ключи API тоже свои у каждой организации
+	w = doRequestWithHeaders(router, "GET", "/audit", nil, other)
+	require.Equal(t, http.StatusOK, w.Code)
+	var entries []models.AuditEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		assert.Equal(t, organization.ID, entry.OrganizationID)
+	}
+	// У каждой организации своя цепочка хешей
+	assert.Empty(t, entries[len(entries)-1].PrevHash)
+	chains, err := repos.Audit.Verify(ctx)
+	require.NoError(t, err)
+	require.Len(t, chains, 4)
+	for _, chain := range chains {
+		assert.True(t, chain.Valid, chain)
+	}
+	assert.Equal(t, organization.ID, chains[2].OrganizationID)
+	assert.Equal(t, len(entries), chains[2].Checked)
+
+	// Администратор проверяет только цепочки своей организации
+	w = doRequestWithHeaders(router, "GET", "/audit/verify", nil, other)
+	require.Equal(t, http.StatusOK, w.Code)
+	var verification handlers.ChainVerificationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &verification))
+	require.Len(t, verification.Chains, 2)
+	for _, chain := range verification.Chains {
+		assert.Equal(t, organization.ID, chain.OrganizationID)
+	}
+
+	w = doRequestWithHeaders(router, "GET", "/api-keys", nil, other)
+	require.Equal(t, http.StatusOK, w.Code)
+	var keys []models.APIKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	require.Len(t, keys, 1)
+	assert.Equal(t, "other", keys[0].Name)
+	w = doRequestWithHeaders(router, "DELETE", "/api-keys/1", nil, other)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Пользователь видит только свою организацию
+	w = doRequestWithHeaders(router, "GET", "/organization", nil, map[string]string{"Authorization": testToken(twin.ID)})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &current))
+	assert.Equal(t, organization.ID, current.ID)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/peopleinfo"
+	"github.com/ananikitina/time-tracker/repository"
+	"github.com/ananikitina/time-tracker/routes"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupRouterWithPeople создает роутер, дополняющий новых пользователей из сервиса по адресу url
+func setupRouterWithPeople(url, notFound string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	people := peopleinfo.NewClient(peopleinfo.Config{
+		URL:        url,
+		Timeout:    100 * time.Millisecond,
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+		NotFound:   notFound,
+	})
+
+	r := gin.New()
+	repos := repository.NewMemory()
+	routes.SetupRouter(r, repos, people, testAuthenticator(repos), nil)
+	return r
+}
+
+// TestAddUserWithPeopleInfo проверяет заполнение данных пользователя по паспорту
+func TestAddUserWithPeopleInfo(t *testing.T) {
+	// Первый запрос к сервису завершается ошибкой
+	var requests atomic.Int32
+	stub := peopleinfo.NewStub(peopleinfo.StubPeople)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		stub.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	router := setupRouterWithPeople(server.URL, peopleinfo.NotFoundReject)
+
+	// Данные берутся из сервиса после повторного запроса
+	w := doRequest(router, "POST", "/users", map[string]string{"passportNumber": "1234 567890"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var user models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "Иванов", user.Surname)
+	assert.Equal(t, "Иванович", user.Patronymic)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// Переданные клиентом данные не перезаписываются
+	w = doRequest(router, "POST", "/users", map[string]string{"passportNumber": "4321 098765", "surname": "Сидорова"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "Сидорова", user.Surname)
+	assert.Equal(t, "Анна", user.Name)
+
+	// Неизвестный паспорт
+	w = doRequest(router, "POST", "/users", map[string]string{"passportNumber": "1111 111111"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Паспорт без серии
+	w = doRequest(router, "POST", "/users", map[string]string{"passportNumber": "567890"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Неизвестный паспорт разрешен политикой
+	router = setupRouterWithPeople(server.URL, peopleinfo.NotFoundAllow)
+	w = doRequest(router, "POST", "/users", map[string]string{"passportNumber": "1111 111111", "name": "Олег"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "Олег", user.Name)
+
+	// Сервис не отвечает дольше таймаута
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		stub.ServeHTTP(w, r)
+	}))
+	defer slow.Close()
+
+	router = setupRouterWithPeople(slow.URL, peopleinfo.NotFoundReject)
+	w = doRequest(router, "POST", "/users", map[string]string{"passportNumber": "1234 567890"})
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reportFixture — данные для отчетов по репозиториям: задачи через переходы на летнее и зимнее время,
+// перерыв через полночь и незаконченная задача
+type reportFixture struct {
+	location *time.Location
+	first    models.User
+	second   models.User
+	project  models.Project
+	// now — текущее время отчетов, незаконченная задача длится до него
+	now time.Time
+}
+
+// newReportFixture сохраняет данные для отчетов в репозитории
+func newReportFixture(t *testing.T, repos repository.Repositories) reportFixture {
+	t.Helper()
+	ctx := testContext()
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	fixture := reportFixture{
+		location: berlin,
+		first:    models.User{Passport: models.Passport{Series: "1111", Number: "111111"}, Surname: "Антонов", Name: "Антон"},
+		second:   models.User{Passport: models.Passport{Series: "2222", Number: "222222"}, Surname: "Борисов", Name: "Борис"},
+		project:  models.Project{Name: "Сайт"},
+		now:      time.Date(2024, 4, 2, 0, 30, 0, 0, berlin),
+	}
+	require.NoError(t, repos.Users.Create(ctx, &fixture.first))
+	require.NoError(t, repos.Users.Create(ctx, &fixture.second))
+	require.NoError(t, repos.Projects.Create(ctx, &fixture.project))
+
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, berlin)
+	}
+	addTask := func(userID uint, projectID *uint, name string, start, end time.Time, breaks ...models.TaskBreak) {
+		task := models.Task{UserID: userID, ProjectID: projectID, TaskName: name, StartTime: start, Breaks: breaks}
+		if !end.IsZero() {
+			task.EndTime = &end
+		}
+		require.NoError(t, repos.Tasks.Create(ctx, &task))
+	}
+	breakEnd := at(time.April, 1, 0, 30)
+
+	// 31 марта длится 23 часа, перерыв переходит через полночь
+	addTask(fixture.first.ID, nil, "design", at(time.March, 30, 22, 0), at(time.April, 1, 2, 0),
+		models.TaskBreak{StartTime: at(time.March, 31, 23, 30), EndTime: &breakEnd})
+	// Задача через переход на летнее время длится 2 часа
+	addTask(fixture.second.ID, &fixture.project.ID, "review", at(time.March, 31, 1, 0), at(time.March, 31, 4, 0))
+	addTask(fixture.second.ID, &fixture.project.ID, "design", at(time.April, 1, 9, 0), at(time.April, 1, 10, 0))
+	// Незаконченная задача
+	addTask(fixture.second.ID, nil, "review", at(time.April, 1, 23, 0), time.Time{})
+	// 27 октября длится 25 часов
+	addTask(fixture.first.ID, nil, "design", at(time.October, 26, 22, 0), at(time.October, 28, 2, 0))
+	return fixture
+}
+
+// reportRow возвращает строку отчета с итогом
+func reportRow(row models.TimeReportRow, seconds int64) models.TimeReportRow {
+	row.SetTotal(seconds)
+	return row
+}
+
+// TestTeamReportRepositories проверяет отчет по команде одинаково на репозиториях в памяти и на PostgreSQL:
+// деление по дням часового пояса при переходах на летнее и зимнее время, вложенные подытоги,
+// перерывы через полночь и обрезку периодом
+func TestTeamReportRepositories(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos repository.Repositories) {
+		fixture := newReportFixture(t, repos)
+		ctx := testContext()
+		first, second, project := fixture.first, fixture.second, fixture.project
+		march := func(day, hour int) time.Time {
+			return time.Date(2024, time.March, day, hour, 0, 0, 0, fixture.location)
+		}
+		firstName, secondName := "Антонов Антон", "Борисов Борис"
+
+		// По пользователям и дням с незаконченной задачей, обрезанной концом периода
+		rows, err := repos.Tasks.TeamReport(ctx, repository.TeamReportFilter{
+			Start: march(30, 0), End: march(33, 0), Now: fixture.now, Location: fixture.location,
+			IncludeActive: true, GroupBy: []string{repository.ReportByUser, repository.ReportByDay},
+		})
+		require.NoError(t, err)
+		byUser := []string{repository.ReportByUser}
+		byUserDay := []string{repository.ReportByUser, repository.ReportByDay}
+		assert.Equal(t, []models.TimeReportRow{
+			reportRow(models.TimeReportRow{GroupedBy: byUserDay, UserID: &first.ID, User: firstName, Day: "2024-03-30"}, 7200),
+			reportRow(models.TimeReportRow{GroupedBy: byUserDay, UserID: &first.ID, User: firstName, Day: "2024-03-31"}, 81000),
+			reportRow(models.TimeReportRow{GroupedBy: byUserDay, UserID: &first.ID, User: firstName, Day: "2024-04-01"}, 5400),
+			reportRow(models.TimeReportRow{GroupedBy: byUser, UserID: &first.ID, User: firstName}, 93600),
+			reportRow(models.TimeReportRow{GroupedBy: byUserDay, UserID: &second.ID, User: secondName, Day: "2024-03-31"}, 7200),
+			reportRow(models.TimeReportRow{GroupedBy: byUserDay, UserID: &second.ID, User: secondName, Day: "2024-04-01"}, 7200),
+			reportRow(models.TimeReportRow{GroupedBy: byUser, UserID: &second.ID, User: secondName}, 14400),
+			reportRow(models.TimeReportRow{GroupedBy: []string{}}, 108000),
+		}, rows)
+
+		// Три уровня вложенных подытогов, задачи без проекта первыми
+		rows, err = repos.Tasks.TeamReport(ctx, repository.TeamReportFilter{
+			Start: march(30, 0), End: march(33, 0), Now: fixture.now, Location: fixture.location,
+			GroupBy: []string{repository.ReportByProject, repository.ReportByUser, repository.ReportByTask},
+		})
+		require.NoError(t, err)
+		byProject := []string{repository.ReportByProject}
+		byProjectUser := []string{repository.ReportByProject, repository.ReportByUser}
+		byProjectUserTask := []string{repository.ReportByProject, repository.ReportByUser, repository.ReportByTask}
+		assert.Equal(t, []models.TimeReportRow{
+			reportRow(models.TimeReportRow{GroupedBy: byProjectUserTask, UserID: &first.ID, User: firstName, Task: "design"}, 93600),
+			reportRow(models.TimeReportRow{GroupedBy: byProjectUser, UserID: &first.ID, User: firstName}, 93600),
+			reportRow(models.TimeReportRow{GroupedBy: byProject}, 93600),
+			reportRow(models.TimeReportRow{GroupedBy: byProjectUserTask, ProjectID: &project.ID, Project: "Сайт", UserID: &second.ID, User: secondName, Task: "design"}, 3600),
+			reportRow(models.TimeReportRow{GroupedBy: byProjectUserTask, ProjectID: &project.ID, Project: "Сайт", UserID: &second.ID, User: secondName, Task: "review"}, 7200),
+			reportRow(models.TimeReportRow{GroupedBy: byProjectUser, ProjectID: &project.ID, Project: "Сайт", UserID: &second.ID, User: secondName}, 10800),
+			reportRow(models.TimeReportRow{GroupedBy: byProject, ProjectID: &project.ID, Project: "Сайт"}, 10800),
+			reportRow(models.TimeReportRow{GroupedBy: []string{}}, 104400),
+		}, rows)
+
+		// Переход на зимнее время: в 27 октября 25 часов, недели начинаются с понедельника
+		rows, err = repos.Tasks.TeamReport(ctx, repository.TeamReportFilter{
+			Start: time.Date(2024, time.October, 21, 0, 0, 0, 0, fixture.location), End: time.Date(2024, time.November, 4, 0, 0, 0, 0, fixture.location),
+			Now: fixture.now, Location: fixture.location, IncludeActive: true,
+			GroupBy: []string{repository.ReportByWeek, repository.ReportByDay},
+		})
+		require.NoError(t, err)
+		byWeek := []string{repository.ReportByWeek}
+		byWeekDay := []string{repository.ReportByWeek, repository.ReportByDay}
+		assert.Equal(t, []models.TimeReportRow{
+			reportRow(models.TimeReportRow{GroupedBy: byWeekDay, Week: "2024-10-21", Day: "2024-10-26"}, 7200),
+			reportRow(models.TimeReportRow{GroupedBy: byWeekDay, Week: "2024-10-21", Day: "2024-10-27"}, 90000),
+			reportRow(models.TimeReportRow{GroupedBy: byWeek, Week: "2024-10-21"}, 97200),
+			reportRow(models.TimeReportRow{GroupedBy: byWeekDay, Week: "2024-10-28", Day: "2024-10-28"}, 7200),
+			reportRow(models.TimeReportRow{GroupedBy: byWeek, Week: "2024-10-28"}, 7200),
+			reportRow(models.TimeReportRow{GroupedBy: []string{}}, 104400),
+		}, rows)
+
+		// Период обрезает задачу и перерыв, задачи вне периода не входят
+		rows, err = repos.Tasks.TeamReport(ctx, repository.TeamReportFilter{
+			Start: march(31, 12), End: time.Date(2024, time.April, 1, 0, 15, 0, 0, fixture.location),
+			Now: fixture.now, Location: fixture.location, GroupBy: byUser,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []models.TimeReportRow{
+			reportRow(models.TimeReportRow{GroupedBy: byUser, UserID: &first.ID, User: firstName}, 41400),
+			reportRow(models.TimeReportRow{GroupedBy: []string{}}, 41400),
+		}, rows)
+
+		// Отчет по проекту и пользователям без времени состоит из нулевого общего итога
+		rows, err = repos.Tasks.TeamReport(ctx, repository.TeamReportFilter{
+			UserIDs: []uint{first.ID}, ProjectID: &project.ID,
+			Start: march(30, 0), End: march(33, 0), Now: fixture.now, Location: fixture.location, GroupBy: byUser,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []models.TimeReportRow{reportRow(models.TimeReportRow{GroupedBy: []string{}}, 0)}, rows)
+	})
+}
+
+// workloadRow возвращает строку отчета о загрузке с итогом
+func workloadRow(row models.TaskWorkload, seconds int64) models.TaskWorkload {
+	row.SetTotal(seconds)
+	return row
+}
+
+// TestWorkloadRepositories проверяет отчет о загрузке одинаково на репозиториях в памяти и на PostgreSQL:
+// обрезку периодом, вычитание перерывов и учет незаконченных задач
+func TestWorkloadRepositories(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos repository.Repositories) {
+		fixture := newReportFixture(t, repos)
+		ctx := testContext()
+		first, second, project := fixture.first, fixture.second, fixture.project
+		at := func(month time.Month, day, hour, minute int) time.Time {
+			return time.Date(2024, month, day, hour, minute, 0, 0, fixture.location)
+		}
+		start, end := at(time.March, 30, 0, 0), at(time.April, 3, 0, 0)
+
+		// Незаконченная задача считается до текущего времени
+		workload, err := repos.Tasks.Workload(ctx, repository.WorkloadFilter{
+			UserID: second.ID, Start: start, End: end, Now: fixture.now, IncludeActive: true, GroupBy: repository.WorkloadByTask,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []models.TaskWorkload{
+			workloadRow(models.TaskWorkload{Task: "review"}, 12600),
+			workloadRow(models.TaskWorkload{Task: "design"}, 3600),
+		}, workload)
+
+		// Без include_active незаконченная задача не считается
+		workload, err = repos.Tasks.Workload(ctx, repository.WorkloadFilter{
+			UserID: second.ID, Start: start, End: end, Now: fixture.now, GroupBy: repository.WorkloadByTask,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []models.TaskWorkload{
+			workloadRow(models.TaskWorkload{Task: "review"}, 7200),
+			workloadRow(models.TaskWorkload{Task: "design"}, 3600),
+		}, workload)
+
+		// По проектам, задачи без проекта — отдельной строкой
+		workload, err = repos.Tasks.Workload(ctx, repository.WorkloadFilter{
+			UserID: second.ID, Start: start, End: end, Now: fixture.now, IncludeActive: true, GroupBy: repository.WorkloadByProject,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []models.TaskWorkload{
+			workloadRow(models.TaskWorkload{ProjectID: &project.ID, Project: "Сайт"}, 10800),
+			workloadRow(models.TaskWorkload{}, 5400),
+		}, workload)
+
+		// Период обрезает задачи проекта
+		workload, err = repos.Tasks.Workload(ctx, repository.WorkloadFilter{
+			UserID: second.ID, Start: at(time.March, 31, 3, 0), End: at(time.April, 1, 9, 30), Now: fixture.now,
+			IncludeActive: true, ProjectID: &project.ID, GroupBy: repository.WorkloadByTask,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []models.TaskWorkload{
+			workloadRow(models.TaskWorkload{Task: "review"}, 3600),
+			workloadRow(models.TaskWorkload{Task: "design"}, 1800),
+		}, workload)
+
+		// Перерыв вычитается в пределах периода: 31 марта длится 23 часа, из них полчаса перерыва
+		workload, err = repos.Tasks.Workload(ctx, repository.WorkloadFilter{
+			UserID: first.ID, Start: at(time.March, 31, 0, 0), End: at(time.April, 1, 0, 0), Now: fixture.now, GroupBy: repository.WorkloadByTask,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []models.TaskWorkload{workloadRow(models.TaskWorkload{Task: "design"}, 81000)}, workload)
+
+		// Незаконченная задача длится до текущего времени и не попадает в период после него
+		workload, err = repos.Tasks.Workload(ctx, repository.WorkloadFilter{
+			UserID: second.ID, Start: at(time.April, 2, 1, 0), End: end, Now: fixture.now, IncludeActive: true, GroupBy: repository.WorkloadByTask,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, workload)
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRepositoriesIsolateOrganizations проверяет, что каждый метод репозиториев
+// не видит и не меняет данные другой организации. Row-level security в базе нет,
+// изоляцию обеспечивают только репозитории.
+func TestRepositoriesIsolateOrganizations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos repository.Repositories) {
+		background := context.Background()
+		organization := models.Organization{Name: "Чужая"}
+		require.NoError(t, repos.Organizations.Create(background, &organization))
+		own := repository.WithOrganization(background, models.DefaultOrganizationID)
+		other := repository.WithOrganization(background, organization.ID)
+		day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+		now := day.Add(20 * time.Hour)
+
+		// Данные своей организации
+		user := models.User{Passport: models.Passport{Series: "4510", Number: "890231"}, Surname: "Вавилов", Name: "Анатолий", Role: models.RoleEmployee}
+		require.NoError(t, repos.Users.Create(own, &user))
+		project := models.Project{Name: "Сайт"}
+		require.NoError(t, repos.Projects.Create(own, &project))
+		end := day.Add(11 * time.Hour)
+		entry := models.Task{UserID: user.ID, TaskName: "Код", ProjectID: &project.ID, StartTime: day.Add(9 * time.Hour), EndTime: &end}
+		require.NoError(t, repos.Tasks.CreateEntry(own, &entry))
+		running := models.Task{UserID: user.ID, TaskName: "Отчет", StartTime: day.Add(12 * time.Hour)}
+		_, err := repos.Tasks.Start(own, &running, false)
+		require.NoError(t, err)
+		require.NoError(t, repos.Audit.Record(own, &models.AuditEntry{Actor: "test", Action: models.AuditCreate, EntityType: models.AuditEntityTask, EntityID: entry.ID}))
+		revision, err := models.NewTaskRevision(entry, false)
+		require.NoError(t, err)
+		require.NoError(t, repos.Audit.RecordRevision(own, &revision))
+		key, _, err := auth.CreateAPIKey(own, repos.APIKeys, "own")
+		require.NoError(t, err)
+		token, _, err := auth.CreateToken(own, repos.Tokens, models.PersonalAccessToken{UserID: user.ID, Name: "own", Scopes: []string{models.ScopeTasksRead}})
+		require.NoError(t, err)
+
+		// Без организации в контексте репозитории ничего не видят и не создают
+		users, err := repos.Users.List(background, repository.UserFilter{Deleted: repository.DeletedInclude})
+		require.NoError(t, err)
+		assert.Empty(t, users)
+		_, err = repos.Users.GetByID(background, user.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = repos.APIKeys.GetByHash(background, key.Hash)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.ErrorIs(t, repos.Projects.Create(background, &models.Project{Name: "Ничей"}), repository.ErrNoOrganization)
+		chains, err := repos.Audit.Verify(background)
+		require.NoError(t, err)
+		assert.Empty(t, chains)
+
+		// Пользователи
+		users, err = repos.Users.List(other, repository.UserFilter{Deleted: repository.DeletedInclude})
+		require.NoError(t, err)
+		assert.Empty(t, users)
+		_, err = repos.Users.GetByID(other, user.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		changed := user
+		changed.Surname = "Чужой"
+		assert.ErrorIs(t, repos.Users.Update(other, &changed), repository.ErrNotFound)
+		assert.ErrorIs(t, repos.Users.Delete(other, user.ID, 0), repository.ErrNotFound)
+		_, err = repos.Users.Restore(other, user.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.ErrorIs(t, repos.Users.Purge(other, user.ID, repository.TasksDelete), repository.ErrNotFound)
+
+		// Задачи
+		foreign := models.Task{UserID: user.ID, TaskName: "Чужая", StartTime: day.Add(14 * time.Hour)}
+		assert.ErrorIs(t, repos.Tasks.Create(other, &foreign), repository.ErrNotFound)
+		foreignEnd := day.Add(15 * time.Hour)
+		foreign = models.Task{UserID: user.ID, TaskName: "Чужая", StartTime: day.Add(14 * time.Hour), EndTime: &foreignEnd}
+		assert.ErrorIs(t, repos.Tasks.CreateEntry(other, &foreign), repository.ErrNotFound)
+		_, err = repos.Tasks.Get(other, user.ID, entry.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		changedEntry := entry
+		changedEntry.TaskName = "Чужая"
+		assert.ErrorIs(t, repos.Tasks.Update(other, &changedEntry), repository.ErrNotFound)
+		changedEntry = entry
+		changedEntry.TaskName = "Чужая"
+		assert.ErrorIs(t, repos.Tasks.UpdateEntry(other, &changedEntry), repository.ErrNotFound)
+		assert.ErrorIs(t, repos.Tasks.Delete(other, user.ID, entry.ID, 0), repository.ErrNotFound)
+		foreign = models.Task{UserID: user.ID, TaskName: "Чужая", StartTime: now}
+		_, err = repos.Tasks.Start(other, &foreign, true)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		foreign = models.Task{UserID: user.ID, TaskName: "Чужая", StartTime: now}
+		_, err = repos.Tasks.Switch(other, &foreign)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = repos.Tasks.Pause(other, user.ID, now)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = repos.Tasks.Resume(other, user.ID, now)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = repos.Tasks.Finish(other, user.ID, now)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = repos.Tasks.GetActive(other, user.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		tasks, err := repos.Tasks.ListByUser(other, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, tasks)
+		tasks, err = repos.Tasks.ListFinished(other, user.ID, day, day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		assert.Empty(t, tasks)
+		workload, err := repos.Tasks.Workload(other, repository.WorkloadFilter{
+			UserID: user.ID, Start: day, End: day.AddDate(0, 0, 1), Now: now, IncludeActive: true, GroupBy: repository.WorkloadByTask,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, workload)
+		report, err := repos.Tasks.TeamReport(other, repository.TeamReportFilter{
+			Start: day, End: day.AddDate(0, 0, 1), Now: now, Location: time.UTC, IncludeActive: true, GroupBy: []string{repository.ReportByUser},
+		})
+		require.NoError(t, err)
+		for _, row := range report {
+			assert.Nil(t, row.UserID)
+			assert.Zero(t, row.TotalSeconds)
+		}
+
+		// Проекты
+		projects, err := repos.Projects.List(other, repository.ProjectFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, projects)
+		_, err = repos.Projects.GetByID(other, project.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		changedProject := project
+		changedProject.Name = "Чужой"
+		assert.ErrorIs(t, repos.Projects.Update(other, &changedProject), repository.ErrNotFound)
+		assert.ErrorIs(t, repos.Projects.Delete(other, project.ID), repository.ErrNotFound)
+
+		// Журнал аудита и история записей
+		entries, err := repos.Audit.List(other, repository.AuditFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		revisions, err := repos.Audit.ListRevisions(other, user.ID, entry.ID)
+		require.NoError(t, err)
+		assert.Empty(t, revisions)
+		chains, err = repos.Audit.Verify(other)
+		require.NoError(t, err)
+		require.Len(t, chains, 2)
+		for _, chain := range chains {
+			assert.Equal(t, organization.ID, chain.OrganizationID)
+			assert.Zero(t, chain.Checked)
+		}
+
+		// Ключи API и личные токены
+		keys, err := repos.APIKeys.List(other)
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+		_, err = repos.APIKeys.GetByHash(other, key.Hash)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = repos.APIKeys.Revoke(other, key.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.ErrorIs(t, repos.Tokens.Create(other, &models.PersonalAccessToken{
+			UserID: user.ID, Name: "foreign", Prefix: "ttp_x", Hash: "foreign", Scopes: []string{models.ScopeTasksRead},
+		}), repository.ErrNotFound)
+		tokens, err := repos.Tokens.List(other, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, tokens)
+		_, err = repos.Tokens.GetByHash(other, token.Hash)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.ErrorIs(t, repos.Tokens.Touch(other, token.ID, now), repository.ErrNotFound)
+		_, err = repos.Tokens.Revoke(other, user.ID, token.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		// Своя организация по-прежнему видит все без изменений
+		stored, err := repos.Users.GetByID(own, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.Surname, stored.Surname)
+		tasks, err = repos.Tasks.ListByUser(own, user.ID)
+		require.NoError(t, err)
+		require.Len(t, tasks, 2)
+		assert.Equal(t, "Код", tasks[0].TaskName)
+		assert.Nil(t, tasks[1].EndTime)
+		_, err = repos.Projects.GetByID(own, project.ID)
+		assert.NoError(t, err)
+		_, err = repos.APIKeys.GetByHash(own, key.Hash)
+		assert.NoError(t, err)
+		_, err = repos.Tokens.GetByHash(own, token.Hash)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ananikitina/time-tracker/auth"
+	"github.com/ananikitina/time-tracker/handlers"
+	"github.com/ananikitina/time-tracker/models"
+	"github.com/ananikitina/time-tracker/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPersonalAccessTokens проверяет создание, области действия и отзыв личных токенов
+func TestPersonalAccessTokens(t *testing.T) {
+	router, repos := setupRouter()
+	user := createTestUser(t, repos)
+	other := models.User{Passport: models.Passport{Series: "7777", Number: "777777"}, Surname: "Соколова", Name: "Мария", Role: models.RoleEmployee}
+	require.NoError(t, repos.Users.Create(testContext(), &other))
+	tokens := fmt.Sprintf("/users/%d/tokens", user.ID)
+	owner := map[string]string{"Authorization": testToken(user.ID)}
+
+	// Пользователь создает токен себе, сам токен возвращается только при создании
+	w := doRequestWithHeaders(router, "POST", tokens, map[string]interface{}{"name": "Виджет", "scopes": []string{"tasks:write"}}, owner)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created handlers.CreatedToken
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Regexp(t, "^ttp_", created.Token)
+	assert.Equal(t, created.Token[:10], created.Prefix)
+	assert.Equal(t, []string{"tasks:write"}, created.Scopes)
+	require.NotNil(t, created.ExpiresAt)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 90), *created.ExpiresAt, time.Minute)
+	widget := map[string]string{"Authorization": "Bearer " + created.Token}
+
+	// Токен ведет время своего пользователя
+	w = doRequestWithHeaders(router, "POST", fmt.Sprintf("/tasks/%d/start", user.ID), map[string]string{"name": "Код"}, widget)
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = doRequestWithHeaders(router, "PUT", fmt.Sprintf("/tasks/%d/finish", user.ID), nil, widget)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// но не чужое и не вне своих областей
+	w = doRequestWithHeaders(router, "POST", fmt.Sprintf("/tasks/%d/start", other.ID), map[string]string{"name": "Код"}, widget)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/users/%d/tasks", user.ID), nil, widget)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "the token lacks the tasks:read scope")
+	w = doRequestWithHeaders(router, "GET", tokens, nil, widget)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "personal access tokens may not be used for this request")
+
+	// Список показывает время последнего использования, но не сами токены
+	w = doRequestWithHeaders(router, "GET", tokens, nil, owner)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Token)
+	var list []models.PersonalAccessToken
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	require.NotNil(t, list[0].LastUsedAt)
+	assert.WithinDuration(t, time.Now(), *list[0].LastUsedAt, time.Minute)
+
+	// Записи, сделанные с токеном, называют и токен
+	entries, err := repos.Audit.List(testContext(), repository.AuditFilter{EntityType: models.AuditEntityTask})
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		assert.Equal(t, fmt.Sprintf("user:%d/token:%d", user.ID, created.ID), entry.Actor)
+	}
+
+	// Чужие токены создавать нельзя никому, даже администратору
+	w = doRequestWithHeaders(router, "POST", fmt.Sprintf("/users/%d/tokens", other.ID), map[string]interface{}{"name": "x", "scopes": []string{"tasks:read"}}, owner)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(router, "POST", fmt.Sprintf("/users/%d/tokens", other.ID), map[string]interface{}{"name": "Отчеты", "scopes": []string{"reports:read"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "you may only access your own data")
+
+	// Проверка запроса
+	w = doRequestWithHeaders(router, "POST", tokens, map[string]interface{}{
+		"name": "x", "scopes": []string{"admin"}, "expires_at": time.Now().Add(-time.Hour),
+	}, owner)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var validation handlers.ValidationErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &validation))
+	require.Len(t, validation.Fields, 2)
+	assert.Equal(t, "scopes", validation.Fields[0].Field)
+	assert.Equal(t, "expires_at", validation.Fields[1].Field)
+
+	// Просроченный токен не действует
+	expiresAt := time.Now().Add(-time.Minute)
+	_, expired, err := auth.CreateToken(testContext(), repos.Tokens, models.PersonalAccessToken{
+		UserID: user.ID, Name: "Скрипт", Scopes: []string{"tasks:read"}, ExpiresAt: &expiresAt,
+	})
+	require.NoError(t, err)
+	w = doRequestWithHeaders(router, "GET", fmt.Sprintf("/users/%d/tasks", user.ID), nil, map[string]string{"Authorization": "Bearer " + expired})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "token expired")
+
+	// Администратор видит и отзывает токены пользователя
+	w = doRequest(router, "GET", tokens, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, "DELETE", fmt.Sprintf("%s/%d", tokens, created.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Отозванный токен не действует
+	w = doRequestWithHeaders(router, "PUT", fmt.Sprintf("/tasks/%d/finish", user.ID), nil, widget)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doRequestWithHeaders(router, "DELETE", fmt.Sprintf("%s/%d", tokens, created.ID), nil, owner)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Создание и отзыв токена записаны в журнал с их авторами
+	entries, err = repos.Audit.List(testContext(), repository.AuditFilter{EntityType: models.AuditEntityToken, EntityID: created.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.AuditRevoke, entries[0].Action)
+	assert.Equal(t, "api-key:test", entries[0].Actor)
+	assert.Contains(t, entries[0].Changes, "revoked_at")
+	assert.Equal(t, models.AuditCreate, entries[1].Action)
+	assert.Equal(t, fmt.Sprintf("user:%d", user.ID), entries[1].Actor)
+	assert.NotContains(t, fmt.Sprint(entries[1].Changes), created.Token)
+}